@@ -12,6 +12,7 @@ import (
 	goRedis "github.com/go-redis/redis/v8"
 
 	ferrors "github.com/lzw5399/go-common-public/library/errors"
+	"github.com/lzw5399/go-common-public/library/health"
 	"github.com/lzw5399/go-common-public/library/log"
 )
 
@@ -19,6 +20,16 @@ func Client() goRedis.UniversalClient {
 	return gUniClient
 }
 
+// HealthCheck ping redis, 用于 health.Register
+func HealthCheck() health.Checker {
+	return func(ctx context.Context) error {
+		if gUniClient == nil {
+			return errors.New("redis not initialized")
+		}
+		return gUniClient.Ping(ctx).Err()
+	}
+}
+
 // Set Zero expiration means the key has no expiration time.
 func Set(ctx context.Context, key string, value interface{}, expiration time.Duration) (string, error) {
 	return gUniClient.Set(ctx, key, value, expiration).Result()
@@ -0,0 +1,195 @@
+package fconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// confFileExts 支持的配置文件格式, 同名的多个文件按此顺序加载, 同一个配置项以后加载的为准
+var confFileExts = []string{".conf", ".yaml", ".yml", ".json", ".toml"}
+
+// loadConfFiles 加载 {confBaseDir}/{name}.{ext} 的所有格式, 文件中的配置写入环境变量后由 env.Parse 统一解析
+// 多个格式的文件先按 confFileExts 的顺序合并, 同一个配置项后面的格式覆盖前面的, 保底和环境两级规则一致
+// overload为false时不覆盖已经存在的环境变量(与 godotenv.Load 一致), 为true时覆盖(与 godotenv.Overload 一致)
+func loadConfFiles(confBaseDir, name string, overload bool, keys map[string]string) error {
+	merged := make(map[string]string)
+	for _, ext := range confFileExts {
+		file := filepath.Join(confBaseDir, name+ext)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+
+		var values map[string]string
+		var err error
+		if ext == ".conf" {
+			values, err = godotenv.Read(file)
+		} else {
+			values, err = readConfFile(file, keys)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "load config file %s error", file)
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+	}
+
+	for k, v := range merged {
+		if _, exist := os.LookupEnv(k); exist && !overload {
+			continue
+		}
+		_ = os.Setenv(k, v)
+	}
+	return nil
+}
+
+// readConfFile 读取yaml/json/toml文件, 返回环境变量名到值的映射
+// 顶层key可以是env tag或json tag, 不区分大小写; 不认识的key如果是对象则作为分组展开
+// 列表按逗号拼接, 认识的key的值是对象时序列化为json, 例如 ORG_DICT_JSON
+func readConfFile(file string, keys map[string]string) (map[string]string, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		var yamlData map[interface{}]interface{}
+		if err := yaml.Unmarshal(raw, &yamlData); err != nil {
+			return nil, err
+		}
+		if yamlData != nil {
+			data = normalizeYaml(yamlData).(map[string]interface{})
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format")
+	}
+
+	values := make(map[string]string)
+	if err := flattenConf(data, keys, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flattenConf(data map[string]interface{}, keys map[string]string, values map[string]string) error {
+	for k, v := range data {
+		name, known := keys[strings.ToUpper(k)]
+		if !known {
+			// 不认识的对象作为分组展开
+			if group, ok := v.(map[string]interface{}); ok {
+				if err := flattenConf(group, keys, values); err != nil {
+					return err
+				}
+				continue
+			}
+			name = strings.ToUpper(k)
+		}
+
+		value, err := confValueString(v)
+		if err != nil {
+			return errors.Wrapf(err, "config %s", k)
+		}
+		values[name] = value
+	}
+	return nil
+}
+
+func confValueString(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32), nil
+	case []interface{}:
+		parts := make([]string, 0, len(value))
+		for _, item := range value {
+			part, err := confValueString(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]interface{}:
+		raw, err := json.Marshal(value)
+		return string(raw), err
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// normalizeYaml yaml.v2 的对象key是interface{}, 统一转换为string
+func normalizeYaml(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[fmt.Sprintf("%v", k)] = normalizeYaml(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeYaml(item)
+		}
+		return value
+	}
+	return v
+}
+
+// confKeys 收集配置结构体中的env tag和json tag, 转换为大写后映射到env tag
+func confKeys(configs ...interface{}) map[string]string {
+	keys := make(map[string]string)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			envKey := strings.Split(field.Tag.Get("env"), ",")[0]
+			if envKey == "" {
+				if field.Anonymous {
+					walk(field.Type)
+				}
+				continue
+			}
+			keys[strings.ToUpper(envKey)] = envKey
+			if jsonKey := strings.Split(field.Tag.Get("json"), ",")[0]; jsonKey != "" && jsonKey != "-" {
+				keys[strings.ToUpper(jsonKey)] = envKey
+			}
+		}
+	}
+	for _, cfg := range configs {
+		walk(reflect.TypeOf(cfg))
+	}
+	return keys
+}
@@ -0,0 +1,111 @@
+package fconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fileTestConfig struct {
+	*Config
+	CallbackURL string   `env:"FT_CALLBACK_URL" json:"callbackUrl"`
+	Hosts       []string `env:"FT_HOSTS" json:"FT_HOSTS"`
+}
+
+func (c *fileTestConfig) SetBaseConfig(config *Config) {
+	c.Config = config
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestReadConfFile(t *testing.T) {
+	dir := t.TempDir()
+	keys := confKeys(&DefaultConfig, &fileTestConfig{})
+
+	writeFile(t, dir, "config.yaml", `
+callbackUrl: http://localhost/cb
+ft_hosts: [a:1, b:2]
+mq:
+  MQ_MODE: k
+  N_JS_MAX_DELIVER: 3
+ORG_DICT_JSON:
+  orgField:
+    zh: 企业
+`)
+	values, err := readConfFile(filepath.Join(dir, "config.yaml"), keys)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"FT_CALLBACK_URL":  "http://localhost/cb",
+		"FT_HOSTS":         "a:1,b:2",
+		"MQ_MODE":          "k",
+		"N_JS_MAX_DELIVER": "3",
+		"ORG_DICT_JSON":    `{"orgField":{"zh":"企业"}}`,
+	}, values)
+
+	writeFile(t, dir, "config.json", `{"MQ_MODE": "js", "N_JS_MAX_DELIVER": 1000000, "K_LOG": true}`)
+	values, err = readConfFile(filepath.Join(dir, "config.json"), keys)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"MQ_MODE": "js", "N_JS_MAX_DELIVER": "1000000", "K_LOG": "true"}, values)
+
+	writeFile(t, dir, "config.toml", "FT_HOSTS = [\"c:3\"]\n[redis]\nREDIS_INDEX = 2\n")
+	values, err = readConfFile(filepath.Join(dir, "config.toml"), keys)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"FT_HOSTS": "c:3", "REDIS_INDEX": "2"}, values)
+
+	writeFile(t, dir, "broken.json", `{"MQ_MODE": `)
+	_, err = readConfFile(filepath.Join(dir, "broken.json"), keys)
+	assert.NotNil(t, err)
+}
+
+func TestLoadConfFilesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	keys := confKeys(&DefaultConfig, &fileTestConfig{})
+	t.Setenv("FT_REAL", "real")
+	t.Setenv("FT_BASE", "")
+	t.Setenv("FT_ENV", "")
+	for _, k := range []string{"FT_BASE", "FT_ENV"} {
+		assert.Nil(t, os.Unsetenv(k))
+	}
+
+	// 保底文件不覆盖真实环境变量, 环境文件覆盖
+	writeFile(t, dir, "config.yaml", "FT_REAL: base\nFT_BASE: base\nFT_ENV: base\n")
+	writeFile(t, dir, "config.uat.toml", "FT_REAL = \"env\"\nFT_ENV = \"env\"\n")
+
+	assert.Nil(t, loadConfFiles(dir, "config", false, keys))
+	assert.Equal(t, "real", os.Getenv("FT_REAL"))
+	assert.Equal(t, "base", os.Getenv("FT_BASE"))
+
+	assert.Nil(t, loadConfFiles(dir, "config.uat", true, keys))
+	assert.Equal(t, "env", os.Getenv("FT_REAL"))
+	assert.Equal(t, "base", os.Getenv("FT_BASE"))
+	assert.Equal(t, "env", os.Getenv("FT_ENV"))
+}
+
+func TestLoadConfFilesMerge(t *testing.T) {
+	dir := t.TempDir()
+	keys := confKeys(&DefaultConfig, &fileTestConfig{})
+	for _, k := range []string{"FT_BASE", "FT_ENV", "FT_CONF"} {
+		t.Setenv(k, "")
+		assert.Nil(t, os.Unsetenv(k))
+	}
+
+	// 两级都是后面的格式覆盖前面的格式
+	writeFile(t, dir, "config.conf", "FT_BASE=conf\nFT_CONF=conf\n")
+	writeFile(t, dir, "config.json", `{"FT_BASE": "json"}`)
+	writeFile(t, dir, "config.uat.conf", "FT_ENV=conf\n")
+	writeFile(t, dir, "config.uat.toml", "FT_ENV = \"toml\"\n")
+
+	assert.Nil(t, loadConfFiles(dir, "config", false, keys))
+	assert.Equal(t, "json", os.Getenv("FT_BASE"))
+	assert.Equal(t, "conf", os.Getenv("FT_CONF"))
+	assert.Nil(t, loadConfFiles(dir, "config.uat", true, keys))
+	assert.Equal(t, "toml", os.Getenv("FT_ENV"))
+
+	// .conf 解析失败时返回错误
+	writeFile(t, dir, "broken.conf", "FT_BASE='unterminated\n")
+	assert.NotNil(t, loadConfFiles(dir, "broken", false, keys))
+}
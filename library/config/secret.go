@@ -0,0 +1,202 @@
+package fconfig
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// 加密的配置值格式为 ENC(sm4:{base64(nonce+密文)}), 使用SM4-GCM加密
+// 主密钥为16字节, 可以是32位hex或16位字符串, 从环境变量 CONFIG_MASTER_KEY 或 CONFIG_MASTER_KEY_FILE 指定的文件读取
+const (
+	EnvMasterKey     = "CONFIG_MASTER_KEY"
+	EnvMasterKeyFile = "CONFIG_MASTER_KEY_FILE"
+
+	encPrefix    = "ENC("
+	encSuffix    = ")"
+	encAlgorithm = "sm4:"
+)
+
+var ErrMasterKeyNotSet = errors.New("config master key not set, set " + EnvMasterKey + " or " + EnvMasterKeyFile)
+
+var (
+	masterKey     []byte
+	masterKeyErr  error
+	masterKeyOnce sync.Once
+)
+
+// IsEncrypted 是否为 ENC(...) 格式的加密值
+func IsEncrypted(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, encPrefix) && strings.HasSuffix(value, encSuffix)
+}
+
+// LoadMasterKey 优先读取 CONFIG_MASTER_KEY, 其次读取 CONFIG_MASTER_KEY_FILE 指定的文件
+func LoadMasterKey() ([]byte, error) {
+	if key := os.Getenv(EnvMasterKey); key != "" {
+		return ParseMasterKey(key)
+	}
+	if file := os.Getenv(EnvMasterKeyFile); file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "read config master key file error")
+		}
+		return ParseMasterKey(string(raw))
+	}
+	return nil, ErrMasterKeyNotSet
+}
+
+// ParseMasterKey 支持32位hex或16位字符串
+func ParseMasterKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if len(key) == 32 {
+		if raw, err := hex.DecodeString(key); err == nil {
+			return raw, nil
+		}
+	}
+	if len(key) == 16 {
+		return []byte(key), nil
+	}
+	return nil, errors.New("config master key must be 32 hex characters or 16 bytes")
+}
+
+// GenerateMasterKey 生成一个随机的主密钥, 返回hex格式
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptValue 将明文加密为 ENC(sm4:...) 格式
+func EncryptValue(plain string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encPrefix + encAlgorithm + base64.StdEncoding.EncodeToString(sealed) + encSuffix, nil
+}
+
+// DecryptValue 解密 ENC(sm4:...) 格式的值, 不是加密格式时原样返回
+func DecryptValue(value string, key []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	body := strings.TrimSpace(value)
+	body = body[len(encPrefix) : len(body)-len(encSuffix)]
+	if !strings.HasPrefix(body, encAlgorithm) {
+		return "", fmt.Errorf("unsupported encrypted config value, expect ENC(%s...)", encAlgorithm)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body, encAlgorithm))
+	if err != nil {
+		return "", errors.Wrap(err, "decode encrypted config value error")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted config value too short")
+	}
+	nonce, cipherText := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return "", errors.New("decrypt config value failed, wrong master key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+// Decrypt 使用 LoadMasterKey 的主密钥解密, 不是加密格式时原样返回, 不需要主密钥
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	masterKeyOnce.Do(func() {
+		masterKey, masterKeyErr = LoadMasterKey()
+	})
+	if masterKeyErr != nil {
+		return "", masterKeyErr
+	}
+	return DecryptValue(value, masterKey)
+}
+
+// decryptFields 解密配置结构体中所有 ENC(...) 格式的string和[]string字段
+func decryptFields(config interface{}) error {
+	var errs []string
+	var walk func(ref reflect.Value)
+	walk = func(ref reflect.Value) {
+		for ref.Kind() == reflect.Ptr {
+			if ref.IsNil() {
+				return
+			}
+			ref = ref.Elem()
+		}
+		if ref.Kind() != reflect.Struct {
+			return
+		}
+
+		refType := ref.Type()
+		for i := 0; i < ref.NumField(); i++ {
+			field, sf := ref.Field(i), refType.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+
+			switch field.Kind() {
+			case reflect.Struct, reflect.Ptr:
+				walk(field)
+			case reflect.String:
+				plain, err := Decrypt(field.String())
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", envName(sf), err))
+					continue
+				}
+				field.SetString(plain)
+			case reflect.Slice:
+				if field.Type().Elem().Kind() != reflect.String {
+					continue
+				}
+				for j := 0; j < field.Len(); j++ {
+					plain, err := Decrypt(field.Index(j).String())
+					if err != nil {
+						errs = append(errs, fmt.Sprintf("%s: %s", envName(sf), err))
+						break
+					}
+					field.Index(j).SetString(plain)
+				}
+			}
+		}
+	}
+	walk(reflect.ValueOf(config))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("decrypt config failed:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
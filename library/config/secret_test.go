@@ -0,0 +1,64 @@
+package fconfig
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptValue(t *testing.T) {
+	key, err := ParseMasterKey("00112233445566778899aabbccddeeff")
+	assert.Nil(t, err)
+
+	enc, err := EncryptValue("root:pwd@tcp(db:3306)/app", key)
+	assert.Nil(t, err)
+	assert.True(t, IsEncrypted(enc))
+	assert.True(t, strings.HasPrefix(enc, "ENC(sm4:"))
+
+	plain, err := DecryptValue(enc, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "root:pwd@tcp(db:3306)/app", plain)
+
+	// 不是加密格式时原样返回
+	plain, err = DecryptValue("plain", key)
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", plain)
+
+	otherKey, _ := ParseMasterKey("finclip9876cloud")
+	_, err = DecryptValue(enc, otherKey)
+	assert.NotNil(t, err)
+	_, err = DecryptValue("ENC(aes:xxx)", key)
+	assert.NotNil(t, err)
+	_, err = ParseMasterKey("short")
+	assert.NotNil(t, err)
+}
+
+func TestDecryptFields(t *testing.T) {
+	const hexKey = "00112233445566778899aabbccddeeff"
+	key, _ := ParseMasterKey(hexKey)
+	encPwd, _ := EncryptValue("pwd", key)
+	encHost, _ := EncryptValue("b:2", key)
+
+	masterKeyOnce = sync.Once{}
+	t.Setenv(EnvMasterKey, hexKey)
+	defer func() { masterKeyOnce = sync.Once{} }()
+
+	cfg := &fileTestConfig{Config: &Config{}, CallbackURL: "http://localhost", Hosts: []string{"a:1", encHost}}
+	cfg.RedisPassword = encPwd
+	assert.Nil(t, decryptFields(cfg))
+	assert.Equal(t, "pwd", cfg.RedisPassword)
+	assert.Equal(t, []string{"a:1", "b:2"}, cfg.Hosts)
+	assert.Equal(t, "http://localhost", cfg.CallbackURL)
+
+	// 主密钥不对时报告所有无法解密的配置
+	masterKeyOnce = sync.Once{}
+	t.Setenv(EnvMasterKey, "finclip9876cloud")
+	cfg = &fileTestConfig{Config: &Config{}, Hosts: []string{encHost}}
+	cfg.RedisPassword = encPwd
+	err := decryptFields(cfg)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "REDIS_PASSWORD")
+	assert.Contains(t, err.Error(), "FT_HOSTS")
+}
@@ -0,0 +1,47 @@
+package fconfig
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	current     atomic.Pointer[Config]
+	changeHooks []func(old, new *Config)
+	hookLock    sync.Mutex
+)
+
+// Current 返回最新配置的只读快照. 热更新时整体替换快照, 读取方不会看到更新了一半的配置
+// Init 之前返回 DefaultConfig 的副本
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := DefaultConfig
+	return &cfg
+}
+
+// OnChange 注册配置变更的回调, 在 Refresh 替换快照之后同步调用, 回调中不能修改配置
+func OnChange(hook func(old, new *Config)) {
+	hookLock.Lock()
+	defer hookLock.Unlock()
+	changeHooks = append(changeHooks, hook)
+}
+
+// Refresh 以 DefaultConfig 的当前值生成新的快照并通知 OnChange 的回调
+// 由配置的写入方(Init 和 registry 的热更新)在一次更新完成后调用
+func Refresh() {
+	next := DefaultConfig
+	old := current.Swap(&next)
+	if old == nil {
+		return
+	}
+
+	hookLock.Lock()
+	hooks := append([]func(old, new *Config){}, changeHooks...)
+	hookLock.Unlock()
+
+	for _, hook := range hooks {
+		hook(old, &next)
+	}
+}
@@ -0,0 +1,213 @@
+package fconfig
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// 配置使用 validate tag 声明校验规则, 例如 `validate:"required_if=MQMode k,hostport"`
+// 除了 validator 自带的 required, required_if, oneof, min, max, url 等之外, 还支持:
+//   - hostport: 逗号分隔的 host:port 列表
+//   - cidr:     逗号分隔的网段列表, 或者 * 表示不限制
+//   - cidrorip: 逗号分隔的网段或ip列表, 或者 * 表示不限制
+//   - port:     1-65535 的端口号
+//
+// 以上规则为空时不校验, 需要必填时配合 required 使用
+
+var (
+	configValidator     *validator.Validate
+	configValidatorOnce sync.Once
+)
+
+// ValidationError 汇总所有不合法的配置项
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config:\n  - %s", strings.Join(e.Violations, "\n  - "))
+}
+
+func getValidator() *validator.Validate {
+	configValidatorOnce.Do(func() {
+		v := validator.New()
+		v.RegisterTagNameFunc(envName)
+		_ = v.RegisterValidation("hostport", validateHostPort)
+		_ = v.RegisterValidation("cidr", validateCIDR)
+		_ = v.RegisterValidation("cidrorip", validateCIDROrIP)
+		_ = v.RegisterValidation("port", validatePort)
+		configValidator = v
+	})
+	return configValidator
+}
+
+// Validate 按 validate tag 校验配置, 返回的 *ValidationError 包含所有不合法的配置项
+func Validate(configs ...interface{}) error {
+	var violations []string
+	for _, cfg := range configs {
+		if cfg == nil {
+			continue
+		}
+
+		err := getValidator().Struct(cfg)
+		if err == nil {
+			continue
+		}
+		fieldErrs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			return err
+		}
+
+		names := fieldEnvNames(reflect.TypeOf(cfg))
+		for _, fieldErr := range fieldErrs {
+			violations = append(violations, violationMessage(fieldErr, names))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// envName 错误信息中使用环境变量名称
+func envName(field reflect.StructField) string {
+	for _, tag := range []string{"env", "json"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// fieldEnvNames 字段名到环境变量名称的映射, 用于 required_if 等引用其他字段的规则
+func fieldEnvNames(t reflect.Type) map[string]string {
+	names := make(map[string]string)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				walk(field.Type)
+				continue
+			}
+			names[field.Name] = envName(field)
+		}
+	}
+	walk(t)
+	return names
+}
+
+func violationMessage(fieldErr validator.FieldError, names map[string]string) string {
+	field, param := fieldErr.Field(), fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "required_if":
+		var conds []string
+		parts := strings.Fields(param)
+		for i := 0; i+1 < len(parts); i += 2 {
+			name := parts[i]
+			if envName, ok := names[name]; ok {
+				name = envName
+			}
+			conds = append(conds, name+"="+parts[i+1])
+		}
+		return fmt.Sprintf("%s is required when %s", field, strings.Join(conds, " and "))
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s], got %q", field, param, fmt.Sprint(fieldErr.Value()))
+	case "min":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", field, param)
+		}
+		return fmt.Sprintf("%s must be >= %s, got %v", field, param, fieldErr.Value())
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters", field, param)
+		}
+		return fmt.Sprintf("%s must be <= %s, got %v", field, param, fieldErr.Value())
+	case "url":
+		return fmt.Sprintf("%s must be a valid url", field)
+	case "hostport":
+		return fmt.Sprintf("%s must be comma separated host:port, got %q", field, fmt.Sprint(fieldErr.Value()))
+	case "cidr":
+		return fmt.Sprintf("%s must be * or comma separated CIDRs, got %q", field, fmt.Sprint(fieldErr.Value()))
+	case "cidrorip":
+		return fmt.Sprintf("%s must be * or comma separated CIDRs or IPs, got %q", field, fmt.Sprint(fieldErr.Value()))
+	case "port":
+		return fmt.Sprintf("%s must be a port between 1 and 65535, got %q", field, fmt.Sprint(fieldErr.Value()))
+	}
+	return fmt.Sprintf("%s failed on rule %s", field, fieldErr.ActualTag())
+}
+
+func validateHostPort(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" {
+		return true
+	}
+	for _, addr := range strings.Split(value, ",") {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(addr))
+		if err != nil || host == "" || !isPort(port) {
+			return false
+		}
+	}
+	return true
+}
+
+func validateCIDR(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" || value == "*" {
+		return true
+	}
+	for _, cidr := range strings.Split(value, ",") {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func validateCIDROrIP(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" || value == "*" {
+		return true
+	}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if net.ParseIP(v) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePort(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	switch field.Kind() {
+	case reflect.String:
+		return field.String() == "" || isPort(field.String())
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return isPort(fmt.Sprint(field.Interface()))
+	}
+	return false
+}
+
+func isPort(s string) bool {
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port <= 65535
+}
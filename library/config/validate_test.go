@@ -0,0 +1,76 @@
+package fconfig
+
+import (
+	"testing"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCustomConfig struct {
+	*Config
+	CallbackURL string `env:"CALLBACK_URL" envDefault:"http://localhost/cb" validate:"required,url"`
+	Workers     int    `env:"WORKERS" envDefault:"4" validate:"min=1,max=64"`
+}
+
+func (c *testCustomConfig) SetBaseConfig(config *Config) {
+	c.Config = config
+}
+
+func TestValidateDefaults(t *testing.T) {
+	var cfg Config
+	assert.Nil(t, env.Parse(&cfg))
+	custom := &testCustomConfig{}
+	assert.Nil(t, env.Parse(custom))
+	assert.Nil(t, Validate(&cfg, custom))
+}
+
+func TestValidateAggregated(t *testing.T) {
+	var cfg Config
+	assert.Nil(t, env.Parse(&cfg))
+	cfg.StorageMode = "ftp"
+	cfg.MQMode = "k"
+	cfg.KAddr = ""
+	cfg.HTTPPort = "80800"
+	cfg.XForwardedForAllowNetCIDR = "10.0.0.0/8,10.1.1.1"
+	cfg.TrustedProxiesCIDR = "10.0.0.0/8, 10.1.1.1, gateway"
+	cfg.RedisMode = REDIS_MODE_SENTINEL
+	cfg.RedisSentinelAddr = "sentinel"
+	cfg.CdnCachePushOpen = true
+
+	custom := &testCustomConfig{CallbackURL: "not a url", Workers: 0}
+	err := Validate(&cfg, custom)
+	validationErr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, []string{
+		`HTTP_PORT must be a port between 1 and 65535, got "80800"`,
+		`STORAGE_MODE must be one of [minio ali_oss aws_s3 tencent_cos disk], got "ftp"`,
+		`REDIS_SENTINEL_ADDR must be comma separated host:port, got "sentinel"`,
+		`REDIS_MASTER_NAME is required when REDIS_MODE=sentinel`,
+		`K_ADDR is required when MQ_MODE=k`,
+		`X_FORWARDED_FOR_ALLOW_NET_CIDR must be * or comma separated CIDRs, got "10.0.0.0/8,10.1.1.1"`,
+		`TRUSTED_PROXIES_CIDR must be * or comma separated CIDRs or IPs, got "10.0.0.0/8, 10.1.1.1, gateway"`,
+		`CDN_CACHE_PUSH_MODE is required when CDN_CACHE_PUSH_OPEN=true`,
+		`CALLBACK_URL must be a valid url`,
+		`WORKERS must be >= 1, got 0`,
+	}, validationErr.Violations)
+
+	// 条件不满足时不要求必填
+	cfg = Config{}
+	assert.Nil(t, env.Parse(&cfg))
+	cfg.MQMode = "n"
+	cfg.KAddr = ""
+	cfg.CdnCachePushMode = ""
+	assert.Nil(t, Validate(&cfg))
+}
+
+func TestInitDerivedFieldsTrim(t *testing.T) {
+	var cfg Config
+	cfg.XForwardedForAllowNetCIDR = "10.0.0.0/8, 192.168.0.0/16"
+	cfg.TrustedProxiesCIDR = "10.0.0.0/8, 10.1.1.1"
+	assert.Nil(t, Validate(&cfg.HttpSecurityConfig))
+	assert.Nil(t, InitDerivedFields(&cfg))
+	assert.Len(t, cfg.XForwardedForAllowNetCIDRArr, 2)
+	assert.Equal(t, "192.168.0.0/16", cfg.XForwardedForAllowNetCIDRArr[1].String())
+	assert.Equal(t, []string{"10.0.0.0/8", "10.1.1.1"}, cfg.TrustedProxiesCIDRArr)
+}
@@ -120,6 +120,27 @@ func PastCallerFromContext(ctx context.Context) string {
 	return pastCaller
 }
 
+// MergePastCaller 将当前调用方追加到调用链中, 用于继续向下游传递
+func MergePastCaller(ctx context.Context) string {
+	pastArr := strings.Split(PastCallerFromContext(ctx), ",")
+
+	currentCallerObj := ctx.Value(HeaderCaller)
+	currentCaller, ok := currentCallerObj.(string)
+	if ok {
+		pastArr = append(pastArr, currentCaller)
+	}
+
+	trimmedArr := make([]string, 0, len(pastArr))
+	for _, v := range pastArr {
+		if v == "" {
+			continue
+		}
+		trimmedArr = append(trimmedArr, v)
+	}
+
+	return strings.Join(trimmedArr, ",")
+}
+
 func AuthorizationFromContext(ctx context.Context) string {
 	authObj := ctx.Value(HeaderAuthorization)
 	if authObj == nil {
@@ -1,10 +1,12 @@
 package fgorm
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lzw5399/go-common-public/library/database/gorm/plugin"
 	dbmodel "github.com/lzw5399/go-common-public/library/database/model"
+	"github.com/lzw5399/go-common-public/library/health"
 	"github.com/lzw5399/go-common-public/library/log"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
@@ -15,6 +17,20 @@ import (
 
 var DB *gorm.DB
 
+// HealthCheck ping数据库, 用于 health.Register
+func HealthCheck() health.Checker {
+	return func(ctx context.Context) error {
+		if DB == nil {
+			return errors.New("db not initialized")
+		}
+		sqlDB, err := DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
 func StartBase(initDbFunc func(config *gorm.Config) (*gorm.DB, error), options ...dbmodel.DBOptionFunc) {
 	option := dbmodel.MergeDBOption(options...)
 
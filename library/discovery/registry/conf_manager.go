@@ -1,119 +1,155 @@
 package registry
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/hashicorp/consul/api"
-	"github.com/hashicorp/consul/api/watch"
+	fconfig "github.com/lzw5399/go-common-public/library/config"
 )
 
 const KV_PUBLIC_NAME = "public"
 
+// RegistryConfManager 从远程配置源读取配置并监听变化, 配置源可以是consul、etcd或者目录
 type RegistryConfManager struct {
-	registryKVClient *api.KV
-	config           interface{} // 调用方的config对象指针, 缓存供watch使用
-	started          bool
-	lastValues       sync.Map // 缓存最新的值
-	path             string
-	address          string
+	source     confSource
+	config     interface{} // 调用方的config对象指针, 缓存供watch使用
+	started    bool
+	lastValues sync.Map // 缓存最新的值
+}
+
+// newConfManager 使用指定的配置源, 调用 Init 之后才能使用
+func newConfManager(source confSource) *RegistryConfManager {
+	return &RegistryConfManager{source: source}
 }
 
 func (c *RegistryConfManager) IsKeyLower() bool {
 	return false
 }
 
+// InitFromRegistry 使用consul kv中path的json作为配置源
 func (c *RegistryConfManager) InitFromRegistry(config interface{}, addr, path string) error {
-	c.address = addr
-	c.path = path
-	c.config = config
 	if strings.TrimSpace(path) == "" {
 		return fmt.Errorf("path is empty")
 	}
-	client, err := api.NewClient(&api.Config{Address: addr})
+	source, err := newConsulSource(addr, path)
 	if err != nil {
 		return err
 	}
-	c.registryKVClient = client.KV()
-	pair, _, err := c.registryKVClient.Get(path, nil)
-	if err != nil {
-		return err
-	}
-	if pair == nil {
-		// 如果未找到, 初始化一个空json对象
-		// 否则, 后面的监听会失败
-		pair = &api.KVPair{Key: path, Value: []byte("{}")}
-		_, err = c.registryKVClient.Put(pair, nil)
-		if err != nil {
-			fmt.Printf("[remote-conf] put err: %v\n", err)
-			return err
-		}
+	c.source = source
+	return c.Init(config)
+}
+
+// Init 读取配置源的全部配置并应用到config
+func (c *RegistryConfManager) Init(config interface{}) error {
+	if c.source == nil {
+		return fmt.Errorf("RegistryConfManager source is nil")
 	}
-	newValues := make(map[string]interface{})
-	err = json.Unmarshal(pair.Value, &newValues)
+	c.config = config
+
+	newValues, err := c.source.Load()
 	if err != nil {
 		return err
 	}
 	for k, newValue := range newValues {
+		// 加密的值无法解密时直接报错, 避免使用密文启动
+		if _, err := fconfig.Decrypt(remoteValueString(newValue)); err != nil {
+			return fmt.Errorf("decrypt remote config [%v] err: %v", k, err)
+		}
 		c.lastValues.Store(k, newValue)
 	}
-	fmt.Printf("[remote-conf] path: %v ,allkeys: %v\n", path, c.GetAllKeys())
-	err = applyRemoteConfigForJson(c.config, c)
+	fmt.Printf("[remote-conf] source: %v ,allkeys: %v\n", c.source, c.GetAllKeys())
+	err = applyRemoteConfig(c.config, c)
 	if err != nil {
 		return err
 	}
+	storeSnapshot(c.config)
 	return nil
-
 }
 
 func (c *RegistryConfManager) StartWatch() error {
-	if c.path == "" {
+	if c.config == nil {
 		return fmt.Errorf("RegistryConfManager should init first!")
 	}
 	if c.started {
 		return fmt.Errorf("RegistryConfManager started!")
 	}
 	c.started = true
-	params := map[string]interface{}{"type": "key", "key": c.path}
-	plan, err := watch.Parse(params)
-	plan.Handler = func(idx uint64, raw interface{}) {
-		var v *api.KVPair
-		if raw == nil { // nil is a valid return value
-			v = nil
+	go func() {
+		if err := c.source.Watch(c.onValues); err != nil {
+			fmt.Printf("[remote-conf] error: watch %v err: %v\n", c.source, err)
+		}
+	}()
+	return nil
+}
+
+// applyLock 多个配置源共用同一个config, 从复制到替换的过程互斥, 避免互相覆盖
+var applyLock sync.Mutex
+
+// onValues 配置源变化时回调全部配置, 只应用有变化的配置项, 删除的配置项忽略
+// 变更和派生字段都在副本上计算, 完成后一次性替换到config, 读取方不会看到只更新了一部分的配置
+func (c *RegistryConfManager) onValues(newValues map[string]interface{}) {
+	applyLock.Lock()
+	defer applyLock.Unlock()
+
+	next := copyConfig(c.config)
+	if next == nil {
+		fmt.Printf("[remote-conf] error: copy config %T failed, skip update\n", c.config)
+		return
+	}
+
+	var changes []Change
+	for k, newValue := range newValues {
+		oldValue, ok := c.lastValues.Load(k)
+		if ok && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		// 无法解密时保留旧值, 下次变更时重试
+		plain, decryptErr := fconfig.Decrypt(remoteValueString(newValue))
+		if decryptErr != nil {
+			fmt.Printf("[remote-conf] error: decrypt config [%v] err: %v\n", k, decryptErr)
+			continue
+		}
+		c.lastValues.Store(k, newValue)
+		err := update(next, strings.ToUpper(k), plain)
+		if err != nil && !errors.Is(err, errUnknownKey) {
+			fmt.Printf("[remote-conf] error: update config err: %v\n", err)
+			continue
 		} else {
-			var ok bool
-			if v, ok = raw.(*api.KVPair); !ok {
-				return // ignore
-			}
-			newValues := make(map[string]interface{})
-			err = json.Unmarshal(v.Value, &newValues)
-			// 删除的配置项忽略
-			for k, newValue := range newValues {
-				oldValue, ok := c.lastValues.Load(k)
-				if ok && oldValue == newValue {
-					continue
-				}
-				c.lastValues.Store(k, newValue)
-				err = updateForJson(c.config, strings.ToUpper(k), fmt.Sprintf("%v", newValues[k]))
-				if err != nil {
-					fmt.Printf("[remote-conf] error: update config err: %v\n", err)
-					continue
-				} else {
-					fmt.Printf("[remote-conf] update config success [%v]: %v -> %v\n", k, oldValue, newValue)
-				}
+			// 不认识的配置项不写入config, 仍然通知 OnChange 的订阅方
+			// 日志中输出的是原始值, 加密的配置不会明文打印
+			fmt.Printf("[remote-conf] update config success [%v]: %v -> %v\n", k, oldValue, newValue)
+			change := Change{Key: strings.ToUpper(k), New: plain}
+			if oldValue != nil {
+				change.Old, _ = fconfig.Decrypt(remoteValueString(oldValue))
 			}
+			changes = append(changes, change)
 		}
 	}
-	go plan.Run(c.address)
-	return nil
+
+	// 一次watch的所有变更应用完之后再替换config、快照和通知订阅方
+	if len(changes) > 0 {
+		if err := initDerivedFields(next); err != nil {
+			fmt.Printf("[remote-conf] error: init derived fields err: %v\n", err)
+		}
+		commitConfig(c.config, next)
+		publishChanges(c.config, changes)
+	}
 }
 
-// Get 统一返回字符串, 后续单独处理
+// Get 统一返回字符串, 后续单独处理. ENC(...) 格式的值返回解密后的明文
 func (c *RegistryConfManager) Get(key string) string {
 	if value, ok := c.lastValues.Load(key); ok {
-		return fmt.Sprintf("%v", value)
+		plain, err := fconfig.Decrypt(remoteValueString(value))
+		if err != nil {
+			fmt.Printf("[remote-conf] error: decrypt config [%v] err: %v\n", key, err)
+			return ""
+		}
+		return plain
 	} else {
 		return ""
 	}
@@ -131,40 +167,73 @@ func (c *RegistryConfManager) GetAllKeys() []string {
 // StartRegistryConfig 供客户端使用的标准方法
 // 1. 初始化公共配置
 // 2. 初始化服务私有配置并监听
-// config必须是一个指针
+// config必须是一个指针. 配置源由 REGISTRY_CONFIG_MODE 选择:
+//   - consul: addr的consul kv中 {kvPath}/public 和 {kvPath}/{serverName} 的json
+//   - etcd:   REGISTRY_ETCD_ENDPOINTS 中 {kvPath}/public 和 {kvPath}/{serverName} 的json
+//   - dir:    REGISTRY_CONFIG_DIR 下 public 和 {serverName} 两个目录, 每个文件是一个配置项, 适用于挂载k8s的ConfigMap
 func StartRegistryConfig(config interface{}, kvPath, serverName, addr string) error {
-	if strings.TrimSpace(addr) == "" {
-		return fmt.Errorf("registry addr is empty!")
-	}
-	if strings.TrimSpace(kvPath) == "" {
-		return fmt.Errorf("kvPath is empty!")
-	}
 	if strings.TrimSpace(serverName) == "" {
 		return fmt.Errorf("serverName is empty!")
 	}
-	remoteAddr := addr
-	publicKeyPath := fmt.Sprintf("%s/%s", kvPath, KV_PUBLIC_NAME)
-	privateKeyPath := fmt.Sprintf("%s/%s", kvPath, serverName)
-	// 优先级 服务配置 > 公共配置 > 环境变量 > 代码中的默认值
-	{
-		registryConf := &RegistryConfManager{}
-		if err := registryConf.InitFromRegistry(config, remoteAddr, publicKeyPath); err != nil {
-			fmt.Printf("read config from registry [%v] [%v] fail: %v\n", remoteAddr, publicKeyPath, err)
+
+	cfg := &fconfig.DefaultConfig
+	var newSource func(scope string) (confSource, error)
+	switch cfg.RegistryConfigMode {
+	case "", "consul":
+		if strings.TrimSpace(addr) == "" {
+			return fmt.Errorf("registry addr is empty!")
+		}
+		if strings.TrimSpace(kvPath) == "" {
+			return fmt.Errorf("kvPath is empty!")
+		}
+		newSource = func(scope string) (confSource, error) {
+			return newConsulSource(addr, fmt.Sprintf("%s/%s", kvPath, scope))
+		}
+	case "etcd":
+		if strings.TrimSpace(kvPath) == "" {
+			return fmt.Errorf("kvPath is empty!")
+		}
+		client, err := newEtcdClient(cfg)
+		if err != nil {
 			return err
 		}
+		newSource = func(scope string) (confSource, error) {
+			return newEtcdSource(client, fmt.Sprintf("%s/%s", kvPath, scope)), nil
+		}
+	case "dir":
+		if strings.TrimSpace(cfg.RegistryConfigDir) == "" {
+			return fmt.Errorf("REGISTRY_CONFIG_DIR is empty!")
+		}
+		interval := time.Duration(cfg.RegistryConfigDirPollSeconds) * time.Second
+		newSource = func(scope string) (confSource, error) {
+			return newDirSource(filepath.Join(cfg.RegistryConfigDir, scope), interval), nil
+		}
+	default:
+		return fmt.Errorf("unsupported REGISTRY_CONFIG_MODE: %s", cfg.RegistryConfigMode)
 	}
-	{
-		registryConf := &RegistryConfManager{}
-		if err := registryConf.InitFromRegistry(config, remoteAddr, privateKeyPath); err != nil {
-			fmt.Printf("read config from registry [%v] [%v] fail: %v\n", remoteAddr, privateKeyPath, err)
+
+	// 优先级 服务配置 > 公共配置 > 环境变量 > 代码中的默认值
+	var privateConf *RegistryConfManager
+	for _, scope := range []string{KV_PUBLIC_NAME, serverName} {
+		source, err := newSource(scope)
+		if err != nil {
 			return err
 		}
-		if err := registryConf.StartWatch(); err != nil {
-			fmt.Printf("config watch fail [%v] [%v] fail: %v\n", remoteAddr, privateKeyPath, err)
+		registryConf := newConfManager(source)
+		if err := registryConf.Init(config); err != nil {
+			fmt.Printf("read config from registry [%v] fail: %v\n", source, err)
 			return err
 		}
+		privateConf = registryConf
 	}
+	if err := privateConf.StartWatch(); err != nil {
+		fmt.Printf("config watch fail [%v] fail: %v\n", privateConf.source, err)
+		return err
+	}
+
+	// 远程配置生效后更新 fconfig.Current 的快照
+	fconfig.Refresh()
 
-	fmt.Printf("config watch success [%v] [%v] \n", remoteAddr, privateKeyPath)
+	fmt.Printf("config watch success [%v] \n", privateConf.source)
 	return nil
 }
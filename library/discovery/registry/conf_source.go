@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/api/watch"
+)
+
+// confSource 远程配置源, 配置以 key -> value 的形式返回
+type confSource interface {
+	// Load 读取全部配置
+	Load() (map[string]interface{}, error)
+	// Watch 阻塞监听配置变化, 每次变化回调全部配置
+	Watch(onChange func(map[string]interface{})) error
+	String() string
+}
+
+// consulSource consul kv 中一个key的json对象
+type consulSource struct {
+	address string
+	path    string
+	kv      *api.KV
+}
+
+func newConsulSource(addr, path string) (*consulSource, error) {
+	client, err := api.NewClient(&api.Config{Address: addr})
+	if err != nil {
+		return nil, err
+	}
+	return &consulSource{address: addr, path: path, kv: client.KV()}, nil
+}
+
+func (s *consulSource) Load() (map[string]interface{}, error) {
+	pair, _, err := s.kv.Get(s.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		// 如果未找到, 初始化一个空json对象
+		// 否则, 后面的监听会失败
+		pair = &api.KVPair{Key: s.path, Value: []byte("{}")}
+		_, err = s.kv.Put(pair, nil)
+		if err != nil {
+			fmt.Printf("[remote-conf] put err: %v\n", err)
+			return nil, err
+		}
+	}
+	newValues := make(map[string]interface{})
+	err = json.Unmarshal(pair.Value, &newValues)
+	if err != nil {
+		return nil, err
+	}
+	return newValues, nil
+}
+
+func (s *consulSource) Watch(onChange func(map[string]interface{})) error {
+	params := map[string]interface{}{"type": "key", "key": s.path}
+	plan, err := watch.Parse(params)
+	if err != nil {
+		return err
+	}
+	plan.Handler = func(idx uint64, raw interface{}) {
+		v, ok := raw.(*api.KVPair)
+		if !ok || v == nil {
+			return // ignore
+		}
+		newValues := make(map[string]interface{})
+		if err := json.Unmarshal(v.Value, &newValues); err != nil {
+			fmt.Printf("[remote-conf] error: unmarshal %v err: %v\n", s.path, err)
+			return
+		}
+		onChange(newValues)
+	}
+	return plan.Run(s.address)
+}
+
+func (s *consulSource) String() string {
+	return "consul://" + s.address + "/" + s.path
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// dirSource 目录中每个文件是一个配置项, 文件名为key, 内容为value, 适用于挂载k8s的ConfigMap/Secret
+// 隐藏文件和ConfigMap的 ..data 等链接会被忽略, 目录不存在时视为空配置
+type dirSource struct {
+	dir      string
+	interval time.Duration
+}
+
+// NewDirConfManager 使用目录作为配置源, interval为轮询间隔
+func NewDirConfManager(dir string, interval time.Duration) *RegistryConfManager {
+	return newConfManager(newDirSource(dir, interval))
+}
+
+func newDirSource(dir string, interval time.Duration) *dirSource {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &dirSource{dir: dir, interval: interval}
+}
+
+func (s *dirSource) Load() (map[string]interface{}, error) {
+	newValues := make(map[string]interface{})
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return newValues, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(s.dir, entry.Name())
+		// ConfigMap中的文件是指向 ..data 的软链接, 需要跟随链接判断
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		newValues[entry.Name()] = strings.TrimSpace(string(raw))
+	}
+	return newValues, nil
+}
+
+func (s *dirSource) Watch(onChange func(map[string]interface{})) error {
+	// 第一次轮询总是回调, 由 RegistryConfManager 和 Init 时读取的值比较, 避免丢失中间的变化
+	var lastValues map[string]interface{}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		newValues, err := s.Load()
+		if err != nil || reflect.DeepEqual(lastValues, newValues) {
+			continue
+		}
+		lastValues = newValues
+		onChange(newValues)
+	}
+	return nil
+}
+
+func (s *dirSource) String() string {
+	return "dir://" + s.dir
+}
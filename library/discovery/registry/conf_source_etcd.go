@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+// etcdSource etcd 中一个key的json对象, 格式与consul一致
+type etcdSource struct {
+	client   *clientv3.Client
+	path     string
+	revision atomic.Int64 // 最近一次 Load 或者watch到的revision, watch从下一个revision开始, 不会漏掉两者之间的变更
+}
+
+func newEtcdClient(cfg *fconfig.Config) (*clientv3.Client, error) {
+	var endpoints []string
+	for _, endpoint := range strings.Split(cfg.RegistryEtcdEndpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		Username:    cfg.RegistryEtcdUser,
+		Password:    cfg.RegistryEtcdPassword,
+		DialTimeout: 5 * time.Second,
+	})
+}
+
+// NewEtcdConfManager 使用etcd中path的json作为配置源
+func NewEtcdConfManager(client *clientv3.Client, path string) *RegistryConfManager {
+	return newConfManager(newEtcdSource(client, path))
+}
+
+func newEtcdSource(client *clientv3.Client, path string) *etcdSource {
+	return &etcdSource{client: client, path: path}
+}
+
+func (s *etcdSource) Load() (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := s.client.Get(ctx, s.path)
+	if err != nil {
+		return nil, err
+	}
+	newValues := make(map[string]interface{})
+	if len(resp.Kvs) > 0 {
+		if err = json.Unmarshal(resp.Kvs[0].Value, &newValues); err != nil {
+			return nil, err
+		}
+	}
+	s.revision.Store(resp.Header.Revision)
+	return newValues, nil
+}
+
+// Watch 从 Load 的revision之后开始监听. watch出错(比如revision已经被compact)或者被关闭时, 重新 Load 全部配置再监听
+// 只有client关闭时才返回
+func (s *etcdSource) Watch(onChange func(map[string]interface{})) error {
+	for s.client.Ctx().Err() == nil {
+		if s.revision.Load() == 0 {
+			newValues, err := s.Load()
+			if err != nil {
+				fmt.Printf("[remote-conf] error: reload %v err: %v\n", s, err)
+				time.Sleep(time.Second)
+				continue
+			}
+			onChange(newValues)
+		}
+
+		s.watch(onChange)
+		// 下次循环重新 Load, 间隔1秒避免etcd不可用时空转
+		s.revision.Store(0)
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("etcd watch %v closed", s.path)
+}
+
+func (s *etcdSource) watch(onChange func(map[string]interface{})) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchCh := s.client.Watch(clientv3.WithRequireLeader(ctx), s.path, clientv3.WithRev(s.revision.Load()+1))
+	for resp := range watchCh {
+		if err := resp.Err(); err != nil {
+			fmt.Printf("[remote-conf] error: watch %v err: %v, reload\n", s, err)
+			return
+		}
+		for _, event := range resp.Events {
+			s.revision.Store(event.Kv.ModRevision)
+			// 删除的配置项忽略
+			if event.Type != clientv3.EventTypePut {
+				continue
+			}
+			newValues := make(map[string]interface{})
+			if err := json.Unmarshal(event.Kv.Value, &newValues); err != nil {
+				fmt.Printf("[remote-conf] error: unmarshal %v err: %v\n", s, err)
+				continue
+			}
+			onChange(newValues)
+		}
+	}
+	fmt.Printf("[remote-conf] error: watch %v closed, reload\n", s)
+}
+
+func (s *etcdSource) String() string {
+	return "etcd://" + strings.Join(s.client.Endpoints(), ",") + "/" + s.path
+}
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+func TestDirConfManager(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "WORKERS"), []byte("2\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0644))
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "..data"), 0755))
+
+	cfg := &testConfig{Config: &fconfig.Config{}, Workers: 1}
+	manager := NewDirConfManager(dir, 10*time.Millisecond)
+	assert.Nil(t, manager.Init(cfg))
+	assert.Equal(t, 2, cfg.Workers)
+	assert.Equal(t, []string{"WORKERS"}, manager.GetAllKeys())
+
+	changed := make(chan Change, 1)
+	OnChange(func(changes []Change) {
+		select {
+		case changed <- changes[0]:
+		default:
+		}
+	}, "WORKERS")
+	assert.Nil(t, manager.StartWatch())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "WORKERS"), []byte("8"), 0644))
+
+	select {
+	case change := <-changed:
+		assert.Equal(t, Change{Key: "WORKERS", Old: "2", New: "8"}, change)
+		assert.Equal(t, 8, cfg.Workers)
+	case <-time.After(2 * time.Second):
+		t.Fatal("dir change not applied")
+	}
+}
+
+func TestDirSourceNotExist(t *testing.T) {
+	values, err := newDirSource(filepath.Join(t.TempDir(), "missing"), 0).Load()
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+}
+
+func TestDirConfManagerNotPrintSecret(t *testing.T) {
+	const hexKey = "00112233445566778899aabbccddeeff"
+	key, _ := fconfig.ParseMasterKey(hexKey)
+	encPwd, err := fconfig.EncryptValue("s3cret-pwd", key)
+	assert.Nil(t, err)
+	t.Setenv(fconfig.EnvMasterKey, hexKey)
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "REDIS_PASSWORD"), []byte(encPwd), 0644))
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	os.Stdout = w
+	cfg := &testConfig{Config: &fconfig.Config{}}
+	initErr := NewDirConfManager(dir, time.Second).Init(cfg)
+	os.Stdout = stdout
+	assert.Nil(t, w.Close())
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+
+	assert.Nil(t, initErr)
+	assert.Equal(t, "s3cret-pwd", cfg.RedisPassword)
+	assert.Contains(t, string(out), "REDIS_PASSWORD")
+	assert.NotContains(t, string(out), "s3cret-pwd")
+}
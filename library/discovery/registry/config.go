@@ -5,16 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/bitly/go-simplejson"
+	fconfig "github.com/lzw5399/go-common-public/library/config"
 )
 
-var filedIndexes = map[string]int{}
-var originRemoteKeys = map[string]bool{}
-
 type ParserFunc func(v string) (interface{}, error)
 
 type RemoteConfServer interface {
@@ -25,6 +25,7 @@ type RemoteConfServer interface {
 
 var (
 	ErrNotAStructPtr = errors.New("env: expected a pointer to a Struct")
+	errUnknownKey    = errors.New("unrecognize config")
 
 	defaultBuiltInParsers = map[reflect.Kind]ParserFunc{
 		reflect.Bool: func(v string) (interface{}, error) {
@@ -82,57 +83,237 @@ var (
 	}
 )
 
-// applyRemoteConfig
+// 按类型解析的字段, 优先于按Kind解析
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+	ipNetType    = reflect.TypeOf(net.IPNet{})
+	baseType     = reflect.TypeOf(fconfig.Config{})
+
+	typeParsers = map[reflect.Type]ParserFunc{
+		durationType: func(v string) (interface{}, error) {
+			return time.ParseDuration(v)
+		},
+		urlType: func(v string) (interface{}, error) {
+			u, err := url.Parse(v)
+			if err != nil {
+				return nil, err
+			}
+			return *u, nil
+		},
+		ipNetType: func(v string) (interface{}, error) {
+			_, ipNet, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, err
+			}
+			return *ipNet, nil
+		},
+	}
+)
+
+// applyRemoteConfig 将远程配置中已设置的配置项写入config, 其他的忽略
 func applyRemoteConfig(config interface{}, remoteServer RemoteConfServer) error {
+	fields, err := configFields(config)
+	if err != nil {
+		return err
+	}
+	for _, remoteKey := range remoteServer.GetAllKeys() {
+		field, ok := fields[strings.ToUpper(remoteKey)]
+		if !ok {
+			continue
+		}
+		value := remoteServer.Get(remoteKey)
+		if err := set(field.value, field.sf, value); err != nil {
+			return err
+		}
+		// Get 返回的是解密后的明文, 日志中只输出配置项名称
+		fmt.Printf("[remote-conf] set key [%v]\n", remoteKey)
+	}
+	return initDerivedFields(config)
+}
+
+// update 更新单个配置项, 不认识的配置项返回 errUnknownKey
+func update(config interface{}, key, value string) error {
+	fields, err := configFields(config)
+	if err != nil {
+		return err
+	}
+	field, ok := fields[strings.ToUpper(key)]
+	if !ok {
+		return fmt.Errorf("handle OnUpdate:[%v]:[%v] ignore, %w", key, value, errUnknownKey)
+	}
+	return set(field.value, field.sf, value)
+}
+
+type configField struct {
+	value reflect.Value
+	sf    reflect.StructField
+}
+
+// configFields 收集config中所有带env tag的字段, 递归嵌入的结构体(例如 *fconfig.Config)
+// key为大写的env tag和json tag
+func configFields(config interface{}) (map[string]configField, error) {
 	ptrRef := reflect.ValueOf(config)
-	if ptrRef.Kind() != reflect.Ptr {
-		return ErrNotAStructPtr
+	if ptrRef.Kind() != reflect.Ptr || ptrRef.IsNil() {
+		return nil, ErrNotAStructPtr
 	}
 	ref := ptrRef.Elem()
 	if ref.Kind() != reflect.Struct {
-		return ErrNotAStructPtr
-	}
-	// 清空
-	originRemoteKeys = make(map[string]bool)
-	remoteKeys := remoteServer.GetAllKeys()
-	for i := 0; i < len(remoteKeys); i++ {
-		key := remoteKeys[i]
-		originRemoteKeys[key] = true
-	}
-	var refType = ref.Type()
-	for i := 0; i < refType.NumField(); i++ {
-		refField := ref.Field(i)
-		if !refField.CanSet() {
-			continue
+		return nil, ErrNotAStructPtr
+	}
+
+	fields := make(map[string]configField)
+	var walk func(ref reflect.Value) error
+	walk = func(ref reflect.Value) error {
+		refType := ref.Type()
+		for i := 0; i < refType.NumField(); i++ {
+			refField := ref.Field(i)
+			refTypeField := refType.Field(i)
+			if !refField.CanSet() {
+				continue
+			}
+			if refTypeField.Anonymous && refTypeField.Tag.Get("env") == "" {
+				if refField.Kind() == reflect.Ptr {
+					if refField.IsNil() || refField.Elem().Kind() != reflect.Struct {
+						continue
+					}
+					refField = refField.Elem()
+				}
+				if refField.Kind() == reflect.Struct {
+					if err := walk(refField); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			// 从环境变量的env tag中取出key, 一定是大写. 只有json tag的字段也可以远程配置
+			key, err := getKey(refTypeField)
+			if err != nil {
+				return err
+			}
+			jsonKey := strings.Split(refTypeField.Tag.Get("json"), ",")[0]
+			if jsonKey == "-" {
+				jsonKey = ""
+			}
+			if key == "" && jsonKey == "" {
+				continue
+			}
+			field := configField{value: refField, sf: refTypeField}
+			if key != "" {
+				fields[key] = field
+			}
+			if jsonKey != "" {
+				fields[strings.ToUpper(jsonKey)] = field
+			}
 		}
-		if reflect.Ptr == refField.Kind() && !refField.IsNil() {
+		return nil
+	}
+	if err := walk(ref); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// initDerivedFields 重新计算config中fconfig.Config的派生字段
+func initDerivedFields(config interface{}) error {
+	if base := findBaseConfig(reflect.ValueOf(config)); base != nil {
+		return fconfig.InitDerivedFields(base)
+	}
+	return nil
+}
+
+// copyConfig 复制config, 其中嵌入的 *fconfig.Config 也复制一份
+// 其余的map和slice与原config共用, update 总是整体替换这些字段, 不会修改原值
+func copyConfig(config interface{}) interface{} {
+	ref := reflect.ValueOf(config)
+	if ref.Kind() != reflect.Ptr || ref.IsNil() || ref.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	next := reflect.New(ref.Elem().Type())
+	next.Elem().Set(ref.Elem())
+	copyBaseConfig(next.Elem())
+	return next.Interface()
+}
+
+func copyBaseConfig(ref reflect.Value) {
+	for i := 0; i < ref.NumField(); i++ {
+		field := ref.Field(i)
+		if !ref.Type().Field(i).Anonymous || !field.CanSet() {
 			continue
 		}
-		if reflect.Struct == refField.Kind() && refField.CanAddr() && refField.Type().Name() == "" {
-			continue
+		switch {
+		case field.Kind() == reflect.Struct:
+			copyBaseConfig(field)
+		case field.Kind() == reflect.Ptr && !field.IsNil() && field.Elem().Kind() == reflect.Struct:
+			cp := reflect.New(field.Elem().Type())
+			cp.Elem().Set(field.Elem())
+			if field.Elem().Type() != baseType {
+				copyBaseConfig(cp.Elem())
+			}
+			field.Set(cp)
 		}
-		refTypeField := refType.Field(i)
-		// 从环境变量的env tag中取出key, 一定是大写
-		key, err := getKey(refTypeField)
-		if err != nil {
-			return err
+	}
+}
+
+// commitConfig 把 copyConfig 的副本写回config, 嵌入的 *fconfig.Config 仍然指向原来的对象(通常是fconfig.DefaultConfig),
+// 其内容整体赋值一次替换. 结构体赋值本身不是原子的, 不加锁直接读取config或 fconfig.DefaultConfig 的代码仍可能读到
+// 新旧混合的值, 需要一致的配置时读取 fconfig.Current() 或 Snapshot(), 它们在写回之后才整体替换
+func commitConfig(config, next interface{}) {
+	base := findBaseConfig(reflect.ValueOf(config))
+	nextBase := findBaseConfig(reflect.ValueOf(next))
+	ref := reflect.ValueOf(config).Elem()
+	if ref.Type() == baseType || base == nil || nextBase == nil {
+		ref.Set(reflect.ValueOf(next).Elem())
+		return
+	}
+
+	*base = *nextBase
+	// 除嵌入的指针外的字段写回config
+	restore := reflect.ValueOf(next).Elem()
+	restoreBaseConfig(restore, base)
+	ref.Set(restore)
+}
+
+// restoreBaseConfig 把副本中嵌入的 *fconfig.Config 换回原来的指针
+func restoreBaseConfig(ref reflect.Value, base *fconfig.Config) {
+	for i := 0; i < ref.NumField(); i++ {
+		field := ref.Field(i)
+		if !ref.Type().Field(i).Anonymous || !field.CanSet() {
+			continue
 		}
-		// 记录字段的index
-		filedIndexes[key] = i
-		var remoteKey string
-		if remoteServer.IsKeyLower() {
-			remoteKey = strings.ToLower(key)
-		} else {
-			remoteKey = key
+		switch {
+		case field.Type() == reflect.PtrTo(baseType):
+			field.Set(reflect.ValueOf(base))
+		case field.Kind() == reflect.Struct:
+			restoreBaseConfig(field, base)
+		case field.Kind() == reflect.Ptr && !field.IsNil() && field.Elem().Kind() == reflect.Struct:
+			restoreBaseConfig(field.Elem(), base)
 		}
+	}
+}
 
-		// 只初始化apollo中已设置的参数, 其他的忽略
-		if _, ok := originRemoteKeys[remoteKey]; ok {
-			value := remoteServer.Get(remoteKey)
-			if err := set(refField, refTypeField, value); err != nil {
-				return err
+func findBaseConfig(ref reflect.Value) *fconfig.Config {
+	for ref.Kind() == reflect.Ptr {
+		if ref.IsNil() {
+			return nil
+		}
+		ref = ref.Elem()
+	}
+	if ref.Kind() != reflect.Struct {
+		return nil
+	}
+	if ref.Type() == baseType {
+		if !ref.CanAddr() {
+			return nil
+		}
+		return ref.Addr().Interface().(*fconfig.Config)
+	}
+	for i := 0; i < ref.NumField(); i++ {
+		if ref.Type().Field(i).Anonymous {
+			if base := findBaseConfig(ref.Field(i)); base != nil {
+				return base
 			}
-			fmt.Printf("[remote-conf] set key [%v] value [%v]\n", remoteKey, value)
 		}
 	}
 	return nil
@@ -159,65 +340,57 @@ func parseKeyForOption(key string) (string, []string) {
 }
 
 func set(field reflect.Value, sf reflect.StructField, value string) error {
-	if field.Kind() == reflect.Slice {
+	switch field.Kind() {
+	case reflect.Slice:
 		return handleSlice(field, value, sf)
+	case reflect.Map:
+		return handleMap(field, value, sf)
 	}
 
-	var typee = sf.Type
-	var fieldee = field
+	typee := sf.Type
 	if typee.Kind() == reflect.Ptr {
 		typee = typee.Elem()
-		fieldee = field.Elem()
 	}
+	val, err := parseValue(typee, value)
+	if err != nil {
+		return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
+	}
+	if sf.Type.Kind() == reflect.Ptr {
+		ptr := reflect.New(typee)
+		ptr.Elem().Set(val)
+		val = ptr
+	}
+	field.Set(val)
+	return nil
+}
 
-	parserFunc, ok := defaultBuiltInParsers[typee.Kind()]
-	if ok {
+// parseValue 按类型解析, 依次尝试 typeParsers, encoding.TextUnmarshaler 和按Kind解析
+func parseValue(typee reflect.Type, value string) (reflect.Value, error) {
+	if parserFunc, ok := typeParsers[typee]; ok {
 		val, err := parserFunc(value)
 		if err != nil {
-			return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
+			return reflect.Value{}, err
 		}
-
-		fieldee.Set(reflect.ValueOf(val))
-		return nil
+		return reflect.ValueOf(val).Convert(typee), nil
 	}
 
-	parserFunc, ok = defaultBuiltInParsers[typee.Kind()]
-	if ok {
-		val, err := parserFunc(value)
-		if err != nil {
-			return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
+	ptr := reflect.New(typee)
+	if tm, ok := ptr.Interface().(encoding.TextUnmarshaler); ok {
+		if err := tm.UnmarshalText([]byte(value)); err != nil {
+			return reflect.Value{}, err
 		}
-
-		fieldee.Set(reflect.ValueOf(val).Convert(typee))
-		return nil
+		return ptr.Elem(), nil
 	}
 
-	return fmt.Errorf(`env: no parser found for field "%s" of type "%s"`, sf.Name, sf.Type)
-}
-
-func update(config interface{}, key, value string) error {
-	ptrRef := reflect.ValueOf(config)
-	if ptrRef.Kind() != reflect.Ptr {
-		return ErrNotAStructPtr
+	parserFunc, ok := defaultBuiltInParsers[typee.Kind()]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("no parser found")
 	}
-	ref := ptrRef.Elem()
-	if ref.Kind() != reflect.Struct {
-		return ErrNotAStructPtr
-	}
-	var refType = ref.Type()
-	filedIndex, ok := filedIndexes[key]
-	// 只处理已知的配置值
-	if ok {
-		refField := ref.Field(filedIndex)
-		refTypeField := refType.Field(filedIndex)
-		if err := set(refField, refTypeField, value); err != nil {
-			return err
-		} else {
-			return nil
-		}
-	} else {
-		return fmt.Errorf("handle OnUpdate:[%v]:[%v] ignore, unrecognize config", key, value)
+	val, err := parserFunc(value)
+	if err != nil {
+		return reflect.Value{}, err
 	}
+	return reflect.ValueOf(val).Convert(typee), nil
 }
 
 func handleSlice(field reflect.Value, value string, sf reflect.StructField) error {
@@ -225,32 +398,26 @@ func handleSlice(field reflect.Value, value string, sf reflect.StructField) erro
 	if separator == "" {
 		separator = ","
 	}
-	var parts = strings.Split(value, separator)
+	var parts []string
+	if strings.TrimSpace(value) != "" {
+		parts = strings.Split(value, separator)
+	}
 
 	var typee = sf.Type.Elem()
 	if typee.Kind() == reflect.Ptr {
 		typee = typee.Elem()
 	}
 
-	if _, ok := reflect.New(typee).Interface().(encoding.TextUnmarshaler); ok {
-		return parseTextUnmarshalers(field, parts, sf)
-	}
-
-	parserFunc, ok := defaultBuiltInParsers[typee.Kind()]
-	if !ok {
-		return fmt.Errorf(`env: no parser found for field "%s" of type "%s"`, sf.Name, sf.Type)
-	}
-
 	var result = reflect.MakeSlice(sf.Type, 0, len(parts))
 	for _, part := range parts {
-		r, err := parserFunc(part)
+		v, err := parseValue(typee, strings.TrimSpace(part))
 		if err != nil {
 			return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
 		}
-		var v = reflect.ValueOf(r).Convert(typee)
 		if sf.Type.Elem().Kind() == reflect.Ptr {
-			v = reflect.New(typee)
-			v.Elem().Set(reflect.ValueOf(r).Convert(typee))
+			ptr := reflect.New(typee)
+			ptr.Elem().Set(v)
+			v = ptr
 		}
 		result = reflect.Append(result, v)
 	}
@@ -258,98 +425,67 @@ func handleSlice(field reflect.Value, value string, sf reflect.StructField) erro
 	return nil
 }
 
-func parseTextUnmarshalers(field reflect.Value, data []string, sf reflect.StructField) error {
-	s := len(data)
-	elemType := field.Type().Elem()
-	slice := reflect.MakeSlice(reflect.SliceOf(elemType), s, s)
-	for i, v := range data {
-		sv := slice.Index(i)
-		kind := sv.Kind()
-		if kind == reflect.Ptr {
-			sv = reflect.New(elemType.Elem())
-		} else {
-			sv = sv.Addr()
-		}
-		tm := sv.Interface().(encoding.TextUnmarshaler)
-		if err := tm.UnmarshalText([]byte(v)); err != nil {
+// handleMap 支持json对象, 或者与env库一致的 k1:v1,k2:v2 格式
+func handleMap(field reflect.Value, value string, sf reflect.StructField) error {
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		result := reflect.New(sf.Type)
+		if err := json.Unmarshal([]byte(value), result.Interface()); err != nil {
 			return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
 		}
-		if kind == reflect.Ptr {
-			slice.Index(i).Set(sv)
-		}
+		field.Set(result.Elem())
+		return nil
 	}
 
-	field.Set(slice)
-
-	return nil
-}
-
-func getJsonType(item *simplejson.Json) string {
-	switch item.Interface().(type) {
-	case json.Number, int64, float64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64, float32:
-		return "int"
-	case bool:
-		return "bool"
-	case string:
-		return "string"
+	separator := sf.Tag.Get("envSeparator")
+	if separator == "" {
+		separator = ","
+	}
+	keyValSeparator := sf.Tag.Get("envKeyValSeparator")
+	if keyValSeparator == "" {
+		keyValSeparator = ":"
 	}
 
-	return ""
-}
-
-func applyRemoteConfigForJson(config interface{}, remoteServer RemoteConfServer) error {
-	jsonBytes, _ := json.Marshal(config)
-	rspJsonBody, _ := simplejson.NewJson(jsonBytes)
-	remoteKeys := remoteServer.GetAllKeys()
-
-	for i := 0; i < len(remoteKeys); i++ {
-		remoteKey := remoteKeys[i]
-		typeStr := getJsonType(rspJsonBody.Get(remoteKey))
-		value := remoteServer.Get(remoteKey)
-		switch typeStr {
-		case "int":
-			num, _ := strconv.Atoi(value)
-			rspJsonBody.Set(remoteKey, num)
-		case "bool":
-			if value == "true" {
-				rspJsonBody.Set(remoteKey, true)
-			} else {
-				rspJsonBody.Set(remoteKey, false)
+	result := reflect.MakeMap(sf.Type)
+	if strings.TrimSpace(value) != "" {
+		for _, part := range strings.Split(value, separator) {
+			pair := strings.SplitN(part, keyValSeparator, 2)
+			if len(pair) != 2 {
+				return fmt.Errorf(`env: parse error on field "%s" of type "%s": %q should be in "key%svalue" format`, sf.Name, sf.Type, part, keyValSeparator)
 			}
-		case "string":
-			rspJsonBody.Set(remoteKey, value)
-		default:
-			continue
+			k, err := parseValue(sf.Type.Key(), strings.TrimSpace(pair[0]))
+			if err != nil {
+				return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
+			}
+			v, err := parseValue(sf.Type.Elem(), strings.TrimSpace(pair[1]))
+			if err != nil {
+				return fmt.Errorf(`env: parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type, err)
+			}
+			result.SetMapIndex(k, v)
 		}
 	}
-
-	jsonBytes, _ = rspJsonBody.MarshalJSON()
-	json.Unmarshal(jsonBytes, &config)
-
-	jsonBytes, _ = json.Marshal(config)
+	field.Set(result)
 	return nil
 }
 
-func updateForJson(config interface{}, remoteKey, value string) error {
-	jsonBytes, _ := json.Marshal(config)
-	rspJsonBody, _ := simplejson.NewJson(jsonBytes)
-
-	typeStr := getJsonType(rspJsonBody.Get(remoteKey))
-	switch typeStr {
-	case "int":
-		num, _ := strconv.Atoi(value)
-		rspJsonBody.Set(remoteKey, num)
-	case "bool":
-		if value == "true" {
-			rspJsonBody.Set(remoteKey, true)
-		} else {
-			rspJsonBody.Set(remoteKey, false)
+// remoteValueString 远程配置的值转换为字符串, 数组按逗号拼接, 对象使用json, 数字不使用科学计数法
+func remoteValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, remoteValueString(item))
 		}
-	case "string":
-		rspJsonBody.Set(remoteKey, value)
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(raw)
 	}
-
-	jsonBytes, _ = rspJsonBody.MarshalJSON()
-	json.Unmarshal(jsonBytes, &config)
-	return nil
+	return fmt.Sprintf("%v", value)
 }
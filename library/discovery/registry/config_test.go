@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+type mapConfServer map[string]interface{}
+
+func (m mapConfServer) GetAllKeys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (m mapConfServer) Get(key string) string {
+	return remoteValueString(m[key])
+}
+
+func (m mapConfServer) IsKeyLower() bool {
+	return false
+}
+
+type applierConfig struct {
+	*fconfig.Config
+	Timeout  time.Duration     `env:"TIMEOUT" json:"TIMEOUT"`
+	Weights  map[string]int    `env:"WEIGHTS" json:"WEIGHTS"`
+	Callback *url.URL          `env:"CALLBACK" json:"CALLBACK"`
+	Allow    []*net.IPNet      `env:"ALLOW" json:"ALLOW"`
+	Labels   map[string]string `json:"LABELS"`
+	Hosts    []string          `env:"HOSTS" json:"HOSTS"`
+	Retries  int64             `env:"RETRIES" json:"RETRIES"`
+}
+
+func TestApplyRemoteConfig(t *testing.T) {
+	base := fconfig.Config{}
+	base.RefererAllowDomains = "a.com"
+	cfg := &applierConfig{Config: &base}
+
+	err := applyRemoteConfig(cfg, mapConfServer{
+		"TIMEOUT":               "1m30s",
+		"WEIGHTS":               "a:1, b:2",
+		"CALLBACK":              "https://example.com/cb?x=1",
+		"ALLOW":                 []interface{}{"10.0.0.0/8", "192.168.1.0/24"},
+		"LABELS":                map[string]interface{}{"zone": "sh"},
+		"HOSTS":                 []interface{}{"h1", "h2"},
+		"RETRIES":               float64(1000000),
+		"EDITION":               "saas",
+		"REFERER_ALLOW_DOMAINS": "b.com,C.com",
+		"UNKNOWN":               "x",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, cfg.Timeout)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, cfg.Weights)
+	assert.Equal(t, "example.com", cfg.Callback.Host)
+	assert.Len(t, cfg.Allow, 2)
+	assert.Equal(t, "192.168.1.0/24", cfg.Allow[1].String())
+	assert.Equal(t, map[string]string{"zone": "sh"}, cfg.Labels)
+	assert.Equal(t, []string{"h1", "h2"}, cfg.Hosts)
+	assert.Equal(t, int64(1000000), cfg.Retries)
+	// 嵌入的 fconfig.Config 和派生字段
+	assert.Equal(t, fconfig.EDITION_SAAS, base.Edition)
+	assert.Equal(t, map[string]struct{}{"b.com": {}, "c.com": {}}, base.RefererAllowDomainSet)
+
+	assert.Nil(t, update(cfg, "X_FORWARDED_FOR_ALLOW_NET_CIDR", "10.0.0.0/8"))
+	assert.Nil(t, initDerivedFields(cfg))
+	assert.Len(t, base.XForwardedForAllowNetCIDRArr, 1)
+
+	assert.ErrorIs(t, update(cfg, "UNKNOWN", "x"), errUnknownKey)
+	assert.NotNil(t, update(cfg, "TIMEOUT", "abc"))
+	assert.Equal(t, 90*time.Second, cfg.Timeout)
+}
+
+func TestOnValuesCommitTogether(t *testing.T) {
+	base := fconfig.Config{}
+	cfg := &testConfig{Config: &base, Workers: 1}
+	manager := &RegistryConfManager{config: cfg}
+
+	// 副本上的修改不影响原config
+	next := copyConfig(cfg).(*testConfig)
+	assert.Nil(t, update(next, "EDITION", "saas"))
+	assert.Nil(t, update(next, "WORKERS", "2"))
+	assert.Empty(t, base.Edition)
+	assert.Equal(t, 1, cfg.Workers)
+
+	manager.onValues(map[string]interface{}{
+		"EDITION":               "saas",
+		"WORKERS":               "4",
+		"REFERER_ALLOW_DOMAINS": "b.com",
+	})
+	// 嵌入的指针不变, 派生字段随变更一起替换
+	assert.Same(t, &base, cfg.Config)
+	assert.Equal(t, fconfig.EDITION_SAAS, base.Edition)
+	assert.Equal(t, 4, cfg.Workers)
+	assert.Equal(t, map[string]struct{}{"b.com": {}}, base.RefererAllowDomainSet)
+	assert.Equal(t, 4, Snapshot().(*testConfig).Workers)
+}
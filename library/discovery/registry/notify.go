@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+// Change 一个配置项的变更, Key为大写的配置名
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+type keySubscriber struct {
+	keys map[string]bool // 为空时订阅所有配置
+	fn   func(changes []Change)
+}
+
+type fieldSubscriber struct {
+	field string
+	fn    func(old, new reflect.Value)
+}
+
+var (
+	snapshot         atomic.Value // 调用方config的副本, 每次热更新整体替换
+	keySubscribers   []keySubscriber
+	fieldSubscribers []fieldSubscriber
+	subscriberLock   sync.Mutex
+)
+
+// OnChange 订阅配置项的变更, keys为大写的配置名, 不传时订阅所有配置
+// 同一次watch中的多个变更会一起回调, 回调时 Snapshot 和 fconfig.Current 已经是新的配置
+// 只有这两个快照的读取是原子的, 直接读取config或 fconfig.DefaultConfig 的字段在热更新时可能读到更新了一半的值
+func OnChange(fn func(changes []Change), keys ...string) {
+	sub := keySubscriber{keys: make(map[string]bool), fn: fn}
+	for _, key := range keys {
+		sub.keys[key] = true
+	}
+
+	subscriberLock.Lock()
+	defer subscriberLock.Unlock()
+	keySubscribers = append(keySubscribers, sub)
+}
+
+// OnFieldChange 按结构体字段名订阅变更, 支持嵌入结构体中的字段, T必须与字段类型一致
+// 例如 OnFieldChange("RedisAddr", func(old, new string) {...})
+func OnFieldChange[T any](field string, fn func(old, new T)) {
+	sub := fieldSubscriber{field: field, fn: func(old, new reflect.Value) {
+		oldValue, ok1 := old.Interface().(T)
+		newValue, ok2 := new.Interface().(T)
+		if !ok1 || !ok2 {
+			fmt.Printf("[remote-conf] error: field %s is %s, subscriber type mismatch\n", field, new.Type())
+			return
+		}
+		fn(oldValue, newValue)
+	}}
+
+	subscriberLock.Lock()
+	defer subscriberLock.Unlock()
+	fieldSubscribers = append(fieldSubscribers, sub)
+}
+
+// Snapshot 返回调用方config的最新副本, 类型与传给 StartRegistryConfig 的一致
+// 热更新时整体替换, 不会读到更新了一半的配置; 未初始化时返回nil
+func Snapshot() interface{} {
+	return snapshot.Load()
+}
+
+// storeSnapshot 保存config的副本, 返回上一个副本
+// 使用 copyConfig 复制, 保留 json:"-" 和未导出的字段
+func storeSnapshot(config interface{}) interface{} {
+	next := copyConfig(config)
+	if next == nil {
+		fmt.Printf("[remote-conf] error: snapshot config %T failed\n", config)
+		return nil
+	}
+	return snapshot.Swap(next)
+}
+
+// publishChanges 替换快照后依次通知 fconfig 和订阅方
+func publishChanges(config interface{}, changes []Change) {
+	old := storeSnapshot(config)
+	next := snapshot.Load()
+	fconfig.Refresh()
+
+	subscriberLock.Lock()
+	keySubs := append([]keySubscriber{}, keySubscribers...)
+	fieldSubs := append([]fieldSubscriber{}, fieldSubscribers...)
+	subscriberLock.Unlock()
+
+	for _, sub := range keySubs {
+		matched := changes
+		if len(sub.keys) > 0 {
+			matched = nil
+			for _, change := range changes {
+				if sub.keys[change.Key] {
+					matched = append(matched, change)
+				}
+			}
+		}
+		if len(matched) > 0 {
+			callSafely(func() { sub.fn(matched) })
+		}
+	}
+
+	if old == nil || next == nil {
+		return
+	}
+	for _, sub := range fieldSubs {
+		oldValue, ok1 := fieldByName(old, sub.field)
+		newValue, ok2 := fieldByName(next, sub.field)
+		if !ok1 || !ok2 || reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			continue
+		}
+		callSafely(func() { sub.fn(oldValue, newValue) })
+	}
+}
+
+// callSafely 回调panic不影响watch
+func callSafely(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Printf("[remote-conf] error: change subscriber panic: %v\n", err)
+		}
+	}()
+	fn()
+}
+
+// fieldByName 查找字段, 嵌入的结构体指针为nil时返回false
+func fieldByName(config interface{}, name string) (reflect.Value, bool) {
+	ref := reflect.ValueOf(config)
+	for ref.Kind() == reflect.Ptr {
+		if ref.IsNil() {
+			return reflect.Value{}, false
+		}
+		ref = ref.Elem()
+	}
+	if ref.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	sf, ok := ref.Type().FieldByName(name)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	for _, i := range sf.Index {
+		for ref.Kind() == reflect.Ptr {
+			if ref.IsNil() {
+				return reflect.Value{}, false
+			}
+			ref = ref.Elem()
+		}
+		ref = ref.Field(i)
+	}
+	return ref, true
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+type testConfig struct {
+	*fconfig.Config
+	Workers int    `env:"WORKERS" json:"WORKERS"`
+	Token   string `json:"-"`
+	local   string
+}
+
+func TestPublishChanges(t *testing.T) {
+	old := fconfig.DefaultConfig
+	defer func() { fconfig.DefaultConfig = old }()
+	fconfig.DefaultConfig.LogMode = "warn"
+	fconfig.Refresh()
+
+	cfg := &testConfig{Config: &fconfig.DefaultConfig, Workers: 1}
+	storeSnapshot(cfg)
+
+	var keyChanges []Change
+	OnChange(func(changes []Change) {
+		keyChanges = append(keyChanges, changes...)
+	}, "LOG_MODE")
+
+	var workers [2]int
+	OnFieldChange("Workers", func(old, new int) {
+		workers = [2]int{old, new}
+	})
+	var logModes [2]string
+	OnFieldChange("LogMode", func(old, new string) {
+		logModes = [2]string{old, new}
+	})
+	// 类型不一致的订阅被忽略
+	OnFieldChange("Workers", func(old, new string) {
+		t.Fatal("should not be called")
+	})
+
+	var hookLogMode string
+	fconfig.OnChange(func(old, new *fconfig.Config) {
+		hookLogMode = new.LogMode
+	})
+
+	assert.Nil(t, update(cfg, "LOG_MODE", "debug"))
+	assert.Nil(t, update(cfg, "WORKERS", "4"))
+	publishChanges(cfg, []Change{{Key: "LOG_MODE", Old: "warn", New: "debug"}, {Key: "WORKERS", Old: "1", New: "4"}})
+
+	assert.Equal(t, []Change{{Key: "LOG_MODE", Old: "warn", New: "debug"}}, keyChanges)
+	assert.Equal(t, [2]int{1, 4}, workers)
+	assert.Equal(t, [2]string{"warn", "debug"}, logModes)
+	assert.Equal(t, "debug", hookLogMode)
+	assert.Equal(t, "debug", fconfig.Current().LogMode)
+
+	// 快照是独立的副本, 不受之后的写入影响
+	snap := Snapshot().(*testConfig)
+	assert.Equal(t, 4, snap.Workers)
+	cfg.Workers = 8
+	assert.Equal(t, 4, snap.Workers)
+	assert.NotSame(t, cfg.Config, snap.Config)
+}
+
+func TestSnapshotKeepsAllFields(t *testing.T) {
+	cfg := &testConfig{Config: &fconfig.Config{}, Workers: 2, Token: "t", local: "l"}
+	cfg.LogMode = "info"
+	storeSnapshot(cfg)
+
+	snap := Snapshot().(*testConfig)
+	assert.Equal(t, "t", snap.Token)
+	assert.Equal(t, "l", snap.local)
+	assert.Equal(t, "info", snap.LogMode)
+	assert.NotSame(t, cfg.Config, snap.Config)
+}
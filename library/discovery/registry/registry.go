@@ -1,78 +1,163 @@
 package registry
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
 	"sync"
-	"time"
 
 	"github.com/google/uuid"
-	registryapi "github.com/hashicorp/consul/api"
 
 	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/health"
 )
 
+// 实例元数据中的通用key
+const (
+	MetadataVersion = "version"
+	MetadataZone    = "zone"
+	MetadataWeight  = "weight"
+)
+
+// Instance 注册中心中的一个服务实例
+type Instance struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Addr ip:port
+func (i *Instance) Addr() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// ServiceRegistry 服务注册中心, 由 SERVICE_REGISTRY_MODE 选择实现: consul, etcd, static, dns
+// static和dns由外部维护实例列表(例如k8s service), Register 和 Deregister 不做任何事情
+type ServiceRegistry interface {
+	Register(ctx context.Context, ins *Instance) error
+	Deregister(ctx context.Context, ins *Instance) error
+	// Instances 返回健康的实例
+	Instances(ctx context.Context, name string) ([]*Instance, error)
+	// Watch 阻塞监听服务的健康实例, 变化时回调全部实例, ctx取消时返回
+	Watch(ctx context.Context, name string, onChange func([]*Instance)) error
+}
+
 var (
-	defaultDiscoveryManager *Registry
-	once                    sync.Once
+	defaultServiceRegistry ServiceRegistry
+	registryLock           sync.Mutex
+
+	localInstance *Instance
+	once          sync.Once
 )
 
-// Registry 结构体定义了服务注册所需的基本信息
-type Registry struct {
-	client    *registryapi.Client
-	serviceID string
-	checkPort string
-	isStop    bool
+// DefaultServiceRegistry 按配置创建的注册中心, 全局共用一个. 创建失败时下次调用重新创建
+func DefaultServiceRegistry() (ServiceRegistry, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if defaultServiceRegistry != nil {
+		return defaultServiceRegistry, nil
+	}
+
+	r, err := NewServiceRegistry(&fconfig.DefaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	defaultServiceRegistry = r
+	return r, nil
 }
 
-// RegisterService 初始化 Registry，包括创建客户端、健康检查和注册服务
-func RegisterService() {
-	once.Do(func() {
-		defaultDiscoveryManager = &Registry{
-			serviceID: uuid.New().String(),
-			checkPort: "9091",
+// NewServiceRegistry 按 SERVICE_REGISTRY_MODE 创建注册中心
+func NewServiceRegistry(cfg *fconfig.Config) (ServiceRegistry, error) {
+	switch cfg.ServiceRegistryMode {
+	case "", "consul":
+		return newConsulServiceRegistry(cfg.RegistryAddr, cfg.RegistryTag, cfg.RegistryHealthPort)
+	case "etcd":
+		client, err := newEtcdClient(cfg)
+		if err != nil {
+			return nil, err
 		}
+		return newEtcdServiceRegistry(client, cfg.RegistryEtcdServicePrefix), nil
+	case "static":
+		return newStaticServiceRegistry(cfg.RegistryStaticFile), nil
+	case "dns":
+		return newDNSServiceRegistry(cfg.RegistryDNSSuffix, mustAtoi(cfg.RegistryDNSPort)), nil
+	}
+	return nil, fmt.Errorf("unsupported SERVICE_REGISTRY_MODE: %s", cfg.ServiceRegistryMode)
+}
+
+// LocalInstance 当前服务注册的实例, 元数据包含 SERVICE_VERSION, SERVICE_ZONE 和 SERVICE_METADATA
+func LocalInstance() *Instance {
+	cfg := fconfig.DefaultConfig
+	metadata := make(map[string]string, len(cfg.ServiceMetadata)+2)
+	for k, v := range cfg.ServiceMetadata {
+		metadata[k] = v
+	}
+	if cfg.ServiceVersion != "" {
+		metadata[MetadataVersion] = cfg.ServiceVersion
+	}
+	if cfg.ServiceZone != "" {
+		metadata[MetadataZone] = cfg.ServiceZone
+	}
+	return &Instance{
+		ID:       uuid.New().String(),
+		Name:     cfg.ServerName,
+		Address:  getLocalIP(),
+		Port:     mustAtoi(cfg.GRPCPort),
+		Tags:     []string{cfg.RegistryTag},
+		Metadata: metadata,
+	}
+}
 
-		cfg := registryapi.DefaultConfig()
-		cfg.Address = fconfig.DefaultConfig.RegistryAddr
-		client, err := registryapi.NewClient(cfg)
+// RegisterService 暴露健康检查的http端口, 并把当前服务注册到注册中心
+func RegisterService() {
+	once.Do(func() {
+		r, err := DefaultServiceRegistry()
 		if err != nil {
 			panic(err)
 		}
-		defaultDiscoveryManager.client = client
 
-		defaultDiscoveryManager.exportHealthCheckEndpoint() // 暴露健康检查的 HTTP 处理器
-		defaultDiscoveryManager.registerService()           // 向注册中心注册服务
-		go defaultDiscoveryManager.runReRegisterJob()       // 定期检查，如果服务不健康则重新注册
+		localInstance = LocalInstance()
+		exportHealthCheckEndpoint(localInstance.ID) // 暴露健康检查的 HTTP 处理器
+		if err := r.Register(context.Background(), localInstance); err != nil {
+			panic(fmt.Sprintf("[go-common Registry] Failed to register service(%s), err:%s", localInstance.Name, err))
+		}
+		fmt.Printf("[go-common Registry] Service registered (%s) successfully: %s\n", localInstance.Name, localInstance.ID)
 	})
 }
 
 // DeregisterService 从注册中心注销服务
 func DeregisterService() {
-	if defaultDiscoveryManager == nil {
+	if localInstance == nil {
 		return
 	}
 
-	defaultDiscoveryManager.isStop = true
-	if err := defaultDiscoveryManager.client.Agent().ServiceDeregister(defaultDiscoveryManager.serviceID); err != nil {
-		fmt.Printf("[go-common Registry] Failed to deregister service(%s), err: %s\n", fconfig.DefaultConfig.ServerName, err)
+	r, _ := DefaultServiceRegistry()
+	if err := r.Deregister(context.Background(), localInstance); err != nil {
+		fmt.Printf("[go-common Registry] Failed to deregister service(%s), err: %s\n", localInstance.Name, err)
 	} else {
-		fmt.Printf("[go-common Registry] Service deregistered(%s) successfully: %s\n", fconfig.DefaultConfig.ServerName, defaultDiscoveryManager.serviceID)
+		fmt.Printf("[go-common Registry] Service deregistered(%s) successfully: %s\n", localInstance.Name, localInstance.ID)
 	}
 }
 
-// exportHealthCheckEndpoint 初始化健康检查的 HTTP 处理器
-func (r *Registry) exportHealthCheckEndpoint() {
-	http.HandleFunc("/"+r.serviceID+"/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
-	go http.ListenAndServe(":"+r.checkPort, nil)
+// exportHealthCheckEndpoint 初始化健康检查的 HTTP 处理器, 注册中心的检查与k8s的readiness使用相同的状态
+func exportHealthCheckEndpoint(serviceID string) {
+	mux := http.NewServeMux()
+	mux.Handle("/"+serviceID+"/health", health.ReadinessHandler())
+	health.RegisterHandlers(mux)
+	go func() {
+		if err := http.ListenAndServe(":"+fconfig.DefaultConfig.RegistryHealthPort, mux); err != nil {
+			fmt.Printf("[go-common Registry] Failed to serve health check endpoint, err: %s\n", err)
+		}
+	}()
 }
 
 // getLocalIP 获取本地 IP 地址
-func (r *Registry) getLocalIP() string {
+func getLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return ""
@@ -87,66 +172,6 @@ func (r *Registry) getLocalIP() string {
 	return ""
 }
 
-// registerService 向注册中心注册服务
-func (r *Registry) registerService() {
-	registration := &registryapi.AgentServiceRegistration{
-		ID:      r.serviceID,
-		Name:    fconfig.DefaultConfig.ServerName,
-		Port:    mustAtoi(fconfig.DefaultConfig.GRPCPort),
-		Tags:    []string{fconfig.DefaultConfig.RegistryTag},
-		Address: r.getLocalIP(),
-		Check: &registryapi.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://%s:%s/%s/health", r.getLocalIP(), r.checkPort, r.serviceID),
-			Interval:                       "10s",
-			Timeout:                        "5s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-	}
-
-	if err := r.client.Agent().ServiceRegister(registration); err != nil {
-		panic(fmt.Sprintf("[go-common Registry] Failed to register service(%s), err:%s", fconfig.DefaultConfig.ServerName, err))
-	}
-	fmt.Printf("[go-common Registry] Service registered (%s) successfully: %s\n", fconfig.DefaultConfig.ServerName, r.serviceID)
-}
-
-// runReRegisterJob 如果当前服务不健康，重新注册服务
-func (r *Registry) runReRegisterJob() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		if r.isStop {
-			return
-		}
-
-		// 定时检查服务健康状态
-		<-ticker.C
-
-		// 服务不健康，重新注册服务
-		if !r.checkServiceHealth() {
-			r.registerService()
-		}
-	}
-}
-
-// checkServiceHealth 检查服务在注册中心的健康状态
-func (r *Registry) checkServiceHealth() bool {
-	services, _, err := r.client.Health().Service(fconfig.DefaultConfig.ServerName, fconfig.DefaultConfig.RegistryTag, true, nil)
-	if err != nil { // 整个服务在consul中不存在
-		fmt.Printf("[go-common Registry] Error checking service(%s) health: %s\n", fconfig.DefaultConfig.ServerName, err)
-		return false
-	}
-
-	// 遍历所有服务，如果发现当前实例的服务 ID 不存在，则重新注册服务
-	for _, service := range services {
-		if service.Service.ID == r.serviceID {
-			return true
-		}
-	}
-
-	return false
-}
-
 // mustAtoi 将字符串转换为整数，如果转换失败则 panic
 func mustAtoi(s string) int {
 	i, err := strconv.Atoi(s)
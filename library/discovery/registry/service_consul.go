@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	registryapi "github.com/hashicorp/consul/api"
+
+	"github.com/lzw5399/go-common-public/library/health"
+)
+
+// consulServiceRegistry 使用consul agent注册服务, 通过http检查 health 的readiness, 不健康时重新注册
+type consulServiceRegistry struct {
+	client     *registryapi.Client
+	tag        string
+	healthPort string
+
+	lock    sync.Mutex
+	stopJob map[string]chan struct{} // 实例id -> 停止重新注册的任务
+}
+
+func newConsulServiceRegistry(addr, tag, healthPort string) (*consulServiceRegistry, error) {
+	cfg := registryapi.DefaultConfig()
+	cfg.Address = addr
+	client, err := registryapi.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &consulServiceRegistry{
+		client:     client,
+		tag:        tag,
+		healthPort: healthPort,
+		stopJob:    make(map[string]chan struct{}),
+	}, nil
+}
+
+func (r *consulServiceRegistry) Register(ctx context.Context, ins *Instance) error {
+	if err := r.register(ins); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.stopJob[ins.ID]; !ok {
+		stop := make(chan struct{})
+		r.stopJob[ins.ID] = stop
+		go r.runReRegisterJob(ins, stop) // 定期检查，如果服务不健康则重新注册
+	}
+	return nil
+}
+
+func (r *consulServiceRegistry) register(ins *Instance) error {
+	registration := &registryapi.AgentServiceRegistration{
+		ID:      ins.ID,
+		Name:    ins.Name,
+		Port:    ins.Port,
+		Tags:    ins.Tags,
+		Address: ins.Address,
+		Meta:    ins.Metadata,
+		Check: &registryapi.AgentServiceCheck{
+			HTTP:                           fmt.Sprintf("http://%s:%s/%s/health", ins.Address, r.healthPort, ins.ID),
+			Interval:                       "10s",
+			Timeout:                        "5s",
+			DeregisterCriticalServiceAfter: "30s",
+		},
+	}
+	return r.client.Agent().ServiceRegister(registration)
+}
+
+func (r *consulServiceRegistry) Deregister(ctx context.Context, ins *Instance) error {
+	r.lock.Lock()
+	if stop, ok := r.stopJob[ins.ID]; ok {
+		close(stop)
+		delete(r.stopJob, ins.ID)
+	}
+	r.lock.Unlock()
+
+	return r.client.Agent().ServiceDeregister(ins.ID)
+}
+
+// runReRegisterJob 如果当前服务不健康，重新注册服务
+func (r *consulServiceRegistry) runReRegisterJob(ins *Instance, stop chan struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		// 定时检查服务健康状态
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// 服务不健康，重新注册服务. 自身readiness失败时consul的检查本来就不通过, 不需要重新注册
+		if health.Ready() && !r.checkServiceHealth(ins) {
+			if err := r.register(ins); err != nil {
+				fmt.Printf("[go-common Registry] Failed to re-register service(%s), err: %s\n", ins.Name, err)
+			}
+		}
+	}
+}
+
+// checkServiceHealth 检查服务在注册中心的健康状态
+func (r *consulServiceRegistry) checkServiceHealth(ins *Instance) bool {
+	services, _, err := r.client.Health().Service(ins.Name, r.tag, true, nil)
+	if err != nil { // 整个服务在consul中不存在
+		fmt.Printf("[go-common Registry] Error checking service(%s) health: %s\n", ins.Name, err)
+		return false
+	}
+
+	// 遍历所有服务，如果发现当前实例的服务 ID 不存在，则重新注册服务
+	for _, service := range services {
+		if service.Service.ID == ins.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *consulServiceRegistry) Instances(ctx context.Context, name string) ([]*Instance, error) {
+	instances, _, err := r.healthyInstances(ctx, name, 0)
+	return instances, err
+}
+
+// Watch 使用consul的blocking query, 实例变化时立即返回
+func (r *consulServiceRegistry) Watch(ctx context.Context, name string, onChange func([]*Instance)) error {
+	var lastIndex uint64
+	for ctx.Err() == nil {
+		instances, index, err := r.healthyInstances(ctx, name, lastIndex)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Printf("[go-common Registry] watch service(%s) err: %s\n", name, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		// index变小说明consul重启或者切换了leader, 重新开始
+		if index < lastIndex {
+			lastIndex = 0
+			continue
+		}
+		if index != lastIndex {
+			lastIndex = index
+			onChange(instances)
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *consulServiceRegistry) healthyInstances(ctx context.Context, name string, waitIndex uint64) ([]*Instance, uint64, error) {
+	opts := (&registryapi.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute}).WithContext(ctx)
+	entries, meta, err := r.client.Health().Service(name, r.tag, true, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := make([]*Instance, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		instances = append(instances, &Instance{
+			ID:       entry.Service.ID,
+			Name:     entry.Service.Service,
+			Address:  address,
+			Port:     entry.Service.Port,
+			Tags:     entry.Service.Tags,
+			Metadata: entry.Service.Meta,
+		})
+	}
+	return instances, meta.LastIndex, nil
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/lzw5399/go-common-public/library/health"
+)
+
+// etcdLeaseTTL 实例的租约时间, 进程退出且没有注销时, 超过租约时间后实例自动删除
+const etcdLeaseTTL = 15
+
+// etcdServiceRegistry 实例以json保存在 {prefix}/{服务名}/{实例id}, 通过租约续期保持存活
+// health 的readiness失败时删除实例, 恢复后重新写入
+type etcdServiceRegistry struct {
+	client *clientv3.Client
+	prefix string
+
+	lock   sync.Mutex
+	leases map[string]*etcdLease // 实例id -> 租约
+}
+
+type etcdLease struct {
+	id     clientv3.LeaseID
+	cancel context.CancelFunc // 停止续期和同步健康状态
+}
+
+func newEtcdServiceRegistry(client *clientv3.Client, prefix string) *etcdServiceRegistry {
+	return &etcdServiceRegistry{client: client, prefix: prefix, leases: make(map[string]*etcdLease)}
+}
+
+func (r *etcdServiceRegistry) key(name, id string) string {
+	return path.Join(r.prefix, name, id)
+}
+
+func (r *etcdServiceRegistry) Register(ctx context.Context, ins *Instance) error {
+	value, err := json.Marshal(ins)
+	if err != nil {
+		return err
+	}
+	lease, err := r.grant(ctx, ins, string(value), true)
+	if err != nil {
+		return err
+	}
+
+	// 续期使用独立的ctx, 在 Deregister 时结束
+	keepCtx, cancel := context.WithCancel(context.Background())
+	r.lock.Lock()
+	r.leases[ins.ID] = &etcdLease{id: lease, cancel: cancel}
+	r.lock.Unlock()
+	go r.keep(keepCtx, ins, string(value), lease)
+	return nil
+}
+
+// grant 申请新的租约, put为true时同时写入实例
+func (r *etcdServiceRegistry) grant(ctx context.Context, ins *Instance, value string, put bool) (clientv3.LeaseID, error) {
+	lease, err := r.client.Grant(ctx, etcdLeaseTTL)
+	if err != nil {
+		return 0, err
+	}
+	if put {
+		if _, err := r.client.Put(ctx, r.key(ins.Name, ins.ID), value, clientv3.WithLease(lease.ID)); err != nil {
+			_, _ = r.client.Revoke(ctx, lease.ID)
+			return 0, err
+		}
+	}
+	return lease.ID, nil
+}
+
+// keep 续期租约并同步健康状态. 续期中断时(比如etcd长时间不可用, 租约已经过期)重新申请租约并写入实例, 与consul的重新注册一致
+func (r *etcdServiceRegistry) keep(ctx context.Context, ins *Instance, value string, lease clientv3.LeaseID) {
+	ticker := time.NewTicker(etcdLeaseTTL * time.Second / 3)
+	defer ticker.Stop()
+
+	registered := true
+	for {
+		keepAlive, err := r.client.KeepAlive(ctx, lease)
+		if err == nil {
+			registered = r.syncHealth(ctx, ticker, keepAlive, ins, value, lease, registered)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("[go-common Registry] etcd lease of service(%s) %s stopped, re-register\n", ins.Name, ins.ID)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			ready := health.Ready()
+			newLease, err := r.grant(ctx, ins, value, ready)
+			if err != nil {
+				fmt.Printf("[go-common Registry] Failed to re-register service(%s) to etcd, err: %s\n", ins.Name, err)
+				continue
+			}
+			lease, registered = newLease, ready
+			break
+		}
+
+		r.lock.Lock()
+		if l, ok := r.leases[ins.ID]; ok {
+			l.id = lease
+		}
+		r.lock.Unlock()
+	}
+}
+
+// syncHealth 定期检查readiness, 失败时删除实例, 调用方不再看到该实例, 恢复后使用当前租约重新写入
+// 续期的channel关闭时返回, 返回值为实例当前是否已写入
+func (r *etcdServiceRegistry) syncHealth(ctx context.Context, ticker *time.Ticker, keepAlive <-chan *clientv3.LeaseKeepAliveResponse, ins *Instance, value string, lease clientv3.LeaseID, registered bool) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return registered
+		case _, ok := <-keepAlive:
+			if !ok {
+				return registered
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		ready := health.Ready()
+		if ready == registered {
+			continue
+		}
+		var err error
+		if ready {
+			_, err = r.client.Put(ctx, r.key(ins.Name, ins.ID), value, clientv3.WithLease(lease))
+		} else {
+			_, err = r.client.Delete(ctx, r.key(ins.Name, ins.ID))
+		}
+		if err != nil {
+			fmt.Printf("[go-common Registry] Failed to sync health of service(%s) to etcd, err: %s\n", ins.Name, err)
+			continue
+		}
+		registered = ready
+	}
+}
+
+func (r *etcdServiceRegistry) Deregister(ctx context.Context, ins *Instance) error {
+	r.lock.Lock()
+	lease, ok := r.leases[ins.ID]
+	delete(r.leases, ins.ID)
+	r.lock.Unlock()
+
+	if ok {
+		lease.cancel()
+	}
+	if _, err := r.client.Delete(ctx, r.key(ins.Name, ins.ID)); err != nil {
+		return err
+	}
+	if ok {
+		_, err := r.client.Revoke(ctx, lease.id)
+		return err
+	}
+	return nil
+}
+
+func (r *etcdServiceRegistry) Instances(ctx context.Context, name string) ([]*Instance, error) {
+	instances, _, err := r.list(ctx, name)
+	return instances, err
+}
+
+func (r *etcdServiceRegistry) list(ctx context.Context, name string) ([]*Instance, int64, error) {
+	resp, err := r.client.Get(ctx, r.key(name, "")+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := make([]*Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var ins Instance
+		if err := json.Unmarshal(kv.Value, &ins); err != nil {
+			fmt.Printf("[go-common Registry] invalid etcd instance %s: %s\n", kv.Key, err)
+			continue
+		}
+		instances = append(instances, &ins)
+	}
+	return instances, resp.Header.Revision, nil
+}
+
+// Watch 先读取全部实例, 再从读取时的revision开始监听, 每次变化重新读取全部实例
+func (r *etcdServiceRegistry) Watch(ctx context.Context, name string, onChange func([]*Instance)) error {
+	for ctx.Err() == nil {
+		instances, revision, err := r.list(ctx, name)
+		if err != nil {
+			fmt.Printf("[go-common Registry] watch service(%s) err: %s\n", name, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		onChange(instances)
+
+		watchCh := r.client.Watch(ctx, r.key(name, "")+"/", clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+		for resp := range watchCh {
+			if resp.Err() != nil {
+				break
+			}
+			if instances, _, err := r.list(ctx, name); err == nil {
+				onChange(instances)
+			}
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// staticPollInterval static和dns模式下重新读取实例的间隔
+var staticPollInterval = 5 * time.Second
+
+// staticServiceRegistry 实例列表来自json文件 {"服务名": ["ip:port"]}, 文件修改后自动生效, 适用于挂载k8s的ConfigMap
+type staticServiceRegistry struct {
+	file string
+}
+
+func newStaticServiceRegistry(file string) *staticServiceRegistry {
+	return &staticServiceRegistry{file: file}
+}
+
+func (r *staticServiceRegistry) Register(ctx context.Context, ins *Instance) error {
+	return nil
+}
+
+func (r *staticServiceRegistry) Deregister(ctx context.Context, ins *Instance) error {
+	return nil
+}
+
+func (r *staticServiceRegistry) Instances(ctx context.Context, name string) ([]*Instance, error) {
+	raw, err := os.ReadFile(r.file)
+	if err != nil {
+		return nil, err
+	}
+	services := make(map[string][]string)
+	if err := json.Unmarshal(raw, &services); err != nil {
+		return nil, fmt.Errorf("parse static registry file %s err: %v", r.file, err)
+	}
+	return addrsToInstances(name, services[name])
+}
+
+func (r *staticServiceRegistry) Watch(ctx context.Context, name string, onChange func([]*Instance)) error {
+	return pollInstances(ctx, name, r.Instances, onChange)
+}
+
+// dnsServiceRegistry 实例为 {服务名}{后缀} 解析到的所有ip, 适用于k8s的headless service
+type dnsServiceRegistry struct {
+	suffix string
+	port   int
+}
+
+func newDNSServiceRegistry(suffix string, port int) *dnsServiceRegistry {
+	return &dnsServiceRegistry{suffix: suffix, port: port}
+}
+
+func (r *dnsServiceRegistry) Register(ctx context.Context, ins *Instance) error {
+	return nil
+}
+
+func (r *dnsServiceRegistry) Deregister(ctx context.Context, ins *Instance) error {
+	return nil
+}
+
+func (r *dnsServiceRegistry) Instances(ctx context.Context, name string) ([]*Instance, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, name+r.suffix)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, strconv.Itoa(r.port)))
+	}
+	return addrsToInstances(name, addrs)
+}
+
+func (r *dnsServiceRegistry) Watch(ctx context.Context, name string, onChange func([]*Instance)) error {
+	return pollInstances(ctx, name, r.Instances, onChange)
+}
+
+func addrsToInstances(name string, addrs []string) ([]*Instance, error) {
+	instances := make([]*Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s of service(%s): %v", addr, name, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s of service(%s): %v", addr, name, err)
+		}
+		instances = append(instances, &Instance{ID: addr, Name: name, Address: host, Port: port})
+	}
+	return instances, nil
+}
+
+// pollInstances 定时读取实例, 有变化时回调, 读取失败时保留上一次的实例
+func pollInstances(ctx context.Context, name string, list func(ctx context.Context, name string) ([]*Instance, error), onChange func([]*Instance)) error {
+	var last []*Instance
+	first := true
+	ticker := time.NewTicker(staticPollInterval)
+	defer ticker.Stop()
+	for {
+		instances, err := list(ctx, name)
+		if err != nil {
+			fmt.Printf("[go-common Registry] list service(%s) err: %s\n", name, err)
+		} else if first || !reflect.DeepEqual(last, instances) {
+			first = false
+			last = instances
+			onChange(instances)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticServiceRegistry(t *testing.T) {
+	old := staticPollInterval
+	staticPollInterval = 10 * time.Millisecond
+	defer func() { staticPollInterval = old }()
+
+	file := filepath.Join(t.TempDir(), "services.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"user-system": ["10.0.0.1:9090", "10.0.0.2:9090"]}`), 0644))
+	r := newStaticServiceRegistry(file)
+	assert.Nil(t, r.Register(context.Background(), &Instance{Name: "user-system"}))
+
+	instances, err := r.Instances(context.Background(), "user-system")
+	assert.Nil(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "10.0.0.2:9090", instances[1].Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []*Instance, 10)
+	go func() {
+		_ = r.Watch(ctx, "user-system", func(instances []*Instance) { updates <- instances })
+	}()
+	assert.Len(t, <-updates, 2)
+
+	assert.Nil(t, os.WriteFile(file, []byte(`{"user-system": ["10.0.0.3:9090"]}`), 0644))
+	select {
+	case instances := <-updates:
+		assert.Equal(t, []*Instance{{ID: "10.0.0.3:9090", Name: "user-system", Address: "10.0.0.3", Port: 9090}}, instances)
+	case <-time.After(2 * time.Second):
+		t.Fatal("static registry change not watched")
+	}
+
+	_, err = r.Instances(context.Background(), "unknown")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(file, []byte(`{"user-system": ["bad"]}`), 0644))
+	_, err = r.Instances(context.Background(), "user-system")
+	assert.NotNil(t, err)
+}
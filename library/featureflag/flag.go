@@ -0,0 +1,213 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// 功能开关在代码中定义, 按规则依次匹配, 第一个匹配的规则决定结果, 都不匹配时使用默认值
+//
+//	var NewPortal = featureflag.Define("new_portal", false,
+//		featureflag.ForOrgs(10001),
+//		featureflag.ForEditions(fconfig.EDITION_SAAS).WithPercentage(20),
+//	)
+//
+//	if NewPortal.Enabled(ctx) { ... }   // gin中使用 NewPortal.EnabledGin(c)
+//
+// 默认值和规则可以通过配置 FEATURE_FLAGS 覆盖, 放在registry中时支持热更新, 见 remote.go
+
+// Rule 一条规则, 设置的条件全部满足时匹配, 没有设置任何条件的规则匹配所有请求
+type Rule struct {
+	Editions   []fconfig.Edition `json:"editions,omitempty"`   // 产品版本
+	OrgIds     []int64           `json:"orgIds,omitempty"`     // 企业id
+	UserIds    []int64           `json:"userIds,omitempty"`    // 用户id
+	Percentage *int              `json:"percentage,omitempty"` // 按企业id(没有时按用户id)灰度的百分比, 0-100
+	Enabled    bool              `json:"enabled"`              // 匹配时的结果
+}
+
+// ForEditions 指定产品版本开启
+func ForEditions(editions ...fconfig.Edition) Rule {
+	return Rule{Editions: editions, Enabled: true}
+}
+
+// ForOrgs 指定企业开启
+func ForOrgs(orgIds ...int64) Rule {
+	return Rule{OrgIds: orgIds, Enabled: true}
+}
+
+// ForUsers 指定用户开启
+func ForUsers(userIds ...int64) Rule {
+	return Rule{UserIds: userIds, Enabled: true}
+}
+
+// ForPercentage 按百分比灰度开启
+func ForPercentage(percentage int) Rule {
+	return Rule{Percentage: &percentage, Enabled: true}
+}
+
+// WithPercentage 在规则的基础上按百分比灰度
+func (r Rule) WithPercentage(percentage int) Rule {
+	r.Percentage = &percentage
+	return r
+}
+
+// Disabled 匹配时关闭, 用于在后面的规则之前排除部分企业或用户
+func (r Rule) Disabled() Rule {
+	r.Enabled = false
+	return r
+}
+
+func (r Rule) match(flag string, edition fconfig.Edition, user *fcontext.UserInfo) bool {
+	if len(r.Editions) > 0 && !contains(r.Editions, edition) {
+		return false
+	}
+	var orgId, userId int64
+	if user != nil {
+		orgId, userId = user.OrgId, user.UserId
+	}
+	if len(r.OrgIds) > 0 && !contains(r.OrgIds, orgId) {
+		return false
+	}
+	if len(r.UserIds) > 0 && !contains(r.UserIds, userId) {
+		return false
+	}
+	if r.Percentage != nil {
+		// 同一个企业在同一个开关上的结果固定, 不同开关之间相互独立
+		id := orgId
+		if id == 0 {
+			id = userId
+		}
+		if bucket(flag, id) >= *r.Percentage {
+			return false
+		}
+	}
+	return true
+}
+
+func bucket(flag string, id int64) int {
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%s:%d", flag, id)
+	return int(h.Sum32() % 100)
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag 一个功能开关, 使用 Define 定义
+type Flag struct {
+	name         string
+	defaultValue bool
+	rules        []Rule
+}
+
+// Decision 一次判断的结果, Reason说明命中的规则, 便于排查
+type Decision struct {
+	Flag    string
+	Enabled bool
+	Reason  string
+}
+
+var (
+	flags    = make(map[string]*Flag)
+	flagLock sync.RWMutex
+)
+
+// Define 定义功能开关, 一般作为包级变量. 同名重复定义会panic
+func Define(name string, defaultValue bool, rules ...Rule) *Flag {
+	flagLock.Lock()
+	defer flagLock.Unlock()
+	if _, ok := flags[name]; ok {
+		panic(fmt.Sprintf("feature flag %s already defined", name))
+	}
+	f := &Flag{name: name, defaultValue: defaultValue, rules: rules}
+	flags[name] = f
+	return f
+}
+
+// Lookup 按名称查找已经定义的功能开关
+func Lookup(name string) (*Flag, bool) {
+	flagLock.RLock()
+	defer flagLock.RUnlock()
+	f, ok := flags[name]
+	return f, ok
+}
+
+// Names 所有已经定义的功能开关
+func Names() []string {
+	flagLock.RLock()
+	defer flagLock.RUnlock()
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *Flag) Name() string {
+	return f.name
+}
+
+// Evaluate 按用户信息和当前的产品版本判断, user可以为nil
+func (f *Flag) Evaluate(user *fcontext.UserInfo) Decision {
+	defaultValue, rules, source := f.defaultValue, f.rules, "code"
+	if o, ok := loadOverrides()[f.name]; ok {
+		source = "remote"
+		if o.Default != nil {
+			defaultValue = *o.Default
+		}
+		if o.Rules != nil {
+			rules = o.Rules
+		}
+	}
+
+	edition := fconfig.Current().Edition
+	for i, rule := range rules {
+		if rule.match(f.name, edition, user) {
+			return Decision{Flag: f.name, Enabled: rule.Enabled, Reason: fmt.Sprintf("%s rule[%d]", source, i)}
+		}
+	}
+	return Decision{Flag: f.name, Enabled: defaultValue, Reason: source + " default"}
+}
+
+// Enabled 使用ctx中的用户信息判断, gin中使用 fcontext.FromGin(c) 或 EnabledGin, grpc中直接使用handler的ctx
+func (f *Flag) Enabled(ctx context.Context) bool {
+	user := fcontext.UserInfoFromContext(ctx)
+	d := f.Evaluate(user)
+	log.Debugc(ctx, "feature flag %s=%v reason:%s edition:%s user:%s", d.Flag, d.Enabled, d.Reason, fconfig.Current().Edition, userString(user))
+	return d.Enabled
+}
+
+// EnabledGin gin handler中使用
+func (f *Flag) EnabledGin(c *gin.Context) bool {
+	return f.Enabled(fcontext.FromGin(c))
+}
+
+// EnabledFor 没有ctx时直接传入用户信息, 例如定时任务中按企业判断
+func (f *Flag) EnabledFor(user *fcontext.UserInfo) bool {
+	d := f.Evaluate(user)
+	log.Debugf("feature flag %s=%v reason:%s edition:%s user:%s", d.Flag, d.Enabled, d.Reason, fconfig.Current().Edition, userString(user))
+	return d.Enabled
+}
+
+func userString(user *fcontext.UserInfo) string {
+	if user == nil {
+		return "-"
+	}
+	return fmt.Sprintf("org=%d user=%d", user.OrgId, user.UserId)
+}
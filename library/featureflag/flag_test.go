@@ -0,0 +1,85 @@
+package featureflag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+func TestEvaluate(t *testing.T) {
+	log.InitLogger()
+	old := fconfig.DefaultConfig
+	defer func() {
+		fconfig.DefaultConfig = old
+		fconfig.Refresh()
+	}()
+	fconfig.DefaultConfig.Edition = fconfig.EDITION_PRIVATE
+	fconfig.Refresh()
+
+	flag := Define("test_evaluate", false,
+		ForOrgs(2).Disabled(),
+		ForEditions(fconfig.EDITION_SAAS),
+		ForUsers(7),
+	)
+	assert.False(t, flag.EnabledFor(nil))
+	assert.True(t, flag.EnabledFor(&fcontext.UserInfo{UserId: 7, OrgId: 1}))
+	assert.False(t, flag.EnabledFor(&fcontext.UserInfo{UserId: 7, OrgId: 2}))
+
+	fconfig.DefaultConfig.Edition = fconfig.EDITION_SAAS
+	fconfig.Refresh()
+	ctx := fcontext.UserInfoWithContext(context.Background(), &fcontext.UserInfo{UserId: 1, OrgId: 1})
+	assert.True(t, flag.Enabled(ctx))
+	assert.Equal(t, Decision{Flag: "test_evaluate", Enabled: true, Reason: "code rule[1]"}, flag.Evaluate(&fcontext.UserInfo{OrgId: 1}))
+
+	assert.Panics(t, func() { Define("test_evaluate", true) })
+}
+
+func TestPercentage(t *testing.T) {
+	log.InitLogger()
+	flag := Define("test_percentage", false, ForPercentage(30))
+	enabled := 0
+	for orgId := int64(1); orgId <= 1000; orgId++ {
+		user := &fcontext.UserInfo{OrgId: orgId}
+		result := flag.EnabledFor(user)
+		// 同一个企业的结果固定
+		assert.Equal(t, result, flag.EnabledFor(user))
+		if result {
+			enabled++
+		}
+	}
+	assert.InDelta(t, 300, enabled, 60)
+}
+
+func TestRemoteOverride(t *testing.T) {
+	log.InitLogger()
+	old := fconfig.DefaultConfig
+	defer func() {
+		fconfig.DefaultConfig = old
+		fconfig.Refresh()
+	}()
+	flag := Define("test_remote", false)
+	assert.False(t, flag.EnabledFor(nil))
+
+	fconfig.DefaultConfig.FeatureFlags = `{"test_remote": {"rules": [{"orgIds": [5], "enabled": true}]}}`
+	fconfig.Refresh()
+	assert.True(t, flag.EnabledFor(&fcontext.UserInfo{OrgId: 5}))
+	assert.Equal(t, "remote default", flag.Evaluate(&fcontext.UserInfo{OrgId: 6}).Reason)
+
+	// 解析失败时保留上一次的覆盖值
+	fconfig.DefaultConfig.FeatureFlags = `{bad json`
+	fconfig.Refresh()
+	assert.True(t, flag.EnabledFor(&fcontext.UserInfo{OrgId: 5}))
+
+	fconfig.DefaultConfig.FeatureFlags = `{"test_remote": {"default": true}}`
+	fconfig.Refresh()
+	assert.True(t, flag.EnabledFor(&fcontext.UserInfo{OrgId: 6}))
+
+	fconfig.DefaultConfig.FeatureFlags = ""
+	fconfig.Refresh()
+	assert.False(t, flag.EnabledFor(&fcontext.UserInfo{OrgId: 5}))
+}
@@ -0,0 +1,61 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// 配置 FEATURE_FLAGS 是开关名到覆盖值的json, 只覆盖设置了的部分, 例如
+//
+//	{"new_portal": {"default": true}, "ai_assistant": {"rules": [{"orgIds": [10001], "enabled": true}]}}
+//
+// 放在registry中时作为字符串配置, 变更后通过 fconfig.OnChange 热更新
+
+// override 远程配置对代码中定义的覆盖, Rules不为nil时替换全部规则
+type override struct {
+	Default *bool  `json:"default,omitempty"`
+	Rules   []Rule `json:"rules,omitempty"`
+}
+
+var (
+	overrides     atomic.Pointer[map[string]override]
+	overridesOnce sync.Once
+)
+
+func loadOverrides() map[string]override {
+	overridesOnce.Do(func() {
+		storeOverrides(fconfig.Current().FeatureFlags)
+		fconfig.OnChange(func(old, new *fconfig.Config) {
+			if old.FeatureFlags != new.FeatureFlags {
+				storeOverrides(new.FeatureFlags)
+			}
+		})
+	})
+	if m := overrides.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// storeOverrides 解析失败时保留上一次的覆盖值
+func storeOverrides(raw string) {
+	m := make(map[string]override)
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			log.Errorf("feature flag parse FEATURE_FLAGS err: %s", err)
+			return
+		}
+	}
+	for name := range m {
+		if _, ok := Lookup(name); !ok {
+			log.Warnf("feature flag %s in FEATURE_FLAGS is not defined", name)
+		}
+	}
+	overrides.Store(&m)
+	log.Infof("feature flag overrides updated: %s", raw)
+}
@@ -0,0 +1,122 @@
+package fgrpc
+
+import (
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	_ "google.golang.org/grpc/health" // 注册客户端健康检查
+	"google.golang.org/grpc/resolver"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/discovery/registry"
+)
+
+// 负载均衡策略, 与 GRPC_LB_POLICY 对应
+const (
+	weightedBalancerName = "fc_weighted"      // 按实例元数据 weight 加权轮询
+	zoneBalancerName     = "fc_zone_weighted" // 优先同 SERVICE_ZONE 的实例, 再加权轮询
+)
+
+// 地址属性中的实例元数据, 使用可比较的值, 地址不变时grpc可以复用连接
+type weightKey struct{}
+type zoneKey struct{}
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(weightedBalancerName, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(base.NewBalancerBuilder(zoneBalancerName, &weightedPickerBuilder{zoneAware: true}, base.Config{HealthCheck: true}))
+}
+
+// instanceAttributes 实例的weight和zone写入地址属性, weight缺省或不合法时为1
+func instanceAttributes(ins *registry.Instance) *attributes.Attributes {
+	weight, err := strconv.Atoi(ins.Metadata[registry.MetadataWeight])
+	if err != nil || weight <= 0 {
+		weight = 1
+	}
+	return attributes.New(weightKey{}, weight).WithValue(zoneKey{}, ins.Metadata[registry.MetadataZone])
+}
+
+// lbServiceConfig GRPC_LB_POLICY 对应的grpc service config
+// 开启客户端健康检查, 实例的grpc.health.v1返回NOT_SERVING(比如正在退出)时不再选择该实例, 没有注册健康服务的实例视为健康
+func lbServiceConfig(policy string) string {
+	name := "round_robin"
+	switch policy {
+	case "weighted":
+		name = weightedBalancerName
+	case "zone":
+		name = zoneBalancerName
+	}
+	return `{"loadBalancingPolicy": "` + name + `", "healthCheckConfig": {"serviceName": ""}}`
+}
+
+type weightedPickerBuilder struct {
+	zoneAware bool
+}
+
+func (b *weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	var all, local []*weightedSubConn
+	zone := fconfig.DefaultConfig.ServiceZone
+	for sc, scInfo := range info.ReadySCs {
+		wsc := &weightedSubConn{subConn: sc, weight: 1}
+		if weight, ok := scInfo.Address.Attributes.Value(weightKey{}).(int); ok {
+			wsc.weight = weight
+		}
+		all = append(all, wsc)
+		if insZone, _ := scInfo.Address.Attributes.Value(zoneKey{}).(string); zone != "" && insZone == zone {
+			local = append(local, wsc)
+		}
+	}
+	// 同zone没有可用的实例时使用全部实例
+	if b.zoneAware && len(local) > 0 {
+		return &weightedPicker{subConns: local}
+	}
+	return &weightedPicker{subConns: all}
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	weight  int
+	current int
+}
+
+// weightedPicker 平滑加权轮询, 与nginx一致, 权重相同时等价于轮询
+type weightedPicker struct {
+	lock     sync.Mutex
+	subConns []*weightedSubConn
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	total := 0
+	var best *weightedSubConn
+	for _, sc := range p.subConns {
+		sc.current += sc.weight
+		total += sc.weight
+		if best == nil || sc.current > best.current {
+			best = sc
+		}
+	}
+	best.current -= total
+	return balancer.PickResult{SubConn: best.subConn}, nil
+}
+
+// addressesOf 实例转换为grpc地址
+func addressesOf(name string, instances []*registry.Instance) []resolver.Address {
+	addrs := make([]resolver.Address, 0, len(instances))
+	for _, ins := range instances {
+		addrs = append(addrs, resolver.Address{
+			Addr:       ins.Addr(),
+			ServerName: name,
+			Attributes: instanceAttributes(ins),
+		})
+	}
+	return addrs
+}
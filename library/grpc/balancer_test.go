@@ -0,0 +1,126 @@
+package fgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/discovery/registry"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func buildInfo(instances ...*registry.Instance) (base.PickerBuildInfo, map[balancer.SubConn]string) {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	names := make(map[balancer.SubConn]string)
+	for _, addr := range addressesOf("svc", instances) {
+		sc := &fakeSubConn{addr: addr.Addr}
+		info.ReadySCs[sc] = base.SubConnInfo{Address: addr}
+		names[sc] = addr.Addr
+	}
+	return info, names
+}
+
+func pickCounts(t *testing.T, picker balancer.Picker, names map[balancer.SubConn]string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		res, err := picker.Pick(balancer.PickInfo{})
+		assert.Nil(t, err)
+		counts[names[res.SubConn]]++
+	}
+	return counts
+}
+
+func TestWeightedPicker(t *testing.T) {
+	info, names := buildInfo(
+		&registry.Instance{Address: "10.0.0.1", Port: 9090, Metadata: map[string]string{registry.MetadataWeight: "3"}},
+		&registry.Instance{Address: "10.0.0.2", Port: 9090},
+		&registry.Instance{Address: "10.0.0.3", Port: 9090, Metadata: map[string]string{registry.MetadataWeight: "bad"}},
+	)
+	counts := pickCounts(t, (&weightedPickerBuilder{}).Build(info), names, 500)
+	assert.Equal(t, map[string]int{"10.0.0.1:9090": 300, "10.0.0.2:9090": 100, "10.0.0.3:9090": 100}, counts)
+
+	_, err := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+}
+
+func TestZonePicker(t *testing.T) {
+	old := fconfig.DefaultConfig.ServiceZone
+	defer func() { fconfig.DefaultConfig.ServiceZone = old }()
+	fconfig.DefaultConfig.ServiceZone = "sh"
+
+	info, names := buildInfo(
+		&registry.Instance{Address: "10.0.0.1", Port: 9090, Metadata: map[string]string{registry.MetadataZone: "sh"}},
+		&registry.Instance{Address: "10.0.0.2", Port: 9090, Metadata: map[string]string{registry.MetadataZone: "bj"}},
+	)
+	counts := pickCounts(t, (&weightedPickerBuilder{zoneAware: true}).Build(info), names, 10)
+	assert.Equal(t, map[string]int{"10.0.0.1:9090": 10}, counts)
+
+	// 同zone没有实例时使用全部实例
+	fconfig.DefaultConfig.ServiceZone = "gz"
+	counts = pickCounts(t, (&weightedPickerBuilder{zoneAware: true}).Build(info), names, 10)
+	assert.Equal(t, map[string]int{"10.0.0.1:9090": 5, "10.0.0.2:9090": 5}, counts)
+}
+
+func TestLastKnown(t *testing.T) {
+	old := fconfig.DefaultConfig.GRPCResolverCacheDir
+	defer func() { fconfig.DefaultConfig.GRPCResolverCacheDir = old }()
+	fconfig.DefaultConfig.GRPCResolverCacheDir = t.TempDir()
+
+	instances := []*registry.Instance{{ID: "1", Name: "svc-cache", Address: "10.0.0.1", Port: 9090}}
+	storeLastKnown("svc-cache", instances)
+	assert.Equal(t, instances, loadLastKnown("svc-cache"))
+
+	// 进程重启后从文件读取
+	lastKnown.Delete("svc-cache")
+	assert.Equal(t, instances, loadLastKnown("svc-cache"))
+	assert.Nil(t, loadLastKnown("svc-unknown"))
+	assert.Equal(t, []resolver.Address{{Addr: "10.0.0.1:9090", ServerName: "svc-cache", Attributes: instanceAttributes(instances[0])}}, addressesOf("svc-cache", instances))
+}
+
+func TestBalancerHealthCheck(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(lbServiceConfig("weighted")),
+	)
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	// NOT_SERVING的实例不会被选择
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	assert.Nil(t, err)
+}
@@ -1,12 +1,10 @@
 package fgrpc
 
 import (
-	_ "github.com/mbobakov/grpc-consul-resolver"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
 	fconfig "github.com/lzw5399/go-common-public/library/config"
-	"github.com/lzw5399/go-common-public/library/grpc/interceptor"
 	"github.com/lzw5399/go-common-public/library/util"
 )
 
@@ -14,20 +12,26 @@ func GetConn(serverName string) (*grpc.ClientConn, error) {
 	cfg := fconfig.DefaultConfig
 	switch cfg.GRPCDiscoveryMode {
 	case "direct": // serverName是「服务名或ip:port」
-		return dialGrpcConn(serverName)
+		return dialGrpcConn(serverName, serverName)
 	default:
-		return getGrpcConnManager().getConn(cfg.RegistryAddr, serverName, "tag="+cfg.RegistryTag)
+		return getGrpcConnManager().getConn(serverName, registryTarget(serverName))
 	}
 }
 
-func dialGrpcConn(target string) (*grpc.ClientConn, error) {
+// registryTarget 通过 registry.ServiceRegistry 的watch解析, 见 resolver.go
+func registryTarget(serverName string) string {
+	return registryScheme + ":///" + serverName
+}
+
+// dialGrpcConn 拦截器的超时, 重试和熔断策略按serverName配置, 见 clientPolicy
+func dialGrpcConn(serverName, target string) (*grpc.ClientConn, error) {
 	options := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(interceptor.OutgoingMetadataInterceptor),
+		grpc.WithChainUnaryInterceptor(clientInterceptors(serverName)...),
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(util.MB * 500)),
 	}
 	if fconfig.DefaultConfig.GRPCRoundRobin {
-		options = append(options, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "round_robin"}`))
+		options = append(options, grpc.WithDefaultServiceConfig(lbServiceConfig(fconfig.DefaultConfig.GRPCLBPolicy)))
 	}
 
 	conn, err := grpc.Dial(
@@ -0,0 +1,53 @@
+package fgrpc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"google.golang.org/grpc"
+)
+
+var defaultGrpcConnectManager grpcConnectManager
+
+func getGrpcConnManager() *grpcConnectManager {
+	return &defaultGrpcConnectManager
+}
+
+type grpcConnectItem struct { // 单个连接建立，例如：和账号系统多实例连接上，一个item可以理解为对应一个mop服务多实例的连接
+	ClientConn unsafe.Pointer
+	ServerName string
+}
+
+type grpcConnectManager struct {
+	CreateLock         sync.Mutex // 防止多协程同时建立连接
+	GrpcConnectItemMap sync.Map   // 服务名 -> *grpcConnectItem, 一开始是空
+}
+
+// getConn target是服务对应的grpc地址, 见 registryTarget
+// 实例的变化由resolver推送给负载均衡, 连接建立之后一直复用, 不需要检查连接状态重新建立
+func (g *grpcConnectManager) getConn(server, target string) (*grpc.ClientConn, error) {
+	if connItem, ok := g.GrpcConnectItemMap.Load(server); ok { // first check
+		return (*grpc.ClientConn)(atomic.LoadPointer(&connItem.(*grpcConnectItem).ClientConn)), nil
+	}
+
+	g.CreateLock.Lock()
+	defer g.CreateLock.Unlock()
+
+	if connItem, ok := g.GrpcConnectItemMap.Load(server); ok { // double check
+		return (*grpc.ClientConn)(atomic.LoadPointer(&connItem.(*grpcConnectItem).ClientConn)), nil
+	}
+
+	fmt.Println("new conn, url=" + target)
+	cli, err := dialGrpcConn(server, target)
+	if err != nil {
+		return nil, err
+	}
+
+	newItem := &grpcConnectItem{ServerName: server}
+	atomic.StorePointer(&newItem.ClientConn, unsafe.Pointer(cli))
+	g.GrpcConnectItemMap.Store(server, newItem)
+
+	return cli, nil
+}
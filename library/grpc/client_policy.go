@@ -0,0 +1,178 @@
+package fgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/grpc/interceptor"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// clientPolicy 调用一个服务的超时, 重试和熔断策略, 默认值为 GRPC_CLIENT_* 配置
+// GRPC_CLIENT_POLICIES 按服务名覆盖其中的部分字段, methods 再按方法名覆盖超时和重试, 熔断按服务统计, 不支持按方法覆盖
+//
+//	{"finclip-cloud-user-system": {"timeoutMs": 2000, "retryMax": 0, "breakerFailureRatio": 0.3,
+//	    "methods": {"Export": {"timeoutMs": 30000}, "/user.UserService/GetUser": {"retryMax": 3}}}}
+//
+// 方法名可以是完整方法名或者只有方法名, 完整方法名优先. 在建立连接时生效, 连接建立之后一直复用
+type clientPolicy struct {
+	TimeoutMs            int     `json:"timeoutMs"`
+	RetryMax             int     `json:"retryMax"`
+	RetryBackoffMs       int     `json:"retryBackoffMs"`
+	RetryCodes           string  `json:"retryCodes"`
+	IdempotentMethods    string  `json:"idempotentMethods"`
+	BreakerFailureRatio  float64 `json:"breakerFailureRatio"`
+	BreakerMinRequests   int     `json:"breakerMinRequests"`
+	BreakerWindowSeconds int     `json:"breakerWindowSeconds"`
+	BreakerOpenSeconds   int     `json:"breakerOpenSeconds"`
+
+	Methods map[string]json.RawMessage `json:"methods"`
+}
+
+// retryMaxBackoff 重试退避时间的上限
+const retryMaxBackoff = time.Second
+
+func clientPolicyOf(cfg *fconfig.Config, server string) clientPolicy {
+	policy := clientPolicy{
+		TimeoutMs:            cfg.GRPCClientTimeoutMs,
+		RetryMax:             cfg.GRPCClientRetryMax,
+		RetryBackoffMs:       cfg.GRPCClientRetryBackoffMs,
+		RetryCodes:           cfg.GRPCClientRetryCodes,
+		IdempotentMethods:    cfg.GRPCClientIdempotentMethods,
+		BreakerFailureRatio:  cfg.GRPCClientBreakerFailureRatio,
+		BreakerMinRequests:   cfg.GRPCClientBreakerMinRequests,
+		BreakerWindowSeconds: cfg.GRPCClientBreakerWindowSeconds,
+		BreakerOpenSeconds:   cfg.GRPCClientBreakerOpenSeconds,
+	}
+	if strings.TrimSpace(cfg.GRPCClientPolicies) == "" {
+		return policy
+	}
+
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(cfg.GRPCClientPolicies), &overrides); err != nil {
+		log.Errorf("grpc client parse GRPC_CLIENT_POLICIES err: %s", err)
+		return policy
+	}
+	if raw, ok := overrides[server]; ok {
+		// 只覆盖json中出现的字段
+		if err := json.Unmarshal(raw, &policy); err != nil {
+			log.Errorf("grpc client parse GRPC_CLIENT_POLICIES of %s err: %s", server, err)
+		}
+	}
+	return policy
+}
+
+// methodPolicies 按方法名覆盖之后的策略, 没有覆盖的方法使用服务的策略
+func (p clientPolicy) methodPolicies(server string) map[string]clientPolicy {
+	if len(p.Methods) == 0 {
+		return nil
+	}
+	result := make(map[string]clientPolicy, len(p.Methods))
+	for method, raw := range p.Methods {
+		policy := p
+		policy.Methods = nil
+		if err := json.Unmarshal(raw, &policy); err != nil {
+			log.Errorf("grpc client parse GRPC_CLIENT_POLICIES of %s method %s err: %s", server, method, err)
+			continue
+		}
+		result[method] = policy
+	}
+	return result
+}
+
+func (p clientPolicy) retryPolicy() interceptor.RetryPolicy {
+	return interceptor.RetryPolicy{
+		MaxRetries:        p.RetryMax,
+		Backoff:           time.Duration(p.RetryBackoffMs) * time.Millisecond,
+		MaxBackoff:        retryMaxBackoff,
+		Codes:             parseCodes(p.RetryCodes),
+		IdempotentMethods: splitTrim(p.IdempotentMethods),
+	}
+}
+
+func (p clientPolicy) breakerPolicy() interceptor.BreakerPolicy {
+	return interceptor.BreakerPolicy{
+		FailureRatio: p.BreakerFailureRatio,
+		MinRequests:  p.BreakerMinRequests,
+		Window:       time.Duration(p.BreakerWindowSeconds) * time.Second,
+		OpenTimeout:  time.Duration(p.BreakerOpenSeconds) * time.Second,
+	}
+}
+
+// clientInterceptors 调用server的拦截器, 顺序为: 元数据, 指标, 总超时, 重试, 熔断
+func clientInterceptors(server string) []grpc.UnaryClientInterceptor {
+	policy := clientPolicyOf(&fconfig.DefaultConfig, server)
+	methods := policy.methodPolicies(server)
+	timeouts := make(map[string]grpc.UnaryClientInterceptor, len(methods))
+	retries := make(map[string]grpc.UnaryClientInterceptor, len(methods))
+	for method, p := range methods {
+		timeouts[method] = interceptor.TimeoutInterceptor(time.Duration(p.TimeoutMs) * time.Millisecond)
+		retries[method] = interceptor.RetryInterceptor(server, p.retryPolicy())
+	}
+	return []grpc.UnaryClientInterceptor{
+		interceptor.OutgoingMetadataInterceptor,
+		interceptor.ClientMetricsInterceptor(server),
+		perMethod(interceptor.TimeoutInterceptor(time.Duration(policy.TimeoutMs)*time.Millisecond), timeouts),
+		perMethod(interceptor.RetryInterceptor(server, policy.retryPolicy()), retries),
+		interceptor.BreakerInterceptor(interceptor.NewBreaker(server, policy.breakerPolicy())),
+	}
+}
+
+// perMethod 按完整方法名或者方法名选择拦截器, 都没有时使用def
+func perMethod(def grpc.UnaryClientInterceptor, methods map[string]grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	if len(methods) == 0 {
+		return def
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		selected, ok := methods[method]
+		if !ok {
+			selected, ok = methods[method[strings.LastIndex(method, "/")+1:]]
+		}
+		if !ok {
+			selected = def
+		}
+		return selected(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+// parseCodes 状态码名称, 例如 UNAVAILABLE 或 Unavailable, 不认识的忽略
+func parseCodes(s string) []codes.Code {
+	var result []codes.Code
+	for _, name := range splitTrim(s) {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(camelToSnake(name)) + `"`)); err != nil {
+			log.Warnf("grpc client unknown status code %s", name)
+			continue
+		}
+		result = append(result, code)
+	}
+	return result
+}
+
+// camelToSnake ResourceExhausted -> Resource_Exhausted, 已经是大写下划线的保持不变
+func camelToSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && r >= 'A' && r <= 'Z' && s[i-1] >= 'a' && s[i-1] <= 'z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func splitTrim(s string) []string {
+	var result []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package fgrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+func TestClientPolicyOf(t *testing.T) {
+	log.InitLogger()
+	cfg := fconfig.Config{}
+	cfg.GRPCClientTimeoutMs = 5000
+	cfg.GRPCClientRetryMax = 2
+	cfg.GRPCClientRetryBackoffMs = 50
+	cfg.GRPCClientRetryCodes = "UNAVAILABLE, ResourceExhausted, unknown_code"
+	cfg.GRPCClientIdempotentMethods = "Get,List"
+	cfg.GRPCClientBreakerFailureRatio = 0.5
+	cfg.GRPCClientPolicies = `{"finclip-cloud-user-system": {"timeoutMs": 2000, "retryMax": 0}}`
+
+	policy := clientPolicyOf(&cfg, "finclip-cloud-user-system")
+	assert.Equal(t, 2000, policy.TimeoutMs)
+	assert.Equal(t, 0, policy.RetryMax)
+	assert.Equal(t, 50, policy.RetryBackoffMs)
+	assert.Equal(t, 0.5, policy.BreakerFailureRatio)
+
+	policy = clientPolicyOf(&cfg, "finclip-cloud-app-manager")
+	assert.Equal(t, 5000, policy.TimeoutMs)
+	retry := policy.retryPolicy()
+	assert.Equal(t, 2, retry.MaxRetries)
+	assert.Equal(t, 50*time.Millisecond, retry.Backoff)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, retry.Codes)
+	assert.True(t, retry.Idempotent("/app.AppManager/GetApp"))
+	assert.False(t, retry.Idempotent("/app.AppManager/CreateApp"))
+
+	// 配置错误时使用默认值
+	cfg.GRPCClientPolicies = `{invalid`
+	assert.Equal(t, 5000, clientPolicyOf(&cfg, "finclip-cloud-user-system").TimeoutMs)
+}
+
+func TestClientPolicyMethods(t *testing.T) {
+	log.InitLogger()
+	cfg := fconfig.Config{}
+	cfg.GRPCClientRetryMax = 2
+	cfg.GRPCClientPolicies = `{"svc": {"timeoutMs": 2000, "methods": {"Export": {"timeoutMs": 30000}, "/svc.Svc/GetUser": {"retryMax": 0}}}}`
+
+	policy := clientPolicyOf(&cfg, "svc")
+	methods := policy.methodPolicies("svc")
+	assert.Equal(t, 30000, methods["Export"].TimeoutMs)
+	assert.Equal(t, 2, methods["Export"].RetryMax)
+	assert.Equal(t, 2000, methods["/svc.Svc/GetUser"].TimeoutMs)
+	assert.Equal(t, 0, methods["/svc.Svc/GetUser"].RetryMax)
+	assert.Nil(t, clientPolicyOf(&cfg, "other").methodPolicies("other"))
+
+	// 完整方法名优先, 其次方法名, 都没有时使用服务的拦截器
+	var selected string
+	named := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			selected = name
+			return nil
+		}
+	}
+	chained := perMethod(named("default"), map[string]grpc.UnaryClientInterceptor{
+		"Export":           named("Export"),
+		"/svc.Svc/GetUser": named("GetUser"),
+	})
+	for method, want := range map[string]string{
+		"/svc.Svc/Export":  "Export",
+		"/svc.Svc/GetUser": "GetUser",
+		"/svc.Svc/Create":  "default",
+	} {
+		assert.Nil(t, chained(context.Background(), method, nil, nil, nil, nil))
+		assert.Equal(t, want, selected, method)
+	}
+}
@@ -0,0 +1,124 @@
+package interceptor
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/metric"
+)
+
+// TimeoutInterceptor 调用的ctx没有deadline时使用默认超时, 包含所有重试, timeout<=0时不限制
+func TimeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ClientMetricsInterceptor 记录调用次数和耗时, 放在重试之前, 重试只记录一次
+func ClientMetricsInterceptor(target string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		service := metric.ServiceName()
+		metric.GRPCClientRequestCounter.WithLabelValues(target, method, status.Code(err).String(), service).Inc()
+		metric.GRPCClientDurationHistogram.WithLabelValues(target, method, service).Observe(float64(time.Since(start)) / float64(time.Millisecond))
+		return err
+	}
+}
+
+// RetryPolicy 只重试幂等的方法, 退避时间为 [0, min(MaxBackoff, Backoff*2^n)) 的随机值
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Codes      []codes.Code
+	// IdempotentMethods 方法名的前缀, 例如Get; 或者完整方法名, 例如/package.Service/Method
+	IdempotentMethods []string
+}
+
+// Idempotent method为grpc的完整方法名
+func (p RetryPolicy) Idempotent(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, m := range p.IdempotentMethods {
+		if strings.HasPrefix(m, "/") {
+			if m == method {
+				return true
+			}
+		} else if m != "" && strings.HasPrefix(name, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if err == ErrCircuitOpen { // 熔断时重试也会被拒绝
+		return false
+	}
+	code := status.Code(err)
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	backoff := p.Backoff
+	for i := 0; i < retry && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// RetryInterceptor 幂等方法返回可重试的状态码时重试, 剩余时间不够退避时直接返回最后一次的错误
+func RetryInterceptor(target string, policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if policy.MaxRetries <= 0 || !policy.Idempotent(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		var err error
+		for retry := 0; ; retry++ {
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || retry >= policy.MaxRetries || !policy.retryable(err) {
+				return err
+			}
+
+			backoff := policy.backoff(retry)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+				return err
+			}
+			log.Warnf("grpc client retry %s%s (retry=%d, backoff=%s), err: %s", target, method, retry+1, backoff, err)
+			metric.GRPCClientRetryCounter.WithLabelValues(target, method, status.Code(err).String(), metric.ServiceName()).Inc()
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package interceptor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/metric"
+)
+
+// ErrCircuitOpen 熔断器打开时直接返回, 不请求下游
+var ErrCircuitOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行, 统计失败比例
+	BreakerHalfOpen                     // 放行少量探测请求, 全部成功后关闭, 任意失败重新打开
+	BreakerOpen                         // 拒绝所有请求, 经过 OpenTimeout 后进入半开
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// BreakerPolicy FailureRatio<=0时不熔断
+type BreakerPolicy struct {
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	OpenTimeout      time.Duration
+	HalfOpenRequests int // 半开状态放行的探测请求数, 默认1
+}
+
+// Breaker 一个下游服务的熔断器, 只有下游不可用类的错误计为失败, 业务错误不影响熔断
+type Breaker struct {
+	target string
+	policy BreakerPolicy
+
+	lock        sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // 半开状态已放行的探测请求
+	successes   int // 半开状态成功的探测请求
+}
+
+func NewBreaker(target string, policy BreakerPolicy) *Breaker {
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = 1
+	}
+	b := &Breaker{target: target, policy: policy, windowStart: time.Now()}
+	metric.GRPCClientBreakerStateGauge.WithLabelValues(target, metric.ServiceName()).Set(float64(BreakerClosed))
+	return b
+}
+
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow 允许请求时返回true, 请求结束后需要调用 Done
+func (b *Breaker) Allow() bool {
+	if b.policy.FailureRatio <= 0 {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probes >= b.policy.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// Done 记录请求结果
+func (b *Breaker) Done(err error) {
+	if b.policy.FailureRatio <= 0 {
+		return
+	}
+
+	failed := isBreakerFailure(err)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.refresh(now)
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.policy.MinRequests && float64(b.failures)/float64(b.requests) >= b.policy.FailureRatio {
+			b.setState(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.policy.HalfOpenRequests {
+			b.setState(BreakerClosed, now)
+		}
+	}
+}
+
+// refresh 打开超时后进入半开, 统计窗口到期后重新统计
+func (b *Breaker) refresh(now time.Time) {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) >= b.policy.OpenTimeout {
+			b.setState(BreakerHalfOpen, now)
+		}
+	case BreakerClosed:
+		if b.policy.Window > 0 && now.Sub(b.windowStart) >= b.policy.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+}
+
+func (b *Breaker) setState(state BreakerState, now time.Time) {
+	if state == BreakerOpen {
+		log.Errorf("grpc client circuit breaker of %s open (state=%s, requests=%d, failures=%d)", b.target, b.state, b.requests, b.failures)
+	} else {
+		log.Warnf("grpc client circuit breaker of %s changed from %s to %s", b.target, b.state, state)
+	}
+	b.state = state
+	b.openedAt = now
+	b.windowStart, b.requests, b.failures = now, 0, 0
+	b.probes, b.successes = 0, 0
+	metric.GRPCClientBreakerStateGauge.WithLabelValues(b.target, metric.ServiceName()).Set(float64(state))
+}
+
+// isBreakerFailure 只有下游不可用类的错误计为失败, 调用方取消不计
+func isBreakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
+
+// BreakerInterceptor 放在重试之后, 每次重试都经过熔断器
+func BreakerInterceptor(b *Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.Allow() {
+			metric.GRPCClientBreakerRejectCounter.WithLabelValues(b.target, method, metric.ServiceName()).Inc()
+			return ErrCircuitOpen
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.Done(err)
+		return err
+	}
+}
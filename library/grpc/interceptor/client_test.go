@@ -0,0 +1,138 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// countingInvoker 依次返回errs中的错误, 超出之后返回nil
+func countingInvoker(calls *int, errs ...error) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	log.InitLogger()
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	policy := RetryPolicy{
+		MaxRetries:        2,
+		Backoff:           time.Millisecond,
+		Codes:             []codes.Code{codes.Unavailable},
+		IdempotentMethods: []string{"Get", "/pkg.Svc/Sync"},
+	}
+	retry := RetryInterceptor("user-system", policy)
+
+	// 幂等方法重试直到成功
+	calls := 0
+	err := retry(context.Background(), "/pkg.Svc/GetUser", nil, nil, nil, countingInvoker(&calls, unavailable, unavailable))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	// 超过最大重试次数
+	calls = 0
+	err = retry(context.Background(), "/pkg.Svc/Sync", nil, nil, nil, countingInvoker(&calls, unavailable, unavailable, unavailable))
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 3, calls)
+
+	// 非幂等方法不重试
+	calls = 0
+	err = retry(context.Background(), "/pkg.Svc/CreateUser", nil, nil, nil, countingInvoker(&calls, unavailable))
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 1, calls)
+
+	// 不可重试的状态码
+	calls = 0
+	invalid := status.Error(codes.InvalidArgument, "bad request")
+	err = retry(context.Background(), "/pkg.Svc/GetUser", nil, nil, nil, countingInvoker(&calls, invalid))
+	assert.Equal(t, invalid, err)
+	assert.Equal(t, 1, calls)
+
+	// 熔断时不重试
+	calls = 0
+	err = retry(context.Background(), "/pkg.Svc/GetUser", nil, nil, nil, countingInvoker(&calls, ErrCircuitOpen))
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		assert.Less(t, policy.backoff(0), 10*time.Millisecond)
+		assert.Less(t, policy.backoff(5), 30*time.Millisecond)
+	}
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	timeout := TimeoutInterceptor(time.Second)
+	var deadline time.Time
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	}
+
+	assert.Nil(t, timeout(context.Background(), "/pkg.Svc/GetUser", nil, nil, nil, invoker))
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	// 已经设置了deadline时不修改
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	assert.Nil(t, timeout(ctx, "/pkg.Svc/GetUser", nil, nil, nil, invoker))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, 100*time.Millisecond)
+}
+
+func TestBreaker(t *testing.T) {
+	log.InitLogger()
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	b := NewBreaker("user-system", BreakerPolicy{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		OpenTimeout:  50 * time.Millisecond,
+	})
+	call := func(err error) error {
+		return BreakerInterceptor(b)(context.Background(), "/pkg.Svc/GetUser", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return err
+			})
+	}
+
+	// 业务错误不计为失败
+	for i := 0; i < 4; i++ {
+		_ = call(status.Error(codes.NotFound, "not found"))
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	for i := 0; i < 3; i++ {
+		_ = call(unavailable)
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+	_ = call(unavailable)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, call(nil))
+
+	// 半开状态只放行一个探测请求, 失败后重新打开
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	b.Done(unavailable)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// 探测成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, call(nil))
+	assert.Equal(t, BreakerClosed, b.State())
+}
@@ -3,7 +3,6 @@ package interceptor
 import (
 	"context"
 	"encoding/json"
-	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
@@ -24,7 +23,7 @@ func OutgoingMetadataInterceptor(ctx context.Context, method string, req, reply
 	pairs.Set(fcontext.HeaderCaller, caller)
 
 	// past caller
-	pastCaller := mergeCurrentCallerToPastCaller(ctx)
+	pastCaller := fcontext.MergePastCaller(ctx)
 	pairs.Set(fcontext.HeaderPastCaller, pastCaller)
 
 	// lang
@@ -127,32 +126,3 @@ func InComingMetadataInterceptor(ctx context.Context, req interface{}, info *grp
 	}
 	return resp, err
 }
-
-func mergeCurrentCallerToPastCaller(ctx context.Context) string {
-	pastCallerObj := ctx.Value(fcontext.HeaderPastCaller)
-	pastCaller, ok := pastCallerObj.(string)
-	if !ok {
-		pastCaller = ""
-	}
-
-	currentCallerObj := ctx.Value(fcontext.HeaderCaller)
-	currentCaller, ok := currentCallerObj.(string)
-	if !ok {
-		currentCaller = ""
-	}
-
-	// 将当前caller添加到已有的 pastCaller 中
-	pastArr := strings.Split(pastCaller, ",")
-	pastArr = append(pastArr, currentCaller)
-	pastCaller = strings.Join(pastArr, ",")
-
-	trimmedArr := make([]string, 0, len(pastArr))
-	for _, v := range pastArr {
-		if v == "" {
-			continue
-		}
-		trimmedArr = append(trimmedArr, v)
-	}
-
-	return strings.Join(trimmedArr, ",")
-}
@@ -9,6 +9,7 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/health"
 	"github.com/lzw5399/go-common-public/library/log"
 	fpb "github.com/lzw5399/go-common-public/library/pb"
 )
@@ -19,6 +20,16 @@ type Ping interface {
 
 const maxRetry = 60
 
+// PingCheck ping依赖的grpc服务, 用于 health.Register
+//
+//	health.Register("grpc-user", fgrpc.PingCheck(userClient))
+func PingCheck(cli Ping) health.Checker {
+	return func(ctx context.Context) error {
+		_, err := cli.Ping(ctx, &emptypb.Empty{})
+		return err
+	}
+}
+
 // EnsureGRPCServiceAlive 因为服务间有依赖，为了确保依赖的服务已经启动，需要在启动时检查依赖的服务是否已经启动
 func EnsureGRPCServiceAlive(clients ...Ping) {
 	ctx := fcontext.Background()
@@ -0,0 +1,141 @@
+package fgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/discovery/registry"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// registryScheme 通过 registry.ServiceRegistry 的watch解析服务, target为 registry:///{服务名}
+// consul使用blocking query, 实例健康状态变化时立即推送给负载均衡, 不健康的实例不再接收请求
+const registryScheme = "registry"
+
+// resolverRetryInterval 注册中心不可用时重试的间隔
+const resolverRetryInterval = 5 * time.Second
+
+func init() {
+	resolver.Register(&registryResolverBuilder{})
+}
+
+type registryResolverBuilder struct{}
+
+func (b *registryResolverBuilder) Scheme() string {
+	return registryScheme
+}
+
+func (b *registryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	name := strings.TrimPrefix(target.URL.Path, "/")
+	if name == "" {
+		return nil, fmt.Errorf("grpc registry target %s has no service name", target.URL.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &registryResolver{cancel: cancel}
+
+	// 注册中心不可用时先使用上一次的地址, watch成功后替换
+	cached := loadLastKnown(name)
+	if len(cached) > 0 {
+		updateState(cc, name, cached)
+	}
+
+	// 没有缓存的地址时直接返回错误; 有缓存时继续使用缓存, 在后台重试直到注册中心可用
+	r, err := registry.DefaultServiceRegistry()
+	if err != nil && len(cached) == 0 {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		for r == nil {
+			log.Warnf("grpc resolve service(%s) with cached addresses, registry err: %s", name, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resolverRetryInterval):
+			}
+			r, err = registry.DefaultServiceRegistry()
+		}
+		_ = r.Watch(ctx, name, func(instances []*registry.Instance) {
+			// 没有健康的实例时保留上一次的地址, 由grpc的健康检查和重连处理
+			if len(instances) == 0 {
+				cc.ReportError(fmt.Errorf("no healthy instance of service(%s)", name))
+				return
+			}
+			storeLastKnown(name, instances)
+			updateState(cc, name, instances)
+		})
+	}()
+	return res, nil
+}
+
+func updateState(cc resolver.ClientConn, name string, instances []*registry.Instance) {
+	if err := cc.UpdateState(resolver.State{Addresses: addressesOf(name, instances)}); err != nil {
+		log.Errorf("grpc update addresses of service(%s) err: %s", name, err)
+	}
+}
+
+type registryResolver struct {
+	cancel context.CancelFunc
+}
+
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+}
+
+// lastKnown 每个服务最后一次解析到的实例, 配置了 GRPC_RESOLVER_CACHE_DIR 时同时写入文件, 重启后仍然可用
+var lastKnown sync.Map
+
+func storeLastKnown(name string, instances []*registry.Instance) {
+	lastKnown.Store(name, instances)
+
+	dir := fconfig.DefaultConfig.GRPCResolverCacheDir
+	if dir == "" {
+		return
+	}
+	raw, err := json.Marshal(instances)
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		// 先写临时文件再重命名, 避免读到写了一半的文件
+		file := filepath.Join(dir, name+".json")
+		if err = os.WriteFile(file+".tmp", raw, 0644); err == nil {
+			err = os.Rename(file+".tmp", file)
+		}
+	}
+	if err != nil {
+		log.Errorf("grpc cache addresses of service(%s) err: %s", name, err)
+	}
+}
+
+func loadLastKnown(name string) []*registry.Instance {
+	if instances, ok := lastKnown.Load(name); ok {
+		return instances.([]*registry.Instance)
+	}
+
+	dir := fconfig.DefaultConfig.GRPCResolverCacheDir
+	if dir == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil
+	}
+	var instances []*registry.Instance
+	if err := json.Unmarshal(raw, &instances); err != nil {
+		return nil
+	}
+	return instances
+}
@@ -0,0 +1,50 @@
+package fgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+func TestRegistryResolver(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := grpc.NewServer()
+	go s.Serve(lis)
+	defer s.Stop()
+
+	file := filepath.Join(t.TempDir(), "services.json")
+	assert.Nil(t, os.WriteFile(file, []byte(fmt.Sprintf(`{"svc-resolver": ["%s"]}`, lis.Addr())), 0644))
+	old := fconfig.DefaultConfig
+	defer func() { fconfig.DefaultConfig = old }()
+	fconfig.DefaultConfig.ServiceRegistryMode = "static"
+	fconfig.DefaultConfig.RegistryStaticFile = file
+
+	conn, err := grpc.Dial(registryTarget("svc-resolver"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(lbServiceConfig("weighted")),
+	)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			t.Fatalf("conn not ready, state: %s", state)
+		}
+	}
+	assert.Len(t, loadLastKnown("svc-resolver"), 1)
+}
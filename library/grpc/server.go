@@ -1,6 +1,7 @@
 package fgrpc
 
 import (
+	"context"
 	"net"
 
 	"google.golang.org/grpc"
@@ -9,22 +10,27 @@ import (
 	fconfig "github.com/lzw5399/go-common-public/library/config"
 	"github.com/lzw5399/go-common-public/library/discovery/registry"
 	"github.com/lzw5399/go-common-public/library/grpc/interceptor"
+	"github.com/lzw5399/go-common-public/library/health"
+	"github.com/lzw5399/go-common-public/library/lifecycle"
 	"github.com/lzw5399/go-common-public/library/util"
 )
 
 // StartGRPC 启动grpc服务
 func StartGRPC(registerFunc func(s *grpc.Server)) {
-	// 如果服务发现模式是registry的话，把服务注册到consul
-	cfg := fconfig.DefaultConfig
-	if cfg.GRPCDiscoveryMode == "registry" && cfg.RegistryAddr != "" {
-		registry.RegisterService()
-	}
+	registerService()
 
 	// 开启grpc服务
-	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	lis, err := net.Listen("tcp", ":"+fconfig.DefaultConfig.GRPCPort)
 	if err != nil {
 		panic(err)
 	}
+	if err := NewServer(registerFunc).Serve(lis); err != nil {
+		panic(err)
+	}
+}
+
+// NewServer 创建带默认拦截器的grpc服务, registerFunc 中注册具体的服务实现
+func NewServer(registerFunc func(s *grpc.Server)) *grpc.Server {
 	s := grpc.NewServer(
 		grpc.MaxRecvMsgSize(util.MB*500),
 		grpc.MaxSendMsgSize(util.MB*500),
@@ -34,8 +40,31 @@ func StartGRPC(registerFunc func(s *grpc.Server)) {
 		),
 	)
 	registerFunc(s)
+	health.RegisterGRPC(s)
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
-		panic(err)
+	return s
+}
+
+// LifecycleHook 交给 lifecycle.App 管理的grpc服务, 监听 GRPC_PORT 之后注册服务, 退出时 GracefulStop
+// 注销服务由 lifecycle.App 在停止所有组件之前完成
+func LifecycleHook(registerFunc func(s *grpc.Server)) lifecycle.Hook {
+	hook := lifecycle.GRPCServer("grpc", NewServer(registerFunc), ":"+fconfig.DefaultConfig.GRPCPort)
+	listen := hook.OnStart
+	hook.OnStart = func(ctx context.Context) error {
+		if err := listen(ctx); err != nil {
+			return err
+		}
+		registerService()
+		return nil
+	}
+	return hook
+}
+
+// registerService 如果服务发现模式是registry的话，把服务注册到 SERVICE_REGISTRY_MODE 指定的注册中心
+func registerService() {
+	cfg := fconfig.DefaultConfig
+	isConsul := cfg.ServiceRegistryMode == "" || cfg.ServiceRegistryMode == "consul"
+	if cfg.GRPCDiscoveryMode == "registry" && (!isConsul || cfg.RegistryAddr != "") {
+		registry.RegisterService()
 	}
 }
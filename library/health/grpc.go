@@ -0,0 +1,44 @@
+package health
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+var (
+	grpcLock    sync.Mutex
+	grpcServers []*grpchealth.Server
+)
+
+// RegisterGRPC 注册grpc.health.v1服务, 整体服务("")和 SERVER_NAME 的状态与readiness一致
+func RegisterGRPC(s *grpc.Server) {
+	srv := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, srv)
+
+	grpcLock.Lock()
+	grpcServers = append(grpcServers, srv)
+	grpcLock.Unlock()
+	notify()
+}
+
+// notify 检查结果或者serving变化之后同步grpc的健康状态, 状态相同时grpc不会重复推送给Watch
+func notify() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !Ready() {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	grpcLock.Lock()
+	defer grpcLock.Unlock()
+	for _, srv := range grpcServers {
+		srv.SetServingStatus("", status)
+		if name := fconfig.DefaultConfig.ServerName; name != "" {
+			srv.SetServingStatus(name, status)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// 各组件注册健康检查, 后台每隔 HEALTH_CHECK_INTERVAL_SECONDS 执行一次, 结果同时用于:
+//   - http的 /livez 和 /readyz, 见 RegisterHandlers
+//   - grpc.health.v1 服务, 见 RegisterGRPC
+//   - 注册中心的健康检查, consul的http检查和etcd的租约
+//
+// liveness只包含 WithLiveness 的检查, 失败时k8s会重启容器, 因此数据库等外部依赖只应该影响readiness
+
+// Checker 检查失败时返回错误
+type Checker func(ctx context.Context) error
+
+type Status string
+
+const (
+	StatusUp   Status = "UP"
+	StatusDown Status = "DOWN"
+)
+
+var (
+	errNotChecked   = errors.New("not checked yet")
+	errShuttingDown = errors.New("shutting down")
+)
+
+// Result 单个检查的结果
+type Result struct {
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Optional  bool      `json:"optional,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report 所有检查的结果, 只要有一个非optional的检查失败整体就是DOWN
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+type check struct {
+	name     string
+	checker  Checker
+	liveness bool
+	optional bool
+	timeout  time.Duration
+}
+
+type CheckOptionFunc func(c *check)
+
+// WithLiveness 检查同时用于liveness, 只用于进程自身的问题, 例如死锁
+func WithLiveness() CheckOptionFunc {
+	return func(c *check) {
+		c.liveness = true
+	}
+}
+
+// WithOptional 检查失败时只展示结果, 不影响整体状态, 例如非核心的依赖
+func WithOptional() CheckOptionFunc {
+	return func(c *check) {
+		c.optional = true
+	}
+}
+
+// WithTimeout 单个检查的超时时间, 默认为 HEALTH_CHECK_TIMEOUT_SECONDS
+func WithTimeout(timeout time.Duration) CheckOptionFunc {
+	return func(c *check) {
+		c.timeout = timeout
+	}
+}
+
+var (
+	lock     sync.RWMutex
+	checks   []*check
+	results  = make(map[string]Result)
+	serving  atomic.Bool
+	trigger  = make(chan struct{}, 1)
+	loopOnce sync.Once
+)
+
+func init() {
+	serving.Store(true)
+}
+
+// Register 注册检查, 同名的检查会被替换. 注册后在后台立即执行一次
+func Register(name string, checker Checker, opts ...CheckOptionFunc) {
+	c := &check{name: name, checker: checker}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	lock.Lock()
+	replaced := false
+	for i := range checks {
+		if checks[i].name == name {
+			checks[i] = c
+			replaced = true
+		}
+	}
+	if !replaced {
+		checks = append(checks, c)
+	}
+	delete(results, name)
+	lock.Unlock()
+
+	loopOnce.Do(func() {
+		go loop()
+	})
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+}
+
+// SetServing 设置为false时readiness失败, grpc健康状态变为NOT_SERVING, 由 lifecycle 在退出时调用
+func SetServing(s bool) {
+	if serving.Swap(s) != s {
+		notify()
+	}
+}
+
+// Liveness 只包含 WithLiveness 的检查
+func Liveness() Report {
+	return report(true)
+}
+
+// Readiness 包含所有检查, 并且退出过程中为DOWN
+func Readiness() Report {
+	return report(false)
+}
+
+// Ready readiness是否为UP
+func Ready() bool {
+	return Readiness().Status == StatusUp
+}
+
+func report(liveness bool) Report {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	rpt := Report{Status: StatusUp}
+	if !liveness && !serving.Load() {
+		rpt.Status = StatusDown
+		rpt.Checks = append(rpt.Checks, Result{Name: "serving", Status: StatusDown, Error: errShuttingDown.Error()})
+	}
+	for _, c := range checks {
+		if liveness && !c.liveness {
+			continue
+		}
+		res, ok := results[c.name]
+		if !ok {
+			res = Result{Name: c.name, Status: StatusDown, Error: errNotChecked.Error(), Optional: c.optional}
+		}
+		if res.Status != StatusUp && !c.optional {
+			rpt.Status = StatusDown
+		}
+		rpt.Checks = append(rpt.Checks, res)
+	}
+	return rpt
+}
+
+// Refresh 立即并发执行所有检查
+func Refresh(ctx context.Context) {
+	lock.RLock()
+	current := append([]*check(nil), checks...)
+	lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range current {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			res := run(ctx, c)
+
+			lock.Lock()
+			defer lock.Unlock()
+			// 执行期间被替换的检查不保存结果
+			for _, latest := range checks {
+				if latest != c {
+					continue
+				}
+				if last, ok := results[c.name]; ok && last.Status != res.Status {
+					log.Warnf("health check %s changed from %s to %s, err: %s", c.name, last.Status, res.Status, res.Error)
+				}
+				results[c.name] = res
+			}
+		}(c)
+	}
+	wg.Wait()
+	notify()
+}
+
+func run(ctx context.Context, c *check) Result {
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = time.Duration(fconfig.DefaultConfig.HealthCheckTimeoutSeconds) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	res := Result{Name: c.name, Status: StatusUp, Optional: c.optional, CheckedAt: start}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- c.checker(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res.Duration = time.Since(start).String()
+	if err != nil {
+		res.Status, res.Error = StatusDown, err.Error()
+	}
+	return res
+}
+
+func loop() {
+	interval := time.Duration(fconfig.DefaultConfig.HealthCheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		Refresh(context.Background())
+		select {
+		case <-ticker.C:
+		case <-trigger:
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+func reset() {
+	lock.Lock()
+	checks = nil
+	results = make(map[string]Result)
+	lock.Unlock()
+	SetServing(true)
+}
+
+func TestReadiness(t *testing.T) {
+	log.InitLogger()
+	reset()
+	defer reset()
+
+	dbErr := errors.New("connection refused")
+	Register("db", func(ctx context.Context) error { return nil })
+	Register("redis", func(ctx context.Context) error { return dbErr })
+	Register("storage", func(ctx context.Context) error { return dbErr }, WithOptional())
+	Register("deadlock", func(ctx context.Context) error { return nil }, WithLiveness())
+
+	// 执行之前视为失败
+	assert.False(t, Ready())
+
+	Refresh(context.Background())
+	rpt := Readiness()
+	assert.Equal(t, StatusDown, rpt.Status)
+	assert.Len(t, rpt.Checks, 4)
+	assert.Equal(t, "connection refused", rpt.Checks[1].Error)
+	assert.Equal(t, StatusUp, Liveness().Status)
+	assert.Len(t, Liveness().Checks, 1)
+
+	// optional的检查失败不影响整体状态
+	Register("redis", func(ctx context.Context) error { return nil })
+	Refresh(context.Background())
+	assert.True(t, Ready())
+
+	SetServing(false)
+	assert.False(t, Ready())
+	assert.Equal(t, StatusUp, Liveness().Status)
+}
+
+func TestCheckTimeoutAndPanic(t *testing.T) {
+	log.InitLogger()
+	reset()
+	defer reset()
+
+	Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Hour)
+		return nil
+	}, WithTimeout(50*time.Millisecond))
+	Register("panic", func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	Refresh(context.Background())
+	rpt := Readiness()
+	assert.Equal(t, StatusDown, rpt.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), rpt.Checks[0].Error)
+	assert.Equal(t, "panic: boom", rpt.Checks[1].Error)
+}
+
+func TestHandlers(t *testing.T) {
+	log.InitLogger()
+	reset()
+	defer reset()
+
+	mux := http.NewServeMux()
+	RegisterHandlers(mux)
+	Register("db", func(ctx context.Context) error { return errors.New("down") })
+	Refresh(context.Background())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var rpt Report
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &rpt))
+	assert.Equal(t, StatusDown, rpt.Status)
+	assert.Equal(t, "db", rpt.Checks[0].Name)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, LivenessPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGRPCHealth(t *testing.T) {
+	log.InitLogger()
+	reset()
+	defer reset()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := grpc.NewServer()
+	RegisterGRPC(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	cli := healthpb.NewHealthClient(conn)
+
+	rsp, err := cli.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, rsp.Status)
+
+	SetServing(false)
+	rsp, err = cli.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, rsp.Status)
+}
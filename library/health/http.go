@@ -0,0 +1,50 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与k8s一致的检查路径
+const (
+	LivenessPath  = "/livez"
+	ReadinessPath = "/readyz"
+)
+
+// LivenessHandler UP时返回200, DOWN时返回503, 响应体为 Report
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Liveness())
+	})
+}
+
+// ReadinessHandler UP时返回200, DOWN时返回503, 响应体为 Report
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Readiness())
+	})
+}
+
+// RegisterHandlers 在mux上注册 /livez 和 /readyz
+func RegisterHandlers(mux *http.ServeMux) {
+	mux.Handle(LivenessPath, LivenessHandler())
+	mux.Handle(ReadinessPath, ReadinessHandler())
+}
+
+// RegisterGinHandlers 在gin上注册 /livez 和 /readyz
+func RegisterGinHandlers(r gin.IRoutes) {
+	r.GET(LivenessPath, gin.WrapH(LivenessHandler()))
+	r.GET(ReadinessPath, gin.WrapH(ReadinessHandler()))
+}
+
+func writeReport(w http.ResponseWriter, rpt Report) {
+	code := http.StatusOK
+	if rpt.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rpt)
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func CORS(c *gin.Context) {
-	allowOrigins := fconfig.DefaultConfig.CORSAllowOrigins
+	allowOrigins := fconfig.Current().CORSAllowOrigins // 读取快照, 热更新后立即生效
 
 	c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigins)
 	c.Writer.Header().Set("Access-Control-Allow-Credentials", "false")
@@ -1 +1,16 @@
 package fhttp
+
+import (
+	"net/http"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/lifecycle"
+)
+
+// LifecycleHook 在 HTTP_PORT 上启动handler(例如gin.Engine), 退出时等待正在处理的请求完成
+//
+//	app.Append(fhttp.LifecycleHook(engine))
+func LifecycleHook(handler http.Handler) lifecycle.Hook {
+	srv := &http.Server{Addr: ":" + fconfig.DefaultConfig.HTTPPort, Handler: handler}
+	return lifecycle.HTTPServer("http", srv)
+}
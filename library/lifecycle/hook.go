@@ -0,0 +1,66 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// HTTPServer 启动时监听端口, 退出时 Shutdown 等待正在处理的请求完成
+func HTTPServer(name string, srv *http.Server) Hook {
+	var lis net.Listener
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			addr := srv.Addr
+			if addr == "" {
+				addr = ":http"
+			}
+			var err error
+			lis, err = net.Listen("tcp", addr)
+			return err
+		},
+		Serve: func() error {
+			if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		},
+	}
+}
+
+// GRPCServer 启动时监听addr, 退出时 GracefulStop, 超过deadline时强制 Stop
+func GRPCServer(name string, s *grpc.Server, addr string) Hook {
+	var lis net.Listener
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			var err error
+			lis, err = net.Listen("tcp", addr)
+			return err
+		},
+		Serve: func() error {
+			return s.Serve(lis)
+		},
+		OnStop: func(ctx context.Context) error {
+			done := make(chan struct{})
+			go func() {
+				s.GracefulStop()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				s.Stop()
+				return ctx.Err()
+			}
+		},
+	}
+}
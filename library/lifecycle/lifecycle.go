@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/discovery/registry"
+	"github.com/lzw5399/go-common-public/library/health"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// 服务的各个组件注册启动和停止的hook, 由 App 统一按顺序启动, 收到 SIGTERM/SIGINT 后按以下顺序优雅退出:
+//  1. readiness失败(health.SetServing), 从注册中心注销服务
+//  2. 等待 SHUTDOWN_DELAY_SECONDS, 让网关和调用方感知
+//  3. 按注册的相反顺序执行 OnStop, 例如先停止http和grpc(GracefulStop), 再停止mq的消费
+//  4. 输出剩余的日志
+//
+// 整个退出过程不超过 SHUTDOWN_TIMEOUT_SECONDS
+//
+//	app := lifecycle.New()
+//	app.Append(fmq.LifecycleHook(), fgrpc.LifecycleHook(registerFunc), fhttp.LifecycleHook(engine))
+//	if err := app.Run(); err != nil { ... }
+
+// Hook 一个组件的启动和停止, 都是可选的
+type Hook struct {
+	Name string
+	// OnStart 按注册顺序执行, 返回错误时停止已经启动的组件
+	OnStart func(ctx context.Context) error
+	// Serve 在所有组件启动之后在单独的goroutine中执行, 例如 http.Server.ListenAndServe
+	// 在退出之前返回错误时触发整个应用退出
+	Serve func() error
+	// OnStop 按注册的相反顺序执行, ctx的deadline为剩余的退出时间
+	OnStop func(ctx context.Context) error
+}
+
+type App struct {
+	hooks         []Hook
+	signals       []os.Signal
+	startTimeout  time.Duration
+	stopTimeout   time.Duration
+	shutdownDelay time.Duration
+
+	ready    atomic.Bool
+	stopping atomic.Bool
+	started  int // 已经执行 OnStart 的hook数量
+	errCh    chan error
+	stopOnce sync.Once
+	stopErr  error
+}
+
+func New(opts ...OptionFunc) *App {
+	cfg := fconfig.DefaultConfig
+	app := &App{
+		signals:       []os.Signal{syscall.SIGTERM, syscall.SIGINT},
+		startTimeout:  time.Minute,
+		stopTimeout:   time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second,
+		shutdownDelay: time.Duration(cfg.ShutdownDelaySeconds) * time.Second,
+		errCh:         make(chan error, 1),
+	}
+	if app.stopTimeout <= 0 {
+		app.stopTimeout = 30 * time.Second
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
+}
+
+// Append 注册组件, 需要在 Start 之前调用
+func (a *App) Append(hooks ...Hook) {
+	a.hooks = append(a.hooks, hooks...)
+}
+
+// Ready 所有组件启动之后为true, 开始退出时为false, 供readiness检查使用
+func (a *App) Ready() bool {
+	return a.ready.Load()
+}
+
+// Run 启动所有组件并阻塞, 直到收到退出信号或者某个组件的 Serve 返回错误, 然后优雅退出
+// 启动之前就开始监听信号, 启动过程中收到信号时取消 OnStart 的ctx, 启动完成后直接退出
+func (a *App) Run() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, a.signals...)
+	defer signal.Stop(sigCh)
+
+	startCtx, cancel := context.WithTimeout(context.Background(), a.startTimeout)
+	var startSig os.Signal
+	startDone, watchDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case startSig = <-sigCh:
+			log.Warnf("lifecycle received signal %s while starting, cancel start", startSig)
+			cancel()
+		case <-startDone:
+		}
+	}()
+	err := a.Start(startCtx)
+	close(startDone)
+	<-watchDone
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	var serveErr error
+	if startSig == nil {
+		select {
+		case sig := <-sigCh:
+			log.Warnf("lifecycle received signal %s, shutting down", sig)
+		case serveErr = <-a.errCh:
+			log.Errorf("lifecycle shutting down because of err: %s", serveErr)
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.stopTimeout)
+	defer cancel()
+	return errors.Join(serveErr, a.Stop(stopCtx))
+}
+
+// Start 按顺序执行 OnStart, 失败时停止已经启动的组件
+func (a *App) Start(ctx context.Context) error {
+	for _, hook := range a.hooks {
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				err = fmt.Errorf("lifecycle start %s err: %w", hook.Name, err)
+				stopCtx, cancel := context.WithTimeout(context.Background(), a.stopTimeout)
+				defer cancel()
+				return errors.Join(err, a.Stop(stopCtx))
+			}
+		}
+		a.started++
+		log.Infof("lifecycle started %s", hook.Name)
+	}
+
+	for _, hook := range a.hooks {
+		if hook.Serve == nil {
+			continue
+		}
+		go func(hook Hook) {
+			err := hook.Serve()
+			if err == nil || a.stopping.Load() {
+				return
+			}
+			select {
+			case a.errCh <- fmt.Errorf("lifecycle serve %s err: %w", hook.Name, err):
+			default:
+			}
+		}(hook)
+	}
+	a.ready.Store(true)
+	health.SetServing(true)
+	return nil
+}
+
+// Stop 优雅退出, 只执行一次, 多次调用返回相同的结果
+func (a *App) Stop(ctx context.Context) error {
+	a.stopOnce.Do(func() {
+		a.stopErr = a.stop(ctx)
+	})
+	return a.stopErr
+}
+
+func (a *App) stop(ctx context.Context) error {
+	a.stopping.Store(true)
+	a.ready.Store(false)
+	health.SetServing(false)
+	registry.DeregisterService()
+
+	if a.shutdownDelay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(a.shutdownDelay):
+		}
+	}
+
+	var errs []error
+	for i := a.started - 1; i >= 0; i-- {
+		hook := a.hooks[i]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := a.runStop(ctx, hook); err != nil {
+			log.Errorf("lifecycle stop %s err: %s", hook.Name, err)
+			errs = append(errs, fmt.Errorf("lifecycle stop %s err: %w", hook.Name, err))
+			continue
+		}
+		log.Infof("lifecycle stopped %s", hook.Name)
+	}
+
+	// 日志最后输出, 剩余时间不足时最多等待1秒
+	flushTimeout := time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > flushTimeout {
+		flushTimeout = time.Until(deadline)
+	}
+	if err := log.Flush(flushTimeout); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// runStop OnStop超过deadline没有返回时不再等待, 继续停止下一个组件
+func (a *App) runStop(ctx context.Context, hook Hook) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.OnStop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
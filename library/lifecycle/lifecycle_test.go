@@ -0,0 +1,168 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *recorder) hook(name string) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			r.add("start " + name)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestStartStopOrder(t *testing.T) {
+	log.InitLogger()
+	r := &recorder{}
+	app := New(WithShutdownDelay(0))
+	app.Append(r.hook("mq"), r.hook("grpc"), r.hook("http"))
+
+	assert.Nil(t, app.Start(context.Background()))
+	assert.True(t, app.Ready())
+	assert.Nil(t, app.Stop(context.Background()))
+	assert.False(t, app.Ready())
+	assert.Equal(t, []string{"start mq", "start grpc", "start http", "stop http", "stop grpc", "stop mq"}, r.list())
+
+	// 多次Stop只执行一次
+	assert.Nil(t, app.Stop(context.Background()))
+	assert.Len(t, r.list(), 6)
+}
+
+func TestStartFailedStopsStarted(t *testing.T) {
+	log.InitLogger()
+	r := &recorder{}
+	app := New(WithShutdownDelay(0))
+	app.Append(r.hook("mq"), Hook{
+		Name: "grpc",
+		OnStart: func(ctx context.Context) error {
+			return errors.New("address already in use")
+		},
+		OnStop: func(ctx context.Context) error {
+			r.add("stop grpc")
+			return nil
+		},
+	}, r.hook("http"))
+
+	err := app.Start(context.Background())
+	assert.ErrorContains(t, err, "address already in use")
+	assert.False(t, app.Ready())
+	assert.Equal(t, []string{"start mq", "stop mq"}, r.list())
+}
+
+func TestStopTimeout(t *testing.T) {
+	log.InitLogger()
+	r := &recorder{}
+	app := New(WithShutdownDelay(time.Hour))
+	app.Append(r.hook("mq"), Hook{
+		Name: "grpc",
+		OnStop: func(ctx context.Context) error {
+			time.Sleep(time.Hour)
+			return nil
+		},
+	})
+	assert.Nil(t, app.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := app.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestServeErrorTriggersStop(t *testing.T) {
+	log.InitLogger()
+	r := &recorder{}
+	app := New(WithShutdownDelay(0))
+	hook := r.hook("grpc")
+	hook.Serve = func() error {
+		return errors.New("serve failed")
+	}
+	app.Append(r.hook("mq"), hook)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run()
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "serve failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not stop after serve error")
+	}
+	assert.Equal(t, []string{"start mq", "start grpc", "stop grpc", "stop mq"}, r.list())
+}
+
+func TestSignalDuringStart(t *testing.T) {
+	log.InitLogger()
+	r := &recorder{}
+	app := New(WithShutdownDelay(0), WithSignals(syscall.SIGUSR1))
+	app.Append(r.hook("mq"), Hook{
+		Name: "grpc",
+		OnStart: func(ctx context.Context) error {
+			assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, r.hook("http"))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run()
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not stop after signal during start")
+	}
+	assert.Equal(t, []string{"start mq", "stop mq"}, r.list())
+}
+
+func TestHTTPServer(t *testing.T) {
+	log.InitLogger()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	})
+	hook := HTTPServer("http", &http.Server{Addr: "127.0.0.1:0", Handler: mux})
+	app := New(WithShutdownDelay(0))
+	app.Append(hook)
+	assert.Nil(t, app.Start(context.Background()))
+	assert.Nil(t, app.Stop(context.Background()))
+}
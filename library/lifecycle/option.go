@@ -0,0 +1,36 @@
+package lifecycle
+
+import (
+	"os"
+	"time"
+)
+
+type OptionFunc func(a *App)
+
+// WithStopTimeout 优雅退出的最长时间, 默认为 SHUTDOWN_TIMEOUT_SECONDS
+func WithStopTimeout(timeout time.Duration) OptionFunc {
+	return func(a *App) {
+		a.stopTimeout = timeout
+	}
+}
+
+// WithStartTimeout 所有 OnStart 的最长时间, 默认1分钟
+func WithStartTimeout(timeout time.Duration) OptionFunc {
+	return func(a *App) {
+		a.startTimeout = timeout
+	}
+}
+
+// WithShutdownDelay 注销服务之后等待调用方感知的时间, 默认为 SHUTDOWN_DELAY_SECONDS
+func WithShutdownDelay(delay time.Duration) OptionFunc {
+	return func(a *App) {
+		a.shutdownDelay = delay
+	}
+}
+
+// WithSignals 触发退出的信号, 默认 SIGTERM 和 SIGINT
+func WithSignals(signals ...os.Signal) OptionFunc {
+	return func(a *App) {
+		a.signals = signals
+	}
+}
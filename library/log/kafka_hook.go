@@ -0,0 +1,210 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+// FieldSkipKafka 带有该字段的日志不会发送到k, 用于k客户端自身的日志, 避免循环
+const FieldSkipKafka = "skip_kafka"
+
+// KafkaSender 将一批日志发送到k, 由 k.InitLogHook 提供实现
+// 实现中不能使用本包记录日志, 否则会再次进入hook
+type KafkaSender interface {
+	SendBatch(topic string, msgs [][]byte) error
+	Close() error
+}
+
+// KafkaHook 将日志以json格式异步批量发送到 K_LOG_TOPIC
+// 缓冲区满时丢弃日志并计数, 不会阻塞业务
+type KafkaHook struct {
+	sender        KafkaSender
+	topic         string
+	formatter     logrus.Formatter
+	batchSize     int
+	flushInterval time.Duration
+
+	buffer   chan []byte
+	dropped  uint64
+	reported uint64 // 已经输出到stderr的丢弃数
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewKafkaHook 缓冲区大小、批量大小和发送间隔取自 K_LOG_* 配置
+func NewKafkaHook(sender KafkaSender) *KafkaHook {
+	cfg := fconfig.DefaultConfig
+	h := &KafkaHook{
+		sender: sender,
+		topic:  cfg.KLogTopic,
+		formatter: &logrus.JSONFormatter{
+			TimestampFormat: "2006-01-02 15:04:05",
+		},
+		batchSize:     cfg.KLogBatchSize,
+		flushInterval: time.Duration(cfg.KLogFlushMs) * time.Millisecond,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	if h.batchSize < 1 {
+		h.batchSize = 100
+	}
+	if h.flushInterval <= 0 {
+		h.flushInterval = time.Second
+	}
+	bufferSize := cfg.KLogBufferSize
+	if bufferSize < 1 {
+		bufferSize = 10000
+	}
+	h.buffer = make(chan []byte, bufferSize)
+
+	go h.run()
+	return h
+}
+
+func (h *KafkaHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 只做序列化和入队, 不会阻塞, 也不会记录日志
+func (h *KafkaHook) Fire(entry *logrus.Entry) error {
+	if _, ok := entry.Data[FieldSkipKafka]; ok {
+		return nil
+	}
+
+	select {
+	case <-h.done:
+		atomic.AddUint64(&h.dropped, 1)
+		return nil
+	default:
+	}
+
+	raw, err := h.formatter.Format(entry)
+	if err != nil {
+		atomic.AddUint64(&h.dropped, 1)
+		return nil
+	}
+
+	select {
+	case h.buffer <- raw:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+	return nil
+}
+
+// Dropped 因缓冲区满、发送失败或者已关闭而丢弃的日志条数
+func (h *KafkaHook) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+func (h *KafkaHook) run() {
+	defer close(h.stopped)
+
+	ticker := time.NewTicker(h.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, h.batchSize)
+	for {
+		select {
+		case raw := <-h.buffer:
+			batch = append(batch, raw)
+			if len(batch) >= h.batchSize {
+				batch = h.send(batch)
+			}
+		case <-ticker.C:
+			batch = h.send(batch)
+		case <-h.done:
+			// 关闭时把缓冲区中剩余的日志发完
+			for {
+				select {
+				case raw := <-h.buffer:
+					batch = append(batch, raw)
+					if len(batch) >= h.batchSize {
+						batch = h.send(batch)
+					}
+				default:
+					h.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// send 发送失败的日志直接丢弃, 错误只输出到stderr
+func (h *KafkaHook) send(batch [][]byte) [][]byte {
+	if len(batch) > 0 {
+		if err := h.sender.SendBatch(h.topic, batch); err != nil {
+			atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			_, _ = fmt.Fprintf(os.Stderr, "log kafka hook send %d entries to topic:%s err:%s\n", len(batch), h.topic, err)
+		}
+	}
+
+	if dropped := h.Dropped(); dropped > h.reported {
+		_, _ = fmt.Fprintf(os.Stderr, "log kafka hook dropped %d entries in total\n", dropped)
+		h.reported = dropped
+	}
+	return batch[:0]
+}
+
+// Close 停止接收日志, 等待缓冲区中的日志发送完成后关闭sender, 超过timeout返回错误
+func (h *KafkaHook) Close(timeout time.Duration) error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+
+	select {
+	case <-h.stopped:
+	case <-time.After(timeout):
+		return fmt.Errorf("log kafka hook flush timeout after %s", timeout)
+	}
+	return h.sender.Close()
+}
+
+var (
+	kafkaHooks      []*KafkaHook
+	kafkaHookLock   sync.Mutex
+	exitHandlerOnce sync.Once
+)
+
+// AddKafkaHook 为默认logger增加 KafkaHook. Fatal日志退出进程之前会先发送缓冲区中的日志
+func AddKafkaHook(sender KafkaSender) *KafkaHook {
+	hook := NewKafkaHook(sender)
+	defaultLogger.AddHook(hook)
+
+	exitHandlerOnce.Do(func() {
+		logrus.RegisterExitHandler(func() {
+			_ = Flush(5 * time.Second)
+		})
+	})
+
+	kafkaHookLock.Lock()
+	kafkaHooks = append(kafkaHooks, hook)
+	kafkaHookLock.Unlock()
+	return hook
+}
+
+// Flush 关闭所有 KafkaHook, 等待缓冲区中的日志发送完成. 进程退出前调用
+func Flush(timeout time.Duration) error {
+	kafkaHookLock.Lock()
+	hooks := kafkaHooks
+	kafkaHooks = nil
+	kafkaHookLock.Unlock()
+
+	var err error
+	for _, hook := range hooks {
+		if closeErr := hook.Close(timeout); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
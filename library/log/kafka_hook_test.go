@@ -0,0 +1,118 @@
+package log
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+type fakeSender struct {
+	lock    sync.Mutex
+	batches [][][]byte
+	block   chan struct{}
+	err     error
+	closed  bool
+}
+
+func (s *fakeSender) SendBatch(topic string, msgs [][]byte) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.batches = append(s.batches, append([][]byte(nil), msgs...))
+	return s.err
+}
+
+func (s *fakeSender) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSender) count() (batches, msgs int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, b := range s.batches {
+		msgs += len(b)
+	}
+	return len(s.batches), msgs
+}
+
+func setKLogConfig(t *testing.T, bufferSize, batchSize, flushMs int) {
+	old := fconfig.DefaultConfig
+	t.Cleanup(func() { fconfig.DefaultConfig = old })
+	fconfig.DefaultConfig.KLogBufferSize = bufferSize
+	fconfig.DefaultConfig.KLogBatchSize = batchSize
+	fconfig.DefaultConfig.KLogFlushMs = flushMs
+	fconfig.DefaultConfig.LogMode = "debug"
+	InitLogger()
+}
+
+func TestKafkaHookBatch(t *testing.T) {
+	setKLogConfig(t, 100, 3, 60000)
+	sender := &fakeSender{}
+	hook := AddKafkaHook(sender)
+
+	for i := 0; i < 7; i++ {
+		Infof("msg %d", i)
+	}
+	// k客户端自身的日志不发送
+	defaultLogger.WithField(FieldSkipKafka, true).Infof("skip")
+
+	assert.Eventually(t, func() bool {
+		batches, _ := sender.count()
+		return batches == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// 关闭时发送剩余不满一批的日志
+	assert.Nil(t, Flush(time.Second))
+	batches, msgs := sender.count()
+	assert.Equal(t, 3, batches)
+	assert.Equal(t, 7, msgs)
+	assert.True(t, sender.closed)
+	assert.Contains(t, string(sender.batches[0][0]), `"msg":"msg 0"`)
+	assert.Equal(t, uint64(0), hook.Dropped())
+
+	// 关闭之后的日志丢弃
+	Infof("after close")
+	assert.Equal(t, uint64(1), hook.Dropped())
+}
+
+func TestKafkaHookDrop(t *testing.T) {
+	setKLogConfig(t, 2, 1, 60000)
+	sender := &fakeSender{block: make(chan struct{})}
+	hook := AddKafkaHook(sender)
+
+	// 第一条被取出后阻塞在发送中, 之后两条填满缓冲区, 其余丢弃
+	Infof("msg 0")
+	time.Sleep(50 * time.Millisecond)
+	for i := 1; i < 6; i++ {
+		Infof("msg %d", i)
+	}
+	assert.Equal(t, uint64(3), hook.Dropped())
+
+	close(sender.block)
+	assert.Nil(t, Flush(time.Second))
+	_, msgs := sender.count()
+	assert.Equal(t, 3, msgs)
+}
+
+func TestKafkaHookSendErr(t *testing.T) {
+	setKLogConfig(t, 10, 2, 60000)
+	sender := &fakeSender{err: errors.New("broker unavailable")}
+	hook := AddKafkaHook(sender)
+
+	Infof("msg 0")
+	Infof("msg 1")
+	assert.Eventually(t, func() bool {
+		return hook.Dropped() == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, Flush(time.Second))
+}
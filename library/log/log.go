@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -86,12 +87,28 @@ func New() (*Logger, error) {
 	return logger, nil
 }
 
+var watchLevelOnce sync.Once
+
 func InitLogger() {
 	var err error
 	defaultLogger, err = New()
 	if err != nil {
 		panic(err)
 	}
+
+	// LOG_MODE 热更新时修改日志级别
+	watchLevelOnce.Do(func() {
+		fconfig.OnChange(func(old, new *fconfig.Config) {
+			if old.LogMode != new.LogMode {
+				SetLevel(new.LogMode)
+			}
+		})
+	})
+}
+
+// SetLevel 修改默认logger的日志级别
+func SetLevel(level string) {
+	defaultLogger.SetLevel(getModeByStr(level))
 }
 
 func getModeByStr(s string) logrus.Level {
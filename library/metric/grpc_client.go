@@ -0,0 +1,57 @@
+package metric
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// grpc客户端指标, 由 fgrpc 的客户端拦截器记录, target为调用的服务名
+var (
+	// 调用次数, 重试只算一次, code为最终的状态码
+	GRPCClientRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_request_count",
+			Help: "count of grpc client request.",
+		},
+		[]string{"target", "method", "code", "service"},
+	)
+
+	// 调用耗时分布, 包含重试, 单位毫秒
+	GRPCClientDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_client_request_duration_histogram",
+			Help:    "duration histogram of grpc client request.",
+			Buckets: []float64{10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000},
+		},
+		[]string{"target", "method", "service"},
+	)
+
+	// 重试次数
+	GRPCClientRetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_retry_count",
+			Help: "count of grpc client retry.",
+		},
+		[]string{"target", "method", "code", "service"},
+	)
+
+	// 熔断器状态, 0关闭 1半开 2打开
+	GRPCClientBreakerStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "grpc_client_breaker_state",
+			Help: "state of grpc client circuit breaker, 0 closed, 1 half-open, 2 open.",
+		},
+		[]string{"target", "service"},
+	)
+
+	// 被熔断器拒绝的调用次数
+	GRPCClientBreakerRejectCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_breaker_reject_count",
+			Help: "count of grpc client request rejected by circuit breaker.",
+		},
+		[]string{"target", "method", "service"},
+	)
+)
+
+// ServiceName 当前服务名, 作为指标的service标签
+func ServiceName() string {
+	return getServerName()
+}
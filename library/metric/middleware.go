@@ -11,6 +11,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/lifecycle"
 	"github.com/lzw5399/go-common-public/library/log"
 )
 
@@ -59,20 +60,47 @@ func Init(customCollectors ...prometheus.Collector) {
 	}
 
 	log.Infof("Starting metrics monitor...")
+	registerCollectors(customCollectors...)
 
+	http.Handle("/metrics", promhttp.Handler())
+	go http.ListenAndServe(":"+fconfig.DefaultConfig.MonitorPort, nil)
+}
+
+// LifecycleHook 交给 lifecycle.App 管理的监控服务, 使用单独的mux, 退出时 Shutdown
+// 没有开启 OPEN_MONITOR 时返回空的hook
+func LifecycleHook(customCollectors ...prometheus.Collector) lifecycle.Hook {
+	if !fconfig.DefaultConfig.OpenMonitor {
+		return lifecycle.Hook{Name: "metrics"}
+	}
+
+	registerCollectors(customCollectors...)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return lifecycle.HTTPServer("metrics", &http.Server{
+		Addr:    ":" + fconfig.DefaultConfig.MonitorPort,
+		Handler: mux,
+	})
+}
+
+func registerCollectors(customCollectors ...prometheus.Collector) {
 	// 默认内置的计数器
 	prometheus.MustRegister(RequestDurationGauge)
 	prometheus.MustRegister(RequestCounter)
 	prometheus.MustRegister(RequestDurationTotalCounter)
 	prometheus.MustRegister(RequestDurationHistogram)
 
+	// grpc客户端
+	prometheus.MustRegister(GRPCClientRequestCounter)
+	prometheus.MustRegister(GRPCClientDurationHistogram)
+	prometheus.MustRegister(GRPCClientRetryCounter)
+	prometheus.MustRegister(GRPCClientBreakerStateGauge)
+	prometheus.MustRegister(GRPCClientBreakerRejectCounter)
+
 	// 注册自定义指标收集器
 	for _, collector := range customCollectors {
 		prometheus.MustRegister(collector)
 	}
-
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(":"+fconfig.DefaultConfig.MonitorPort, nil)
 }
 
 func RequestDuration() gin.HandlerFunc {
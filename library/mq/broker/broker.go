@@ -0,0 +1,33 @@
+package broker
+
+import "context"
+
+// Handler 消费者回调, 返回error代表该条消息处理失败
+type Handler func(ctx context.Context, msg []byte) error
+
+// Producer 消息生产者
+type Producer interface {
+	// Publish 发送消息到指定topic
+	Publish(ctx context.Context, topic string, msg []byte) error
+	// Close 释放生产者持有的连接
+	Close() error
+}
+
+// Consumer 消息消费者
+type Consumer interface {
+	// Subscribe 订阅topic, 同一个group内的订阅者只会有一个收到消息; group为空时每个订阅者都会收到
+	Subscribe(ctx context.Context, topic, group string, handler Handler, opts ...SubscribeOptionFunc) error
+	// Close 停止所有订阅并释放连接
+	Close() error
+}
+
+// Pinger 可以检查连接状态的mq实现, 用于健康检查
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Broker 同时具备生产和消费能力的mq实现
+type Broker interface {
+	Producer
+	Consumer
+}
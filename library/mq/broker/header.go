@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/i18n"
+)
+
+// HeadersFromContext 提取需要随消息传递的上下文信息, 与grpc的 OutgoingMetadataInterceptor 保持一致
+// authorization 等敏感信息不会写入消息头
+func HeadersFromContext(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+
+	// caller
+	headers[fcontext.HeaderCaller] = fconfig.DefaultConfig.ServerName
+
+	// past caller
+	if pastCaller := fcontext.MergePastCaller(ctx); pastCaller != "" {
+		headers[fcontext.HeaderPastCaller] = pastCaller
+	}
+
+	// lang
+	headers[i18n.HeaderLang] = string(fcontext.LangFromContext(ctx))
+
+	// user info
+	if userInfo := fcontext.UserInfoFromContext(ctx); userInfo != nil {
+		userInfoRaw, _ := json.Marshal(userInfo)
+		headers[fcontext.HeaderUserInfo] = string(userInfoRaw)
+	}
+
+	// trace id
+	traceId := fcontext.TraceIdFromContext(ctx)
+	if traceId == "" {
+		traceId = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	headers[fcontext.HeaderTraceId] = traceId
+
+	// client ip
+	if clientIp := fcontext.ClientIpFromContext(ctx); clientIp != "" {
+		headers[fcontext.HeaderClientIp] = clientIp
+	}
+
+	// message id
+	_, headers[HeaderMessageId] = EnsureMessageId(ctx)
+
+	return headers
+}
+
+// ContextFromHeaders 根据消息头为每条消息重建一个新的上下文, 未知的header会被忽略
+func ContextFromHeaders(headers map[string]string) context.Context {
+	ctx := fcontext.Background()
+	for k, v := range headers {
+		switch k {
+		case fcontext.HeaderUserInfo: // 用户信息特殊处理，需要反序列化
+			var userInfo fcontext.UserInfo
+			if err := json.Unmarshal([]byte(v), &userInfo); err != nil {
+				continue
+			}
+			ctx = fcontext.UserInfoWithContext(ctx, &userInfo)
+
+		case HeaderMessageId:
+			ctx = context.WithValue(ctx, incomingMessageIdKey{}, v)
+
+		case fcontext.HeaderTraceId, fcontext.HeaderCaller, fcontext.HeaderPastCaller, fcontext.HeaderClientIp, i18n.HeaderLang:
+			if v == "" {
+				continue
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+	}
+
+	return ctx
+}
@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/i18n"
+)
+
+func TestHeadersRoundTrip(t *testing.T) {
+	fconfig.DefaultConfig.ServerName = "producer-svc"
+	fconfig.DefaultConfig.DefaultLang = "zh"
+
+	ctx := context.Background()
+	ctx = fcontext.TraceIdWithContext(ctx, "trace-1")
+	ctx = fcontext.UserInfoWithContext(ctx, &fcontext.UserInfo{UserId: 1, OrgId: 2, PlatForm: fcontext.PLATFORM_OPS})
+	ctx = context.WithValue(ctx, i18n.HeaderLang, "en")
+	ctx = context.WithValue(ctx, fcontext.HeaderCaller, "gateway")
+	ctx = context.WithValue(ctx, fcontext.HeaderClientIp, "10.0.0.1")
+	ctx = context.WithValue(ctx, fcontext.HeaderAuthorization, "secret")
+
+	headers := HeadersFromContext(ctx)
+	assert.Equal(t, "", headers[fcontext.HeaderAuthorization])
+
+	got := ContextFromHeaders(headers)
+	assert.Equal(t, "trace-1", fcontext.TraceIdFromContext(got))
+	assert.Equal(t, "producer-svc", fcontext.CallerFromContext(got))
+	assert.Equal(t, "gateway", fcontext.PastCallerFromContext(got))
+	assert.Equal(t, i18n.Lang("en"), fcontext.LangFromContext(got))
+	assert.Equal(t, "10.0.0.1", fcontext.ClientIpFromContext(got))
+	assert.Equal(t, int64(2), fcontext.UserInfoFromContext(got).OrgId)
+	assert.Equal(t, fcontext.PLATFORM_OPS, fcontext.UserInfoFromContext(got).PlatForm)
+}
+
+func TestContextFromEmptyHeaders(t *testing.T) {
+	ctx := ContextFromHeaders(nil)
+	assert.NotEqual(t, "", fcontext.TraceIdFromContext(ctx))
+	assert.Nil(t, fcontext.UserInfoFromContext(ctx))
+}
+
+func TestMessageId(t *testing.T) {
+	// 每次发送都生成新的ID
+	first := HeadersFromContext(context.Background())[HeaderMessageId]
+	second := HeadersFromContext(context.Background())[HeaderMessageId]
+	assert.NotEqual(t, "", first)
+	assert.NotEqual(t, first, second)
+
+	// 指定ID
+	headers := HeadersFromContext(WithMessageId(context.Background(), "msg-1"))
+	assert.Equal(t, "msg-1", headers[HeaderMessageId])
+
+	// 消费端可以取到ID, 在handler中再次发送时生成新的ID
+	consumed := ContextFromHeaders(headers)
+	assert.Equal(t, "msg-1", MessageIdFromContext(consumed))
+	assert.NotEqual(t, "msg-1", HeadersFromContext(consumed)[HeaderMessageId])
+}
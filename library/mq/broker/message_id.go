@@ -0,0 +1,36 @@
+package broker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// HeaderMessageId 每条消息唯一的ID, 发送时自动生成, 消费端用于去重
+const HeaderMessageId = "fc-message-id"
+
+type outgoingMessageIdKey struct{}
+
+type incomingMessageIdKey struct{}
+
+// WithMessageId 指定下一次发送的消息ID, 同一条业务消息重复发送时使用相同的ID, 便于消费端去重
+func WithMessageId(ctx context.Context, messageId string) context.Context {
+	return context.WithValue(ctx, outgoingMessageIdKey{}, messageId)
+}
+
+// EnsureMessageId 返回ctx中通过 WithMessageId 指定的ID, 没有时生成一个新的ID并写入ctx
+func EnsureMessageId(ctx context.Context) (context.Context, string) {
+	if messageId, ok := ctx.Value(outgoingMessageIdKey{}).(string); ok && messageId != "" {
+		return ctx, messageId
+	}
+	messageId := strings.ReplaceAll(uuid.New().String(), "-", "")
+	return WithMessageId(ctx, messageId), messageId
+}
+
+// MessageIdFromContext 消费时获取当前消息的ID
+// 与发送使用不同的key, handler中再次发送消息时不会沿用当前消息的ID
+func MessageIdFromContext(ctx context.Context) string {
+	messageId, _ := ctx.Value(incomingMessageIdKey{}).(string)
+	return messageId
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"time"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+type SubscribeOptionFunc func(*SubscribeOption)
+
+// SubscribeOption 单个订阅的消费参数, 未指定时使用 MQ_CONSUMER_* 配置
+type SubscribeOption struct {
+	Concurrency int    // 同时处理消息的handler数
+	MaxPending  int    // 等待处理的消息数上限, 超过时暂停接收, 实现背压
+	OnAssigned  func() // 订阅开始接收消息时回调, k在每次分区分配之后都会调用
+}
+
+func MergeSubscribeOption(opts ...SubscribeOptionFunc) *SubscribeOption {
+	option := &SubscribeOption{
+		Concurrency: fconfig.DefaultConfig.MQConsumerConcurrency,
+		MaxPending:  fconfig.DefaultConfig.MQConsumerMaxPending,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	if option.Concurrency < 1 {
+		option.Concurrency = 1
+	}
+	if option.MaxPending < 1 {
+		option.MaxPending = 1
+	}
+	return option
+}
+
+// Assigned 由mq实现在订阅开始接收消息时调用
+func (option *SubscribeOption) Assigned() {
+	if option.OnAssigned != nil {
+		option.OnAssigned()
+	}
+}
+
+// DrainTimeout 关闭时等待正在处理的消息完成的最长时间
+func DrainTimeout() time.Duration {
+	return time.Duration(fconfig.DefaultConfig.MQDrainTimeoutSeconds) * time.Second
+}
+
+// WithConcurrency 同时处理消息的handler数. k上相同key的消息仍然按顺序处理
+func WithConcurrency(concurrency int) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.Concurrency = concurrency
+	}
+}
+
+func WithMaxPending(maxPending int) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.MaxPending = maxPending
+	}
+}
+
+// WithOnAssigned 订阅开始接收消息时回调. k的Subscribe在后台加入消费组, 返回时还没有分配分区, 之前发送的消息不会被收到
+func WithOnAssigned(fn func()) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.OnAssigned = fn
+	}
+}
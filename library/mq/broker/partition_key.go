@@ -0,0 +1,17 @@
+package broker
+
+import "context"
+
+type partitionKeyKey struct{}
+
+// WithPartitionKey 指定下一次发送的消息的分区key, k上相同key的消息进入同一个分区, 保证顺序
+// 不支持分区的mq实现忽略该key
+func WithPartitionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, partitionKeyKey{}, key)
+}
+
+// PartitionKeyFromContext 获取 WithPartitionKey 指定的分区key
+func PartitionKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(partitionKeyKey{}).(string)
+	return key
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPoolClosed   = errors.New("broker pool closed")
+	ErrDrainTimeout = errors.New("broker drain timeout")
+)
+
+// Pool 固定数量的worker处理消息, 队列满时 Submit 阻塞, 实现背压
+// SubmitKey 相同key的任务总是由同一个worker按提交顺序执行
+type Pool struct {
+	shared  chan func()
+	workers []chan func()
+	done    chan struct{} // Close 时关闭, 唤醒阻塞的 Submit
+	stop    chan struct{} // 所有 Submit 返回之后关闭, worker处理完排队的任务后退出
+	once    sync.Once
+	wg      sync.WaitGroup
+
+	// lock 保证 Close 之后不会再有新的 Submit 开始, 已经开始的 Submit 写入的任务在worker退出之前一定会被处理
+	lock       sync.Mutex
+	closed     bool
+	submitting sync.WaitGroup
+}
+
+// NewPool workers为worker数, maxPending为排队任务数上限
+func NewPool(workers, maxPending int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxPending < 1 {
+		maxPending = 1
+	}
+
+	p := &Pool{
+		shared:  make(chan func(), maxPending),
+		workers: make([]chan func(), workers),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	// 每个worker的专属队列平分排队上限
+	perWorker := maxPending / workers
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	for i := range p.workers {
+		p.workers[i] = make(chan func(), perWorker)
+		p.wg.Add(1)
+		go p.run(p.workers[i])
+	}
+	return p
+}
+
+func (p *Pool) run(own chan func()) {
+	defer p.wg.Done()
+	for {
+		select {
+		case task := <-own:
+			task()
+		case task := <-p.shared:
+			task()
+		case <-p.stop:
+			// 关闭后把已经排队的任务处理完
+			for {
+				select {
+				case task := <-own:
+					task()
+				case task := <-p.shared:
+					task()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Submit 提交任务, 由任意空闲的worker执行
+func (p *Pool) Submit(ctx context.Context, task func()) error {
+	return p.submit(ctx, p.shared, task)
+}
+
+// SubmitKey 提交任务, 相同key的任务串行执行
+func (p *Pool) SubmitKey(ctx context.Context, key []byte, task func()) error {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return p.submit(ctx, p.workers[h.Sum32()%uint32(len(p.workers))], task)
+}
+
+func (p *Pool) submit(ctx context.Context, queue chan func(), task func()) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return ErrPoolClosed
+	}
+	p.submitting.Add(1)
+	p.lock.Unlock()
+	defer p.submitting.Done()
+
+	select {
+	case queue <- task:
+		return nil
+	case <-p.done:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 停止接收任务, 等待排队和正在执行的任务完成, 超过timeout返回 ErrDrainTimeout
+// timeout<=0时一直等待
+func (p *Pool) Close(timeout time.Duration) error {
+	p.once.Do(func() {
+		p.lock.Lock()
+		p.closed = true
+		p.lock.Unlock()
+		close(p.done)
+		p.submitting.Wait()
+		close(p.stop)
+	})
+	return WaitTimeout(&p.wg, timeout)
+}
+
+// WaitTimeout 等待wg完成, 超过timeout返回 ErrDrainTimeout. timeout<=0时一直等待
+func WaitTimeout(wg *sync.WaitGroup, timeout time.Duration) error {
+	if timeout <= 0 {
+		wg.Wait()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return ErrDrainTimeout
+	}
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolKeyOrder(t *testing.T) {
+	p := NewPool(4, 100)
+
+	var lock sync.Mutex
+	got := make(map[string][]int)
+	for i := 0; i < 50; i++ {
+		i := i
+		key := "key" + strconv.Itoa(i%5)
+		assert.Nil(t, p.SubmitKey(context.Background(), []byte(key), func() {
+			lock.Lock()
+			defer lock.Unlock()
+			got[key] = append(got[key], i)
+		}))
+	}
+	assert.Nil(t, p.Close(time.Second))
+
+	// 相同key按提交顺序执行
+	for key, seq := range got {
+		assert.Equal(t, 10, len(seq), key)
+		for j := 1; j < len(seq); j++ {
+			assert.Less(t, seq[j-1], seq[j], key)
+		}
+	}
+}
+
+func TestPoolConcurrencyAndBackpressure(t *testing.T) {
+	p := NewPool(2, 1)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	task := func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	}
+
+	// 2个worker各执行一个, 队列再排一个
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, p.Submit(context.Background(), task))
+	}
+
+	// 队列已满, 提交阻塞直到ctx超时
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Submit(ctx, task))
+
+	close(release)
+	assert.Nil(t, p.Close(time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+	assert.Equal(t, ErrPoolClosed, p.Submit(context.Background(), task))
+}
+
+func TestPoolDrainTimeout(t *testing.T) {
+	p := NewPool(1, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	assert.Nil(t, p.Submit(context.Background(), func() { <-release }))
+	assert.Equal(t, ErrDrainTimeout, p.Close(50*time.Millisecond))
+}
+
+func TestPoolSubmitDuringClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		p := NewPool(2, 4)
+		var accepted, executed int32
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if p.Submit(context.Background(), func() { atomic.AddInt32(&executed, 1) }) == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}()
+		}
+		assert.Nil(t, p.Close(time.Second))
+		wg.Wait()
+		// Submit 返回nil的任务一定会执行
+		assert.Equal(t, atomic.LoadInt32(&accepted), atomic.LoadInt32(&executed))
+	}
+}
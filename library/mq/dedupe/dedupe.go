@@ -0,0 +1,86 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// ErrInProgress 相同的消息正在被其他消费者处理, 返回错误以便稍后重新投递
+var ErrInProgress = errors.New("mq dedupe: message is being processed by another consumer")
+
+type OptionFunc func(*Option)
+
+type Option struct {
+	processingTTL time.Duration // 处理中状态的有效期, 需要大于handler(含重试)的最长执行时间
+	doneTTL       time.Duration // 已完成状态的保留时间, 需要覆盖消息可能被重复投递的时间范围
+}
+
+func MergeOption(opts ...OptionFunc) *Option {
+	option := &Option{
+		processingTTL: 5 * time.Minute,
+		doneTTL:       7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+func WithProcessingTTL(ttl time.Duration) OptionFunc {
+	return func(option *Option) {
+		option.processingTTL = ttl
+	}
+}
+
+func WithDoneTTL(ttl time.Duration) OptionFunc {
+	return func(option *Option) {
+		option.doneTTL = ttl
+	}
+}
+
+// Wrap 按消息ID去重, 同一个group内相同ID的消息只会成功处理一次
+// 没有消息ID(旧版本的生产者)时不去重; store出错时返回错误, 由mq重新投递
+func Wrap(handler broker.Handler, store Store, group string, opts ...OptionFunc) broker.Handler {
+	option := MergeOption(opts...)
+	return func(ctx context.Context, msg []byte) error {
+		messageId := broker.MessageIdFromContext(ctx)
+		if messageId == "" {
+			return handler(ctx, msg)
+		}
+
+		key := group + ":" + messageId
+		owner := uuid.New().String()
+		result, err := store.Claim(ctx, key, owner, option.processingTTL)
+		if err != nil {
+			log.Errorc(ctx, "mq dedupe claim message:%s err:%s", key, err)
+			return err
+		}
+		switch result {
+		case ClaimDone:
+			log.Infoc(ctx, "mq dedupe skip duplicate message:%s", key)
+			return nil
+		case ClaimInProgress:
+			return ErrInProgress
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			if failErr := store.Fail(ctx, key, owner); failErr != nil {
+				log.Errorc(ctx, "mq dedupe release message:%s err:%s", key, failErr)
+			}
+			return err
+		}
+
+		if err := store.Done(ctx, key, owner, option.doneTTL); err != nil {
+			// 已经处理成功, 只记录日志, 最坏情况是下次重复投递时再处理一次
+			log.Errorc(ctx, "mq dedupe mark message:%s done err:%s", key, err)
+		}
+		return nil
+	}
+}
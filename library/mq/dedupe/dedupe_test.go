@@ -0,0 +1,126 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+func consumedContext(messageId string) context.Context {
+	return broker.ContextFromHeaders(map[string]string{broker.HeaderMessageId: messageId})
+}
+
+func TestWrapSkipDuplicate(t *testing.T) {
+	log.InitLogger()
+	calls := 0
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		calls++
+		return nil
+	}, NewMemStore(), "g1")
+
+	assert.Nil(t, handler(consumedContext("msg-1"), []byte("hello")))
+	assert.Nil(t, handler(consumedContext("msg-1"), []byte("hello")))
+	assert.Equal(t, 1, calls)
+
+	// 没有消息ID时不去重
+	assert.Nil(t, handler(context.Background(), []byte("hello")))
+	assert.Nil(t, handler(context.Background(), []byte("hello")))
+	assert.Equal(t, 3, calls)
+}
+
+func TestWrapGroupIsolation(t *testing.T) {
+	log.InitLogger()
+	store := NewMemStore()
+	calls := 0
+	handler := func(ctx context.Context, msg []byte) error {
+		calls++
+		return nil
+	}
+
+	// 不同的消费组各自处理一次
+	assert.Nil(t, Wrap(handler, store, "g1")(consumedContext("msg-1"), nil))
+	assert.Nil(t, Wrap(handler, store, "g2")(consumedContext("msg-1"), nil))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrapFailRelease(t *testing.T) {
+	log.InitLogger()
+	calls := 0
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		calls++
+		if calls == 1 {
+			return errors.New("fail once")
+		}
+		return nil
+	}, NewMemStore(), "g1")
+
+	// 失败后释放处理权, 重新投递时可以再次处理
+	assert.NotNil(t, handler(consumedContext("msg-1"), nil))
+	assert.Nil(t, handler(consumedContext("msg-1"), nil))
+	assert.Nil(t, handler(consumedContext("msg-1"), nil))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrapConcurrentDuplicates(t *testing.T) {
+	log.InitLogger()
+	var calls int32
+	release := make(chan struct{})
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil
+	}, NewMemStore(), "g1")
+
+	var wg sync.WaitGroup
+	var inProgress int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handler(consumedContext("msg-1"), nil); errors.Is(err, ErrInProgress) {
+				atomic.AddInt32(&inProgress, 1)
+			}
+		}()
+	}
+
+	// 等其他的并发重复消息都返回 ErrInProgress
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&inProgress) == 4 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMemStoreProcessingExpire(t *testing.T) {
+	store := NewMemStore()
+	ctx := context.Background()
+
+	result, err := store.Claim(ctx, "k", "a", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, ClaimAcquired, result)
+
+	result, _ = store.Claim(ctx, "k", "b", 10*time.Millisecond)
+	assert.Equal(t, ClaimInProgress, result)
+
+	// 处理者宕机, 超时后可以再次抢占
+	time.Sleep(20 * time.Millisecond)
+	result, _ = store.Claim(ctx, "k", "b", time.Minute)
+	assert.Equal(t, ClaimAcquired, result)
+
+	// 超时的处理者不能释放或完成新的抢占
+	assert.Nil(t, store.Fail(ctx, "k", "a"))
+	assert.ErrorIs(t, store.Done(ctx, "k", "a", time.Minute), ErrClaimLost)
+	result, _ = store.Claim(ctx, "k", "c", time.Minute)
+	assert.Equal(t, ClaimInProgress, result)
+
+	assert.Nil(t, store.Done(ctx, "k", "b", time.Minute))
+	result, _ = store.Claim(ctx, "k", "c", time.Minute)
+	assert.Equal(t, ClaimDone, result)
+}
@@ -0,0 +1,107 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	fgorm "github.com/lzw5399/go-common-public/library/database/gorm"
+)
+
+const (
+	StatusProcessing = 1
+	StatusDone       = 2
+)
+
+// Record 消息处理状态表的记录
+type Record struct {
+	Key       string    `gorm:"column:message_key;type:varchar(255);primaryKey" json:"key"`
+	Owner     string    `gorm:"type:varchar(64);not null;default:''" json:"owner"` // 抢占者的标识, Done 和 Fail 只修改自己的记录
+	Status    int       `gorm:"not null" json:"status"`
+	ExpireAt  time.Time `gorm:"index" json:"expire_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Record) TableName() string {
+	return "mq_dedupe"
+}
+
+var _ Store = (*GormStore)(nil)
+
+// GormStore 基于数据库表的实现, 过期的记录需要定期调用 Cleanup 删除
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore db为nil时使用 fgorm.DB
+func NewGormStore(db *gorm.DB) *GormStore {
+	if db == nil {
+		db = fgorm.DB
+	}
+	return &GormStore{db: db}
+}
+
+// Migrate 创建状态表
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Record{})
+}
+
+func (s *GormStore) Claim(ctx context.Context, key, owner string, processingTTL time.Duration) (ClaimResult, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	createErr := db.Create(&Record{Key: key, Owner: owner, Status: StatusProcessing, ExpireAt: now.Add(processingTTL)}).Error
+	if createErr == nil {
+		return ClaimAcquired, nil
+	}
+
+	// 插入失败时大概率是主键冲突, 查询现有记录确认
+	var record Record
+	if err := db.Where("message_key = ?", key).Take(&record).Error; err != nil {
+		return ClaimInProgress, createErr
+	}
+	if record.ExpireAt.After(now) {
+		if record.Status == StatusDone {
+			return ClaimDone, nil
+		}
+		return ClaimInProgress, nil
+	}
+
+	// 记录已过期, 用原来的过期时间做乐观锁重新抢占
+	res := db.Model(&Record{}).
+		Where("message_key = ? AND expire_at = ?", key, record.ExpireAt).
+		Updates(map[string]interface{}{"owner": owner, "status": StatusProcessing, "expire_at": now.Add(processingTTL)})
+	if res.Error != nil {
+		return ClaimInProgress, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return ClaimAcquired, nil
+	}
+	return ClaimInProgress, nil
+}
+
+func (s *GormStore) Done(ctx context.Context, key, owner string, doneTTL time.Duration) error {
+	res := s.db.WithContext(ctx).Model(&Record{}).
+		Where("message_key = ? AND owner = ? AND status = ?", key, owner, StatusProcessing).
+		Updates(map[string]interface{}{"status": StatusDone, "expire_at": time.Now().Add(doneTTL)})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+func (s *GormStore) Fail(ctx context.Context, key, owner string) error {
+	return s.db.WithContext(ctx).
+		Where("message_key = ? AND owner = ? AND status = ?", key, owner, StatusProcessing).
+		Delete(&Record{}).Error
+}
+
+// Cleanup 删除已过期的记录
+func (s *GormStore) Cleanup(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expire_at < ?", time.Now()).Delete(&Record{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,57 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Store = (*MemStore)(nil)
+
+// MemStore 进程内的实现, 只适用于单实例或者单元测试
+type MemStore struct {
+	lock    sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{records: make(map[string]*Record)}
+}
+
+func (s *MemStore) Claim(ctx context.Context, key, owner string, processingTTL time.Duration) (ClaimResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if record, ok := s.records[key]; ok && record.ExpireAt.After(now) {
+		if record.Status == StatusDone {
+			return ClaimDone, nil
+		}
+		return ClaimInProgress, nil
+	}
+	s.records[key] = &Record{Key: key, Owner: owner, Status: StatusProcessing, ExpireAt: now.Add(processingTTL), UpdatedAt: now}
+	return ClaimAcquired, nil
+}
+
+func (s *MemStore) Done(ctx context.Context, key, owner string, doneTTL time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || record.Status != StatusProcessing || record.Owner != owner {
+		return ErrClaimLost
+	}
+	now := time.Now()
+	s.records[key] = &Record{Key: key, Owner: owner, Status: StatusDone, ExpireAt: now.Add(doneTTL), UpdatedAt: now}
+	return nil
+}
+
+func (s *MemStore) Fail(ctx context.Context, key, owner string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if record, ok := s.records[key]; ok && record.Status == StatusProcessing && record.Owner == owner {
+		delete(s.records, key)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	fredis "github.com/lzw5399/go-common-public/library/cache/redis"
+)
+
+const (
+	redisValueProcessing = "processing:" // 处理中的值为 processing:{owner}
+	redisValueDone       = "done"
+)
+
+// doneScript KEYS: key; ARGV: processing value, done value, ttl(ms)
+const doneScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0`
+
+// failScript KEYS: key; ARGV: processing value
+const failScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+var _ Store = (*RedisStore)(nil)
+
+// RedisStore 基于redis的实现, 记录通过TTL自动过期
+type RedisStore struct {
+	prefix string
+}
+
+// NewRedisStore 使用 fredis 的客户端, key为 {prefix}{group}:{messageId}
+func NewRedisStore(prefix string) *RedisStore {
+	return &RedisStore{prefix: prefix}
+}
+
+func (s *RedisStore) Claim(ctx context.Context, key, owner string, processingTTL time.Duration) (ClaimResult, error) {
+	ok, err := fredis.SetNx(ctx, s.prefix+key, redisValueProcessing+owner, processingTTL)
+	if err != nil {
+		return ClaimInProgress, err
+	}
+	if ok {
+		return ClaimAcquired, nil
+	}
+
+	value, err := fredis.Get(ctx, s.prefix+key)
+	if err != nil {
+		// 刚好过期, 交给下一次投递处理
+		if fredis.RedisNotFound(err) {
+			return ClaimInProgress, nil
+		}
+		return ClaimInProgress, err
+	}
+	if value == redisValueDone {
+		return ClaimDone, nil
+	}
+	return ClaimInProgress, nil
+}
+
+func (s *RedisStore) Done(ctx context.Context, key, owner string, doneTTL time.Duration) error {
+	res, err := fredis.Eval(ctx, doneScript, []string{s.prefix + key}, redisValueProcessing+owner, redisValueDone, doneTTL.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.(int64); n == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+func (s *RedisStore) Fail(ctx context.Context, key, owner string) error {
+	_, err := fredis.Eval(ctx, failScript, []string{s.prefix + key}, redisValueProcessing+owner)
+	return err
+}
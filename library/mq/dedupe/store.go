@@ -0,0 +1,31 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ClaimResult 抢占消息处理权的结果
+type ClaimResult int
+
+const (
+	ClaimAcquired   ClaimResult = iota // 抢占成功, 可以处理
+	ClaimDone                          // 已经处理过, 直接跳过
+	ClaimInProgress                    // 其他消费者正在处理
+)
+
+// ErrClaimLost 处理中的记录已经过期并被其他消费者重新抢占, Done 和 Fail 不会修改对方的记录
+var ErrClaimLost = errors.New("mq dedupe: claim expired and taken over by another consumer")
+
+// Store 记录消息的处理状态. 状态流转: 无记录 -claim-> 处理中 -done-> 已完成, 处理中 -fail-> 无记录
+// 处理中的记录超过processingTTL后视为处理者已宕机, 可以被再次抢占
+// owner为每次抢占唯一的标识, Done 和 Fail 只在记录仍属于owner时生效, 避免超时的处理者覆盖或删除新的抢占
+type Store interface {
+	// Claim 抢占key的处理权
+	Claim(ctx context.Context, key, owner string, processingTTL time.Duration) (ClaimResult, error)
+	// Done 标记处理完成, 在doneTTL内相同的key都会被跳过. 处理权已经丢失时返回 ErrClaimLost
+	Done(ctx context.Context, key, owner string, doneTTL time.Duration) error
+	// Fail 处理失败, 释放处理权, 重新投递时可以再次处理. 处理权已经丢失时不做任何修改
+	Fail(ctx context.Context, key, owner string) error
+}
@@ -0,0 +1,131 @@
+package delay
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// Schedule 保存一条在deliverAt投递到topic的消息, 返回消息ID, 可用于 Store.Cancel
+// 消息ID取自 broker.WithMessageId, 没有时生成, 投递时沿用该ID, 消费端可以据此去重
+func Schedule(ctx context.Context, store Store, topic string, payload []byte, deliverAt time.Time) (string, error) {
+	ctx, messageId := broker.EnsureMessageId(ctx)
+	msg := &Message{
+		ID:        messageId,
+		Topic:     topic,
+		Payload:   payload,
+		Headers:   broker.HeadersFromContext(ctx),
+		DeliverAt: deliverAt,
+	}
+	return messageId, store.Schedule(ctx, msg)
+}
+
+// Dispatcher 将到期的延迟消息发送到真实的topic
+// 多个实例同时运行时通过租约保证只有一个实例在投递; 发送成功但Ack失败时会重复投递
+type Dispatcher struct {
+	store    Store
+	producer broker.Producer
+	owner    string
+	option   *DispatcherOption
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(store Store, producer broker.Producer, opts ...DispatcherOptionFunc) *Dispatcher {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:    store,
+		producer: producer,
+		owner:    hostname + "-" + uuid.New().String(),
+		option:   MergeDispatcherOption(opts...),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start 在后台启动投递
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.run()
+	}()
+}
+
+// Stop 停止投递, 等待正在发送的批次完成并释放租约
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.wg.Wait()
+
+	if err := d.store.ReleaseLease(context.Background(), d.option.leaseName, d.owner); err != nil {
+		log.Warnf("delay dispatcher release lease:%s err:%s", d.option.leaseName, err)
+	}
+}
+
+func (d *Dispatcher) run() {
+	ticker := time.NewTicker(d.option.interval)
+	defer ticker.Stop()
+
+	for {
+		d.tick(d.ctx)
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) tick(ctx context.Context) {
+	for ctx.Err() == nil {
+		held, err := d.store.AcquireLease(ctx, d.option.leaseName, d.owner, d.option.leaseTTL)
+		if err != nil {
+			log.Errorf("delay dispatcher acquire lease:%s err:%s", d.option.leaseName, err)
+			return
+		}
+		if !held {
+			return
+		}
+
+		fetched, err := d.dispatchOnce(ctx)
+		if err != nil {
+			log.Errorf("delay dispatcher err:%s", err)
+			return
+		}
+		// 一批没有取满说明已经没有到期的消息
+		if fetched < d.option.batchSize {
+			return
+		}
+	}
+}
+
+// dispatchOnce 投递一批到期的消息, 返回取出的条数
+// 发送失败的消息不Ack, redeliverAfter之后会被再次取出
+func (d *Dispatcher) dispatchOnce(ctx context.Context) (int, error) {
+	msgs, err := d.store.FetchDue(ctx, time.Now(), d.option.batchSize, d.option.redeliverAfter)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range msgs {
+		pubCtx := broker.WithMessageId(broker.ContextFromHeaders(msg.Headers), msg.ID)
+		if err := d.producer.Publish(pubCtx, msg.Topic, msg.Payload); err != nil {
+			log.Warnf("delay dispatcher message:%s topic:%s publish err:%s, retry after %s", msg.ID, msg.Topic, err, d.option.redeliverAfter)
+			continue
+		}
+		if err := d.store.Ack(ctx, msg.ID); err != nil {
+			log.Warnf("delay dispatcher message:%s topic:%s ack err:%s, may be delivered again", msg.ID, msg.Topic, err)
+		}
+	}
+	return len(msgs), nil
+}
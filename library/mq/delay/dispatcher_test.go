@@ -0,0 +1,121 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
+)
+
+// flakyBroker 前failures次发送失败
+type flakyBroker struct {
+	*mem.Broker
+	failures int
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, topic string, msg []byte) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+	return b.Broker.Publish(ctx, topic, msg)
+}
+
+func subscribe(t *testing.T, b broker.Broker, topic string) *[]string {
+	var got []string
+	err := b.Subscribe(context.Background(), topic, "", func(ctx context.Context, msg []byte) error {
+		got = append(got, string(msg)+"@"+fcontext.TraceIdFromContext(ctx)+"@"+broker.MessageIdFromContext(ctx))
+		return nil
+	})
+	assert.Nil(t, err)
+	return &got
+}
+
+func TestDispatchDue(t *testing.T) {
+	log.InitLogger()
+	b := mem.NewBroker()
+	got := subscribe(t, b, "app")
+	s := NewMemStore()
+
+	ctx := fcontext.TraceIdWithContext(context.Background(), "t1")
+	now := time.Now()
+	_, err := Schedule(broker.WithMessageId(ctx, "m2"), s, "app", []byte("2"), now.Add(-time.Second))
+	assert.Nil(t, err)
+	_, err = Schedule(broker.WithMessageId(ctx, "m1"), s, "app", []byte("1"), now.Add(-2*time.Second))
+	assert.Nil(t, err)
+	later, err := Schedule(ctx, s, "app", []byte("3"), now.Add(time.Hour))
+	assert.Nil(t, err)
+	cancelled, err := Schedule(ctx, s, "app", []byte("4"), now.Add(-time.Second))
+	assert.Nil(t, err)
+
+	ok, err := s.Cancel(ctx, cancelled)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	d := NewDispatcher(s, b, WithBatchSize(1))
+	d.tick(context.Background())
+
+	// 按投递时间顺序, 沿用调度时的trace和消息ID
+	assert.Equal(t, []string{"1@t1@m1", "2@t1@m2"}, *got)
+	assert.Equal(t, 1, s.Len())
+
+	ok, err = s.Cancel(ctx, later)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = s.Cancel(ctx, "m1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDispatchRedeliver(t *testing.T) {
+	log.InitLogger()
+	b := &flakyBroker{Broker: mem.NewBroker(), failures: 1}
+	got := subscribe(t, b, "app")
+	s := NewMemStore()
+
+	_, err := Schedule(context.Background(), s, "app", []byte("1"), time.Now())
+	assert.Nil(t, err)
+
+	d := NewDispatcher(s, b, WithRedeliverAfter(30*time.Millisecond))
+	d.tick(context.Background())
+	assert.Equal(t, 0, len(*got))
+
+	// 未到重新投递时间
+	d.tick(context.Background())
+	assert.Equal(t, 0, len(*got))
+
+	time.Sleep(40 * time.Millisecond)
+	d.tick(context.Background())
+	assert.Equal(t, 1, len(*got))
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestDispatchSingleReplica(t *testing.T) {
+	log.InitLogger()
+	b := mem.NewBroker()
+	got := subscribe(t, b, "app")
+	s := NewMemStore()
+
+	d1 := NewDispatcher(s, b)
+	d2 := NewDispatcher(s, b)
+	d1.tick(context.Background())
+
+	_, err := Schedule(context.Background(), s, "app", []byte("1"), time.Now())
+	assert.Nil(t, err)
+
+	// 其他实例拿不到租约
+	d2.tick(context.Background())
+	assert.Equal(t, 0, len(*got))
+
+	// 释放租约之后可以接管
+	d1.Stop()
+	d2.tick(context.Background())
+	assert.Equal(t, 1, len(*got))
+}
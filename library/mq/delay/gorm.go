@@ -0,0 +1,132 @@
+package delay
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	fgorm "github.com/lzw5399/go-common-public/library/database/gorm"
+)
+
+// Record 延迟消息表的记录
+type Record struct {
+	ID        string    `gorm:"type:varchar(64);primaryKey" json:"id"`
+	Topic     string    `gorm:"type:varchar(255);not null" json:"topic"`
+	Payload   []byte    `json:"payload"`
+	Headers   string    `gorm:"type:text" json:"headers"` // json格式
+	DeliverAt time.Time `gorm:"index" json:"deliver_at"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"` // 被取出投递的次数
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Record) TableName() string {
+	return "mq_delay_message"
+}
+
+// Lease 投递者的租约, 同一时间只有持有租约的实例投递消息
+type Lease struct {
+	Name     string    `gorm:"type:varchar(64);primaryKey" json:"name"`
+	Owner    string    `gorm:"type:varchar(128);not null;default:''" json:"owner"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+func (Lease) TableName() string {
+	return "mq_delay_lease"
+}
+
+var _ Store = (*GormStore)(nil)
+
+// GormStore 基于数据库表的实现
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore db为nil时使用 fgorm.DB
+func NewGormStore(db *gorm.DB) *GormStore {
+	if db == nil {
+		db = fgorm.DB
+	}
+	return &GormStore{db: db}
+}
+
+// Migrate 创建消息表和租约表
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Record{}, &Lease{})
+}
+
+func (s *GormStore) Schedule(ctx context.Context, msg *Message) error {
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return err
+	}
+
+	record := &Record{ID: msg.ID, Topic: msg.Topic, Payload: msg.Payload, Headers: string(headers), DeliverAt: msg.DeliverAt}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"topic", "payload", "headers", "deliver_at"}),
+	}).Create(record).Error
+}
+
+func (s *GormStore) Cancel(ctx context.Context, id string) (bool, error) {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&Record{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// FetchDue 通过带原投递时间条件的更新推迟消息, 更新失败说明已被其他实例取走, 跳过
+func (s *GormStore) FetchDue(ctx context.Context, now time.Time, limit int, redeliverAfter time.Duration) ([]*Message, error) {
+	db := s.db.WithContext(ctx)
+
+	var records []*Record
+	if err := db.Where("deliver_at <= ?", now).Order("deliver_at").Limit(limit).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*Message, 0, len(records))
+	for _, record := range records {
+		res := db.Model(&Record{}).
+			Where("id = ? AND deliver_at = ?", record.ID, record.DeliverAt).
+			Updates(map[string]interface{}{"deliver_at": now.Add(redeliverAfter), "attempts": record.Attempts + 1})
+		if res.Error != nil {
+			return msgs, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		msg := &Message{ID: record.ID, Topic: record.Topic, Payload: record.Payload, DeliverAt: record.DeliverAt}
+		if record.Headers != "" {
+			_ = json.Unmarshal([]byte(record.Headers), &msg.Headers)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (s *GormStore) Ack(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Where("id = ?", id).Delete(&Record{}).Error
+}
+
+func (s *GormStore) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	// 租约行不存在时先创建一个已过期的, 已存在时忽略
+	_ = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Lease{Name: name, ExpireAt: now.Add(-time.Second)}).Error
+
+	res := db.Model(&Lease{}).
+		Where("name = ? AND (owner = ? OR expire_at < ?)", name, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "expire_at": now.Add(ttl)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *GormStore) ReleaseLease(ctx context.Context, name, owner string) error {
+	return s.db.WithContext(ctx).Model(&Lease{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Update("expire_at", time.Now().Add(-time.Second)).Error
+}
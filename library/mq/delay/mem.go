@@ -0,0 +1,102 @@
+package delay
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Store = (*MemStore)(nil)
+
+type memLease struct {
+	owner    string
+	expireAt time.Time
+}
+
+// MemStore 进程内的实现, 重启后消息丢失, 只适用于单元测试
+type MemStore struct {
+	lock   sync.Mutex
+	msgs   map[string]*Message
+	leases map[string]*memLease
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{msgs: make(map[string]*Message), leases: make(map[string]*memLease)}
+}
+
+func (s *MemStore) Schedule(ctx context.Context, msg *Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cp := *msg
+	s.msgs[msg.ID] = &cp
+	return nil
+}
+
+func (s *MemStore) Cancel(ctx context.Context, id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.msgs[id]
+	delete(s.msgs, id)
+	return ok, nil
+}
+
+func (s *MemStore) FetchDue(ctx context.Context, now time.Time, limit int, redeliverAfter time.Duration) ([]*Message, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var due []*Message
+	for _, msg := range s.msgs {
+		if !msg.DeliverAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DeliverAt.Before(due[j].DeliverAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	msgs := make([]*Message, 0, len(due))
+	for _, msg := range due {
+		cp := *msg
+		msgs = append(msgs, &cp)
+		msg.DeliverAt = now.Add(redeliverAfter)
+	}
+	return msgs, nil
+}
+
+func (s *MemStore) Ack(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.msgs, id)
+	return nil
+}
+
+// Len 未投递的消息数
+func (s *MemStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.msgs)
+}
+
+func (s *MemStore) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if lease, ok := s.leases[name]; ok && lease.owner != owner && lease.expireAt.After(now) {
+		return false, nil
+	}
+	s.leases[name] = &memLease{owner: owner, expireAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemStore) ReleaseLease(ctx context.Context, name, owner string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if lease, ok := s.leases[name]; ok && lease.owner == owner {
+		delete(s.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package delay
+
+import (
+	"time"
+)
+
+type DispatcherOptionFunc func(*DispatcherOption)
+
+type DispatcherOption struct {
+	interval       time.Duration // 轮询间隔, 也是投递时间的最大误差
+	batchSize      int           // 每次取出的消息数
+	redeliverAfter time.Duration // 取出后多久没有Ack会被再次投递, 发送失败时同样在这之后重试
+	leaseName      string        // 租约名称
+	leaseTTL       time.Duration // 租约有效期, 持有者宕机后最多等待这么久由其他实例接管
+}
+
+func MergeDispatcherOption(opts ...DispatcherOptionFunc) *DispatcherOption {
+	option := &DispatcherOption{
+		interval:       time.Second,
+		batchSize:      100,
+		redeliverAfter: 30 * time.Second,
+		leaseName:      "default",
+		leaseTTL:       30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+func WithInterval(interval time.Duration) DispatcherOptionFunc {
+	return func(option *DispatcherOption) {
+		option.interval = interval
+	}
+}
+
+func WithBatchSize(batchSize int) DispatcherOptionFunc {
+	return func(option *DispatcherOption) {
+		option.batchSize = batchSize
+	}
+}
+
+func WithRedeliverAfter(redeliverAfter time.Duration) DispatcherOptionFunc {
+	return func(option *DispatcherOption) {
+		option.redeliverAfter = redeliverAfter
+	}
+}
+
+func WithLease(name string, ttl time.Duration) DispatcherOptionFunc {
+	return func(option *DispatcherOption) {
+		option.leaseName = name
+		option.leaseTTL = ttl
+	}
+}
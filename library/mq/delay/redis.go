@@ -0,0 +1,124 @@
+package delay
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	fredis "github.com/lzw5399/go-common-public/library/cache/redis"
+)
+
+// scheduleScript KEYS: zset, hash; ARGV: id, deliverAt(ms), data
+const scheduleScript = `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1`
+
+// cancelScript KEYS: zset, hash; ARGV: id
+const cancelScript = `
+local n = redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return n`
+
+// fetchDueScript KEYS: zset, hash; ARGV: now(ms), limit, redeliverAt(ms)
+const fetchDueScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local res = {}
+for _, id in ipairs(ids) do
+	local data = redis.call('HGET', KEYS[2], id)
+	if data then
+		redis.call('ZADD', KEYS[1], ARGV[3], id)
+		table.insert(res, data)
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return res`
+
+// acquireLeaseScript KEYS: lease; ARGV: owner, ttl(ms)
+const acquireLeaseScript = `
+local owner = redis.call('GET', KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+
+// releaseLeaseScript KEYS: lease; ARGV: owner
+const releaseLeaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+var _ Store = (*RedisStore)(nil)
+
+// RedisStore 基于redis的实现, 投递时间存放在sorted set中, 消息内容存放在hash中
+// key使用 {prefix} 作为hash tag, 集群模式下位于同一个slot
+type RedisStore struct {
+	zsetKey string
+	hashKey string
+	prefix  string
+}
+
+// NewRedisStore 使用 fredis 的客户端, key为 {prefix}:zset、{prefix}:data 和 {prefix}:lease:{name}
+func NewRedisStore(prefix string) *RedisStore {
+	tag := "{" + prefix + "}"
+	return &RedisStore{zsetKey: tag + ":zset", hashKey: tag + ":data", prefix: tag}
+}
+
+func (s *RedisStore) Schedule(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fredis.Eval(ctx, scheduleScript, []string{s.zsetKey, s.hashKey}, msg.ID, msg.DeliverAt.UnixMilli(), data)
+	return err
+}
+
+func (s *RedisStore) Cancel(ctx context.Context, id string) (bool, error) {
+	res, err := fredis.Eval(ctx, cancelScript, []string{s.zsetKey, s.hashKey}, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.(int64)
+	return n > 0, nil
+}
+
+func (s *RedisStore) FetchDue(ctx context.Context, now time.Time, limit int, redeliverAfter time.Duration) ([]*Message, error) {
+	res, err := fredis.Eval(ctx, fetchDueScript, []string{s.zsetKey, s.hashKey}, now.UnixMilli(), limit, now.Add(redeliverAfter).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := res.([]interface{})
+	msgs := make([]*Message, 0, len(items))
+	for _, item := range items {
+		data, _ := item.(string)
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, &msg)
+	}
+	return msgs, nil
+}
+
+func (s *RedisStore) Ack(ctx context.Context, id string) error {
+	_, err := s.Cancel(ctx, id)
+	return err
+}
+
+func (s *RedisStore) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	res, err := fredis.Eval(ctx, acquireLeaseScript, []string{s.prefix + ":lease:" + name}, owner, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.(int64)
+	return n == 1, nil
+}
+
+func (s *RedisStore) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := fredis.Eval(ctx, releaseLeaseScript, []string{s.prefix + ":lease:" + name}, owner)
+	return err
+}
@@ -0,0 +1,32 @@
+package delay
+
+import (
+	"context"
+	"time"
+)
+
+// Message 一条等待投递的延迟消息
+type Message struct {
+	ID        string            `json:"id"` // 即消息头中的消息ID, 用于取消
+	Topic     string            `json:"topic"`
+	Payload   []byte            `json:"payload"`
+	Headers   map[string]string `json:"headers"` // 调度时ctx中的header, 投递时还原trace等信息
+	DeliverAt time.Time         `json:"deliver_at"`
+}
+
+// Store 延迟消息的持久化存储
+// FetchDue 取出的消息会被推迟到 now+redeliverAfter, Ack之前宕机的消息会在之后被再次取出, 因此投递至少一次
+type Store interface {
+	// Schedule 保存消息, ID相同时覆盖
+	Schedule(ctx context.Context, msg *Message) error
+	// Cancel 删除未投递的消息, 消息不存在时返回false
+	Cancel(ctx context.Context, id string) (bool, error)
+	// FetchDue 按投递时间顺序取出最多limit条到期的消息
+	FetchDue(ctx context.Context, now time.Time, limit int, redeliverAfter time.Duration) ([]*Message, error)
+	// Ack 消息已经投递, 删除
+	Ack(ctx context.Context, id string) error
+
+	// AcquireLease 租约不存在、已过期或者本身就是持有者时获取成功, 同时续期
+	AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, owner string) error
+}
@@ -0,0 +1,61 @@
+package k
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+// newSaramaConfig 生产者和消费者共用的基础配置: 版本和SASL认证
+func newSaramaConfig(cfg fconfig.Config) (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(cfg.KVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "k ParseKafkaVersion failed")
+	}
+
+	kConfig := sarama.NewConfig()
+	kConfig.Version = version
+
+	if cfg.KUser != "" && cfg.KPwd != "" {
+		kConfig.Net.SASL.Enable = true
+		kConfig.Net.SASL.User = cfg.KUser
+		kConfig.Net.SASL.Password = cfg.KPwd
+		kConfig.Net.SASL.Handshake = true
+
+		if cfg.KMechanism == sarama.SASLTypeSCRAMSHA256 {
+			kConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
+			kConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		} else if cfg.KMechanism == sarama.SASLTypeSCRAMSHA512 {
+			kConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
+			kConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		} else {
+			kConfig.Net.SASL.Mechanism = sarama.SASLMechanism(cfg.KMechanism)
+		}
+	}
+
+	return kConfig, nil
+}
+
+// newConsumerConfig 消费组的配置, offset只在handler处理成功后提交
+func newConsumerConfig(cfg fconfig.Config) (*sarama.Config, error) {
+	kConfig, err := newSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kConfig.Consumer.Return.Errors = true
+	kConfig.Consumer.Offsets.CommitInterval = 1 * time.Second
+	switch cfg.KOffsetInitial {
+	case "oldest":
+		kConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest", "":
+		kConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, errors.Errorf("k unsupported K_OFFSET_INITIAL: %s", cfg.KOffsetInitial)
+	}
+
+	return kConfig, nil
+}
@@ -2,89 +2,188 @@ package k
 
 import (
 	"context"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
-	cluster "github.com/bsm/sarama-cluster"
+
 	fconfig "github.com/lzw5399/go-common-public/library/config"
 	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
 	"github.com/lzw5399/go-common-public/library/trace"
 )
 
-type ConsumerCallbackHandler func(ctx context.Context, input []byte) error // 使用者需要自定义该回调函数实现体
+type ConsumerCallbackHandler = broker.Handler // 使用者需要自定义该回调函数实现体
+
+// handlerRetryPolicy handler失败时在当前分区上原地重试的退避策略, 默认一直重试, 设置 K_CONSUMER_MAX_ATTEMPTS 后最多尝试该次数
+var handlerRetryPolicy = retry.Policy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+}
 
+// StartKClusterClient 阻塞消费, 不会退出
+//
+// Deprecated: 使用 StartKConsumer, 通过ctx控制退出
 func StartKClusterClient(kAddr, topic, group string, handler ConsumerCallbackHandler) {
-	version, err := sarama.ParseKafkaVersion(fconfig.DefaultConfig.KVersion)
+	StartKConsumer(context.Background(), kAddr, topic, group, handler)
+}
+
+// StartKConsumer 基于消费组阻塞消费topic(多个topic按逗号分隔), 直到ctx被取消
+// handler失败时默认在当前分区上一直退避重试, 不会丢消息
+// 设置 K_CONSUMER_MAX_ATTEMPTS 代表接受丢消息: 超过该次数后只记录错误并跳过该消息, 提交offset
+// 需要跳过失败的消息又不丢消息时, 订阅时使用 fmq.WithRetry, 重试耗尽并成功投递到死信topic后才提交offset
+// 每个订阅会启动 K_CONSUMER_CONCURRENCY 个消费组成员, 每个分区内按 broker.WithConcurrency 并行处理, 相同key的消息串行
+func StartKConsumer(ctx context.Context, kAddr, topic, group string, handler ConsumerCallbackHandler, opts ...broker.SubscribeOptionFunc) {
+	option := broker.MergeSubscribeOption(opts...)
+	concurrency := fconfig.DefaultConfig.KConsumerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runConsumerGroup(ctx, kAddr, topic, group, handler, option)
+		}()
+	}
+	wg.Wait()
+}
+
+func runConsumerGroup(ctx context.Context, kAddr, topic, group string, handler ConsumerCallbackHandler, option *broker.SubscribeOption) {
+	cfg, err := newConsumerConfig(fconfig.DefaultConfig)
 	if err != nil {
 		log.Errorf("mq:k err: %s", err)
 		return
 	}
-	cfg := cluster.NewConfig()
-	cfg.Consumer.Return.Errors = true
-	cfg.Group.Return.Notifications = true
-	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest // OffsetOldest OffsetNewest
-	cfg.Consumer.Offsets.CommitInterval = 1 * time.Second
-	cfg.Version = version
-
-	if fconfig.DefaultConfig.KUser != "" && fconfig.DefaultConfig.KPwd != "" {
-		cfg.Net.SASL.Enable = true
-		cfg.Net.SASL.User = fconfig.DefaultConfig.KUser
-		cfg.Net.SASL.Password = fconfig.DefaultConfig.KPwd
-	}
 
-	var consumer *cluster.Consumer
+	var consumerGroup sarama.ConsumerGroup
 	for {
-		var err error
-		consumer, err = cluster.NewConsumer(strings.Split(kAddr, ","), group, strings.Split(topic, ","), cfg)
-		if err != nil {
-			log.Errorf("Failed to start k consumer,err: %s", err)
-			time.Sleep(time.Millisecond * 5000)
-			continue
-		} else {
+		consumerGroup, err = sarama.NewConsumerGroup(strings.Split(kAddr, ","), group, cfg)
+		if err == nil {
 			break
 		}
-	}
 
-	defer consumer.Close()
+		log.Errorf("Failed to start k consumer,err: %s", err)
+		if !sleepWithContext(ctx, 5*time.Second) {
+			return
+		}
+	}
+	defer consumerGroup.Close()
 
-	// Create signal channel
-	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for err := range consumerGroup.Errors() {
+			log.Errorf("k consumer group(%s) error: %s", group, err)
+		}
+	}()
 
 	log.Debugf("Sarama consumer up and running!...")
 
-	// Consume all channels, wait for signal to exit
+	topics := strings.Split(topic, ",")
+	groupHandler := &consumerGroupHandler{handler: handler, option: option, maxAttempts: fconfig.DefaultConfig.KConsumerMaxAttempts}
 	for {
-		select {
-		case msg, more := <-consumer.Messages():
-			if more {
-				func() {
-					span, ctx := trace.ApmClient().CreateKEntrySpan(context.Background(), msg.Topic, "handler", msg)
-					defer span.End()
-					consumer.MarkOffset(msg, "")
-					log.Debugf("Message claimed: value = %s, timestamp = %v, topic = %s", string(msg.Value), msg.Timestamp, msg.Topic)
-					if err := handler(ctx, msg.Value); err != nil {
-						log.Errorf("Callback handler err: %s", err)
-					}
-				}()
-			}
-		case ntf, more := <-consumer.Notifications():
-			if more {
-				log.Debugf("Rebalanced: %+v", ntf)
+		// Consume 在每次rebalance之后返回, 需要循环调用
+		if err := consumerGroup.Consume(ctx, topics, groupHandler); err != nil {
+			log.Errorf("k consumer group(%s) consume err: %s", group, err)
+			if err == sarama.ErrClosedConsumerGroup || !sleepWithContext(ctx, 5*time.Second) {
+				return
 			}
-		case err, more := <-consumer.Errors():
-			if more {
-				log.Debugf("Error: %s", err)
+		}
+
+		if ctx.Err() != nil {
+			log.Debugf("k consumer group(%s) stopped", group)
+			return
+		}
+	}
+}
+
+type consumerGroupHandler struct {
+	handler     ConsumerCallbackHandler
+	option      *broker.SubscribeOption
+	maxAttempts int // <=0 代表一直重试, >0 时超过次数跳过消息
+}
+
+func (h *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	log.Debugf("Rebalanced: %+v", session.Claims())
+	h.option.Assigned()
+	return nil
+}
+
+func (h *consumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 有key的消息按key分配到固定的worker串行处理, 没有key的消息由任意worker处理
+// offset只提交到连续处理完成的位置, 会话结束时等待正在处理的消息, 最多等待 MQ_DRAIN_TIMEOUT_SECONDS
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	pool := broker.NewPool(h.option.Concurrency, h.option.MaxPending)
+	tracker := newOffsetTracker()
+
+	for msg := range claim.Messages() {
+		msg := msg
+		tracker.add(msg.Offset)
+		task := func() {
+			// 会话已经结束, 排队中的消息交给下一个持有该分区的成员处理
+			if session.Context().Err() != nil || !h.handle(session, msg) {
+				return
 			}
-		case <-sigchan:
-			{
-				log.Debugf("Exit signal!")
+			if next, ok := tracker.complete(msg.Offset); ok {
+				session.MarkOffset(msg.Topic, msg.Partition, next, "")
 			}
-			return
 		}
+
+		var err error
+		if len(msg.Key) == 0 {
+			err = pool.Submit(session.Context(), task)
+		} else {
+			err = pool.SubmitKey(session.Context(), msg.Key, task)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err := pool.Close(broker.DrainTimeout()); err != nil {
+		log.Warnf("k drain topic = %s, partition = %d err: %s", claim.Topic(), claim.Partition(), err)
+	}
+	return nil
+}
+
+// handle 处理成功或者尝试次数用完返回true, 之后提交offset; 会话结束(rebalance或停止消费)时返回false, 该消息不会提交offset
+func (h *consumerGroupHandler) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) bool {
+	for attempt := 1; ; attempt++ {
+		err := func() error {
+			span, ctx := trace.ApmClient().CreateKEntrySpan(contextFromMessage(msg), msg.Topic, "handler", msg)
+			defer span.End()
+			log.Debugf("Message claimed: topic = %s, partition = %d, offset = %d", msg.Topic, msg.Partition, msg.Offset)
+			return h.handler(ctx, msg.Value)
+		}()
+		if err == nil {
+			return true
+		}
+		if h.maxAttempts > 0 && attempt >= h.maxAttempts {
+			log.Errorf("Callback handler err: %s, topic = %s, partition = %d, offset = %d, skipped after %d attempts", err, msg.Topic, msg.Partition, msg.Offset, attempt)
+			return true
+		}
+
+		backoff := handlerRetryPolicy.Backoff(attempt)
+		log.Errorf("Callback handler err: %s, topic = %s, partition = %d, offset = %d, retry after %s", err, msg.Topic, msg.Partition, msg.Offset, backoff)
+		if !sleepWithContext(session.Context(), backoff) {
+			return false
+		}
+	}
+}
+
+// sleepWithContext ctx被取消时返回false
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
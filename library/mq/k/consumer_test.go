@@ -0,0 +1,51 @@
+package k
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s *fakeSession) Context() context.Context {
+	return s.ctx
+}
+
+func TestHandleMaxAttempts(t *testing.T) {
+	log.InitLogger()
+	old := handlerRetryPolicy
+	handlerRetryPolicy.InitialBackoff, handlerRetryPolicy.MaxBackoff = time.Millisecond, time.Millisecond
+	defer func() { handlerRetryPolicy = old }()
+
+	attempts := 0
+	h := &consumerGroupHandler{
+		handler: func(ctx context.Context, msg []byte) error {
+			attempts++
+			return errors.New("always fail")
+		},
+		option:      broker.MergeSubscribeOption(),
+		maxAttempts: 3,
+	}
+	msg := &sarama.ConsumerMessage{Topic: "t", Value: []byte("v")}
+
+	// 尝试次数用完后跳过, 提交offset
+	assert.True(t, h.handle(&fakeSession{ctx: context.Background()}, msg))
+	assert.Equal(t, 3, attempts)
+
+	// 会话结束时不提交
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.maxAttempts = 0
+	assert.False(t, h.handle(&fakeSession{ctx: ctx}, msg))
+}
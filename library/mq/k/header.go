@@ -0,0 +1,31 @@
+package k
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// recordHeadersFromContext 将上下文信息转换为k的record header, 需要 K_VERSION >= 0.11
+func recordHeadersFromContext(ctx context.Context) []sarama.RecordHeader {
+	headers := broker.HeadersFromContext(ctx)
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return recordHeaders
+}
+
+// contextFromMessage 根据消息的record header重建消息处理的上下文
+func contextFromMessage(msg *sarama.ConsumerMessage) context.Context {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		headers[string(h.Key)] = string(h.Value)
+	}
+	return broker.ContextFromHeaders(headers)
+}
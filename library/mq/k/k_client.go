@@ -0,0 +1,120 @@
+package k
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+var _ broker.Broker = (*KClient)(nil)
+var _ broker.Pinger = (*KClient)(nil)
+
+// KClient 将k的生产和消费包装为 broker.Broker
+type KClient struct {
+	addr   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	clientLock sync.Mutex
+	client     sarama.Client // 健康检查使用
+}
+
+func NewKClient(addr string) *KClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KClient{
+		addr:   addr,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Publish 分区key通过 broker.WithPartitionKey 或 fmq.WithPartitionKey 指定
+func (c *KClient) Publish(ctx context.Context, topic string, msg []byte) error {
+	return SendKMsg(ctx, topic, string(msg))
+}
+
+// Subscribe 在后台启动消费, 连接失败时会一直重试, 因此不会返回错误
+// ctx被取消或者 Close 时停止消费
+func (c *KClient) Subscribe(ctx context.Context, topic, group string, handler broker.Handler, opts ...broker.SubscribeOptionFunc) error {
+	subCtx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-subCtx.Done():
+		}
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		StartKConsumer(subCtx, c.addr, topic, group, handler, opts...)
+	}()
+	return nil
+}
+
+// Ping 刷新元数据并获取controller, 确认集群可用并且认证通过
+func (c *KClient) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		client, err := c.metadataClient()
+		if err == nil {
+			err = client.RefreshMetadata()
+		}
+		if err == nil {
+			_, err = client.Controller()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// metadataClient 健康检查使用的client, 复用连接, 关闭之后重新创建
+func (c *KClient) metadataClient() (sarama.Client, error) {
+	c.clientLock.Lock()
+	defer c.clientLock.Unlock()
+	if c.client != nil && !c.client.Closed() {
+		return c.client, nil
+	}
+
+	cfg, err := newSaramaConfig(fconfig.DefaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(strings.Split(c.addr, ","), cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+// Close 停止所有消费并等待正在处理的消息完成, 然后关闭生产者. 最多等待 MQ_DRAIN_TIMEOUT_SECONDS
+func (c *KClient) Close() error {
+	c.cancel()
+	err := broker.WaitTimeout(&c.wg, broker.DrainTimeout())
+
+	c.clientLock.Lock()
+	if c.client != nil {
+		_ = c.client.Close()
+		c.client = nil
+	}
+	c.clientLock.Unlock()
+
+	if closeErr := closeProducer(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
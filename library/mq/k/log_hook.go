@@ -0,0 +1,49 @@
+package k
+
+import (
+	"strings"
+
+	"github.com/Shopify/sarama"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+)
+
+// logSender 日志专用的同步生产者, 与业务消息的生产者分开, 发送失败不影响业务消息
+// 这里不能调用log记录日志, 否则会再次进入hook
+type logSender struct {
+	producer sarama.SyncProducer
+}
+
+func (s *logSender) SendBatch(topic string, msgs [][]byte) error {
+	batch := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		batch = append(batch, &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(msg)})
+	}
+	return s.producer.SendMessages(batch)
+}
+
+func (s *logSender) Close() error {
+	return s.producer.Close()
+}
+
+// InitLogHook K_LOG 开启时为默认logger增加 log.KafkaHook, 需要在 log.InitLogger 之后调用
+// 进程退出前调用 log.Flush 发送缓冲区中剩余的日志
+func InitLogHook() error {
+	cfg := fconfig.DefaultConfig
+	if !cfg.KLog {
+		return nil
+	}
+
+	kConfig, err := newProducerConfig(cfg)
+	if err != nil {
+		return err
+	}
+	p, err := sarama.NewSyncProducer(strings.Split(cfg.KAddr, ","), kConfig)
+	if err != nil {
+		return err
+	}
+
+	log.AddKafkaHook(&logSender{producer: p})
+	return nil
+}
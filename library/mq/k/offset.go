@@ -0,0 +1,41 @@
+package k
+
+import (
+	"sync"
+)
+
+// offsetTracker 并行处理时记录一个分区内已接收的offset, 只有之前的消息都处理完成后才能提交
+type offsetTracker struct {
+	lock    sync.Mutex
+	offsets []int64 // 已接收未提交的offset, 按到达顺序
+	done    map[int64]struct{}
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]struct{})}
+}
+
+func (t *offsetTracker) add(offset int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.offsets = append(t.offsets, offset)
+}
+
+// complete 标记offset处理完成, 返回可以提交的下一个消费位置
+func (t *offsetTracker) complete(offset int64) (int64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.done[offset] = struct{}{}
+
+	next, ok := int64(0), false
+	for len(t.offsets) > 0 {
+		head := t.offsets[0]
+		if _, finished := t.done[head]; !finished {
+			break
+		}
+		delete(t.done, head)
+		t.offsets = t.offsets[1:]
+		next, ok = head+1, true
+	}
+	return next, ok
+}
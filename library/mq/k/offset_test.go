@@ -0,0 +1,29 @@
+package k
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	tracker := newOffsetTracker()
+	// offset可能不连续, 比如compact之后
+	for _, offset := range []int64{10, 11, 13, 14} {
+		tracker.add(offset)
+	}
+
+	// 前面的消息未完成时不能提交
+	_, ok := tracker.complete(13)
+	assert.False(t, ok)
+	_, ok = tracker.complete(11)
+	assert.False(t, ok)
+
+	next, ok := tracker.complete(10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(14), next)
+
+	next, ok = tracker.complete(14)
+	assert.True(t, ok)
+	assert.Equal(t, int64(15), next)
+}
@@ -0,0 +1,54 @@
+package k
+
+import (
+	"time"
+)
+
+// DeliveryCallback 消息投递结果的回调. 同步模式下在 SendMessage 返回前调用, 异步模式下在后台调用
+type DeliveryCallback func(partition int32, offset int64, err error)
+
+type SendOptionFunc func(*SendOption)
+
+type SendOption struct {
+	key       string
+	headers   map[string]string
+	timestamp time.Time
+	callback  DeliveryCallback
+}
+
+func MergeSendOption(opts ...SendOptionFunc) *SendOption {
+	option := &SendOption{}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+// WithKey 指定分区key, 相同key的消息会进入同一个分区, 保证顺序. 优先于ctx中的 broker.WithPartitionKey
+func WithKey(key string) SendOptionFunc {
+	return func(option *SendOption) {
+		option.key = key
+	}
+}
+
+// WithHeaders 追加自定义header, 与从ctx中提取的header同名时覆盖
+func WithHeaders(headers map[string]string) SendOptionFunc {
+	return func(option *SendOption) {
+		option.headers = headers
+	}
+}
+
+// WithTimestamp 指定消息时间, 不指定时使用发送时间
+func WithTimestamp(t time.Time) SendOptionFunc {
+	return func(option *SendOption) {
+		option.timestamp = t
+	}
+}
+
+// WithCallback 指定投递结果回调
+func WithCallback(cb DeliveryCallback) SendOptionFunc {
+	return func(option *SendOption) {
+		option.callback = cb
+	}
+}
@@ -0,0 +1,34 @@
+package k
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+const (
+	logPayloadTruncate = "truncate"
+	logPayloadRedact   = "redact"
+	logPayloadFull     = "full"
+)
+
+// formatPayload 按 K_LOG_PAYLOAD 的配置输出日志中的消息体, 避免敏感数据和超大消息直接进入日志
+func formatPayload(cfg fconfig.Config, value []byte) string {
+	switch cfg.KLogPayload {
+	case logPayloadFull:
+		return string(value)
+	case logPayloadRedact:
+		return fmt.Sprintf("<redacted %d bytes>", len(value))
+	default:
+		max := cfg.KLogPayloadMax
+		if max <= 0 || len(value) <= max {
+			return string(value)
+		}
+		// 不截断在多字节字符中间
+		for max > 0 && !utf8.RuneStart(value[max]) {
+			max--
+		}
+		return fmt.Sprintf("%s...(%d bytes)", value[:max], len(value))
+	}
+}
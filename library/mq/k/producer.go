@@ -4,72 +4,239 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
 	fconfig "github.com/lzw5399/go-common-public/library/config"
 	"github.com/lzw5399/go-common-public/library/log"
-	"github.com/pkg/errors"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+var ErrProducerClosed = errors.New("k producer closed")
+
+var (
+	producer      sarama.SyncProducer
+	asyncProducer sarama.AsyncProducer
+	asyncWg       sync.WaitGroup
+	once          sync.Once
+	producerErr   error // 初始化失败的错误, 之后每次发送都返回该错误
+
+	// producerLock 保证关闭之后不会再向异步生产者写入消息
+	producerLock   sync.RWMutex
+	producerClosed bool
 )
 
-var producer sarama.SyncProducer
-var once sync.Once
+// deliveryMeta 异步模式下随消息携带, 用于投递完成后的回调和日志
+type deliveryMeta struct {
+	callback DeliveryCallback
+	payload  string
+}
 
-func initProducerK() {
+func initProducerK() error {
 	cfg := fconfig.DefaultConfig
-	version, err := sarama.ParseKafkaVersion(cfg.KVersion)
+	kConfig, err := newProducerConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	addrs := strings.Split(cfg.KAddr, ",")
+	if cfg.KProducerAsync {
+		asyncProducer, err = sarama.NewAsyncProducer(addrs, kConfig)
+		if err != nil {
+			return errors.Wrap(err, "k create async producer")
+		}
+		asyncWg.Add(2)
+		go handleSuccesses(asyncProducer)
+		go handleErrors(asyncProducer)
+		return nil
+	}
+
+	// 使用给定代理地址和配置创建一个同步生产者
+	producer, err = sarama.NewSyncProducer(addrs, kConfig)
 	if err != nil {
-		panic(errors.Wrap(err, "k ParseKafkaVersion failed"))
+		return errors.Wrap(err, "k create producer")
+	}
+	return nil
+}
+
+// newProducerConfig 生产者配置. 按key哈希分区, 没有key时随机分区
+func newProducerConfig(cfg fconfig.Config) (*sarama.Config, error) {
+	kConfig, err := newSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	kConfig := sarama.NewConfig()
 	// 等待服务器所有副本都保存成功后的响应
 	kConfig.Producer.RequiredAcks = sarama.WaitForAll
-	// 随机的分区类型：返回一个分区器，该分区器每次选择一个随机分区
-	kConfig.Producer.Partitioner = sarama.NewRandomPartitioner
+	kConfig.Producer.Partitioner = sarama.NewHashPartitioner
 	// 是否等待成功和失败后的响应
 	kConfig.Producer.Return.Successes = true
-	kConfig.Version = version
-
-	if cfg.KUser != "" && cfg.KPwd != "" {
-		kConfig.Net.SASL.Enable = true
-		kConfig.Net.SASL.User = cfg.KUser
-		kConfig.Net.SASL.Password = cfg.KPwd
-		kConfig.Net.SASL.Handshake = true
-
-		if cfg.KMechanism == sarama.SASLTypeSCRAMSHA256 {
-			kConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
-			kConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		} else if cfg.KMechanism == sarama.SASLTypeSCRAMSHA512 {
-			kConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
-			kConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		} else {
-			kConfig.Net.SASL.Mechanism = sarama.SASLMechanism(cfg.KMechanism)
+	kConfig.Producer.Return.Errors = true
+
+	switch cfg.KProducerCompression {
+	case "none", "":
+		kConfig.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		kConfig.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		kConfig.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		kConfig.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		kConfig.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return nil, errors.Errorf("k unsupported K_PRODUCER_COMPRESSION: %s", cfg.KProducerCompression)
+	}
+
+	if cfg.KProducerIdempotent {
+		kConfig.Producer.Idempotent = true
+		kConfig.Net.MaxOpenRequests = 1
+		if kConfig.Producer.Retry.Max < 1 {
+			kConfig.Producer.Retry.Max = 1
 		}
 	}
 
-	// 使用给定代理地址和配置创建一个同步生产者
-	producer, err = sarama.NewSyncProducer(strings.Split(cfg.KAddr, ","), kConfig)
-	if err != nil {
-		panic(err)
+	if cfg.KProducerAsync {
+		kConfig.Producer.Flush.Frequency = time.Duration(cfg.KProducerFlushMs) * time.Millisecond
+		kConfig.Producer.Flush.Messages = cfg.KProducerFlushMessages
+	}
+
+	if err := kConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "k producer config invalid")
 	}
+	return kConfig, nil
 }
 
-func SendKMsg(ctx context.Context, topic, value string) error {
-	once.Do(initProducerK)
+func handleSuccesses(p sarama.AsyncProducer) {
+	defer asyncWg.Done()
+	for msg := range p.Successes() {
+		meta, _ := msg.Metadata.(*deliveryMeta)
+		if meta == nil {
+			continue
+		}
+		log.Debugf("Send k[%s] message success, partition=%d offset=%d msg=%s", msg.Topic, msg.Partition, msg.Offset, meta.payload)
+		if meta.callback != nil {
+			meta.callback(msg.Partition, msg.Offset, nil)
+		}
+	}
+}
+
+func handleErrors(p sarama.AsyncProducer) {
+	defer asyncWg.Done()
+	for perr := range p.Errors() {
+		meta, _ := perr.Msg.Metadata.(*deliveryMeta)
+		if meta == nil {
+			log.Errorf("Send k[%s] message, err:%s", perr.Msg.Topic, perr.Err)
+			continue
+		}
+		log.Errorf("Send k[%s] message[%s], err:%s", perr.Msg.Topic, meta.payload, perr.Err)
+		if meta.callback != nil {
+			meta.callback(perr.Msg.Partition, perr.Msg.Offset, perr.Err)
+		}
+	}
+}
+
+// buildMessage 组装消息. header来自ctx和 WithHeaders, 后者同名时覆盖
+func buildMessage(ctx context.Context, topic string, value []byte, option *SendOption) *sarama.ProducerMessage {
+	headers := recordHeadersFromContext(ctx)
+	for key, v := range option.headers {
+		replaced := false
+		for i := range headers {
+			if string(headers[i].Key) == key {
+				headers[i].Value = []byte(v)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(v)})
+		}
+	}
 
 	msg := &sarama.ProducerMessage{
-		Topic: topic,
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(value),
+		Headers:   headers,
+		Timestamp: option.timestamp,
+	}
+	key := option.key
+	if key == "" {
+		key = broker.PartitionKeyFromContext(ctx)
+	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg
+}
+
+// SendMessage 发送消息. 异步模式(K_PRODUCER_ASYNC)下写入发送队列后即返回, 结果通过 WithCallback 通知
+func SendMessage(ctx context.Context, topic string, value []byte, opts ...SendOptionFunc) error {
+	producerLock.RLock()
+	defer producerLock.RUnlock()
+	if producerClosed {
+		return ErrProducerClosed
+	}
+	once.Do(func() {
+		if producerErr = initProducerK(); producerErr != nil {
+			log.Errorf("k init producer err: %s", producerErr)
+		}
+	})
+	if producerErr != nil {
+		return producerErr
 	}
 
-	// 将字符串转换为字节数组
-	msg.Value = sarama.ByteEncoder(value)
-	_, _, err := producer.SendMessage(msg)
+	option := MergeSendOption(opts...)
+	msg := buildMessage(ctx, topic, value, option)
+	payload := formatPayload(fconfig.DefaultConfig, value)
+
+	if asyncProducer != nil {
+		msg.Metadata = &deliveryMeta{callback: option.callback, payload: payload}
+		select {
+		case asyncProducer.Input() <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
+	partition, offset, err := producer.SendMessage(msg)
+	if option.callback != nil {
+		option.callback(partition, offset, err)
+	}
 	if err != nil {
-		log.Errorf("Send k[%s] message[%s], err:%s,", topic, value, err.Error())
+		log.Errorf("Send k[%s] message[%s], err:%s,", topic, payload, err.Error())
 		return err
 	}
 
-	log.Infof("Send k[%s] message success, msg=%s", topic, value)
+	log.Debugf("Send k[%s] message success, partition=%d offset=%d msg=%s", topic, partition, offset, payload)
+	return nil
+}
+
+func SendKMsg(ctx context.Context, topic, value string) error {
+	return SendMessage(ctx, topic, []byte(value))
+}
+
+// closeProducer 关闭生产者. 异步模式下会等待队列中的消息发送完成并回调
+func closeProducer() error {
+	producerLock.Lock()
+	defer producerLock.Unlock()
+	if producerClosed {
+		return nil
+	}
+	producerClosed = true
+
+	if asyncProducer != nil {
+		asyncProducer.AsyncClose()
+		asyncWg.Wait()
+		return nil
+	}
+	if producer != nil {
+		return producer.Close()
+	}
 	return nil
 }
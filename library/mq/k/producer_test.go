@@ -0,0 +1,97 @@
+package k
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+func TestFormatPayload(t *testing.T) {
+	cfg := fconfig.Config{}
+	cfg.KLogPayload = "truncate"
+	cfg.KLogPayloadMax = 4
+	assert.Equal(t, "abc", formatPayload(cfg, []byte("abc")))
+	assert.Equal(t, "abcd...(6 bytes)", formatPayload(cfg, []byte("abcdef")))
+	// 不在多字节字符中间截断
+	cfg.KLogPayloadMax = 3
+	assert.Equal(t, "a...(7 bytes)", formatPayload(cfg, []byte("a中文")))
+
+	cfg.KLogPayload = "redact"
+	assert.Equal(t, "<redacted 6 bytes>", formatPayload(cfg, []byte("secret")))
+
+	cfg.KLogPayload = "full"
+	assert.Equal(t, strings.Repeat("a", 10), formatPayload(cfg, []byte(strings.Repeat("a", 10))))
+}
+
+func TestBuildMessage(t *testing.T) {
+	ctx := fcontext.TraceIdWithContext(context.Background(), "trace-1")
+	ts := time.Unix(1700000000, 0)
+	msg := buildMessage(ctx, "app", []byte("hello"), MergeSendOption(
+		WithKey("app-1"),
+		WithHeaders(map[string]string{"x-custom": "v"}),
+		WithTimestamp(ts),
+	))
+
+	assert.Equal(t, "app", msg.Topic)
+	assert.Equal(t, sarama.StringEncoder("app-1"), msg.Key)
+	assert.Equal(t, ts, msg.Timestamp)
+
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, "v", headers["x-custom"])
+	assert.Equal(t, "trace-1", headers[fcontext.HeaderTraceId])
+
+	// 分区key也可以通过ctx指定, WithKey 优先
+	keyCtx := broker.WithPartitionKey(context.Background(), "app-2")
+	msg = buildMessage(keyCtx, "app", []byte("hello"), MergeSendOption())
+	assert.Equal(t, sarama.StringEncoder("app-2"), msg.Key)
+	msg = buildMessage(keyCtx, "app", []byte("hello"), MergeSendOption(WithKey("app-1")))
+	assert.Equal(t, sarama.StringEncoder("app-1"), msg.Key)
+
+	msg = buildMessage(context.Background(), "app", []byte("hello"), MergeSendOption())
+	assert.Nil(t, msg.Key)
+	assert.False(t, msg.Timestamp.IsZero())
+}
+
+func TestNewProducerConfig(t *testing.T) {
+	cfg := fconfig.Config{}
+	cfg.KVersion = "2.3.0"
+	cfg.KProducerCompression = "zstd"
+	cfg.KProducerIdempotent = true
+	kConfig, err := newProducerConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, sarama.CompressionZSTD, kConfig.Producer.Compression)
+	assert.True(t, kConfig.Producer.Idempotent)
+
+	cfg.KProducerCompression = "brotli"
+	_, err = newProducerConfig(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestSendMessageInitError(t *testing.T) {
+	log.InitLogger()
+	oldCfg := fconfig.DefaultConfig
+	defer func() {
+		fconfig.DefaultConfig = oldCfg
+		once, producerErr = sync.Once{}, nil
+	}()
+	fconfig.DefaultConfig.KVersion = "2.3.0"
+	fconfig.DefaultConfig.KProducerCompression = "brotli"
+
+	// 初始化失败后每次发送都返回同一个错误, 不会panic
+	err := SendMessage(context.Background(), "app", []byte("hello"))
+	assert.NotNil(t, err)
+	assert.Equal(t, err, SendMessage(context.Background(), "app", []byte("hello")))
+}
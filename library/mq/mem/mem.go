@@ -0,0 +1,119 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+var ErrClosed = errors.New("mq:mem broker closed")
+
+var _ broker.Broker = (*Broker)(nil)
+var _ broker.Pinger = (*Broker)(nil)
+
+type subscription struct {
+	group   string
+	handler broker.Handler
+}
+
+// Broker 进程内的mq实现, 主要用于单元测试
+// 与n的queue group语义一致: 同一group内轮询投递给一个订阅者, group为空的订阅者每条消息都会收到
+// 消息在 Publish 中同步投递, Publish 返回时所有订阅者均已处理完毕
+// 与其他实现一致, handler拿到的是根据消息头重建的上下文
+type Broker struct {
+	mu      sync.Mutex
+	subs    map[string][]*subscription // topic -> 订阅者
+	cursors map[string]int             // topic/group -> 下一次投递的订阅者下标
+	closed  bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subs:    make(map[string][]*subscription),
+		cursors: make(map[string]int),
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, topic string, msg []byte) error {
+	targets, err := b.pick(topic)
+	if err != nil {
+		return err
+	}
+
+	// 拷贝一份, 避免订阅者修改发送方的数据
+	headers := broker.HeadersFromContext(ctx)
+	for _, sub := range targets {
+		data := make([]byte, len(msg))
+		copy(data, msg)
+		_ = sub.handler(broker.ContextFromHeaders(headers), data)
+	}
+	return nil
+}
+
+// Subscribe 投递是同步的, opts中的并发参数不生效
+func (b *Broker) Subscribe(ctx context.Context, topic, group string, handler broker.Handler, opts ...broker.SubscribeOptionFunc) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	b.subs[topic] = append(b.subs[topic], &subscription{group: group, handler: handler})
+	broker.MergeSubscribeOption(opts...).Assigned()
+	return nil
+}
+
+// Ping 关闭之后返回 ErrClosed
+func (b *Broker) Ping(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.subs = make(map[string][]*subscription)
+	return nil
+}
+
+// pick 选出本条消息需要投递的订阅者, 投递本身在锁外进行, 以便handler中可以再次Publish
+func (b *Broker) pick(topic string) ([]*subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	targets := make([]*subscription, 0)
+	groups := make(map[string][]*subscription)
+	groupOrder := make([]string, 0)
+	for _, sub := range b.subs[topic] {
+		if sub.group == "" {
+			targets = append(targets, sub)
+			continue
+		}
+		if _, ok := groups[sub.group]; !ok {
+			groupOrder = append(groupOrder, sub.group)
+		}
+		groups[sub.group] = append(groups[sub.group], sub)
+	}
+
+	for _, group := range groupOrder {
+		members := groups[group]
+		cursorKey := topic + "/" + group
+		idx := b.cursors[cursorKey] % len(members)
+		b.cursors[cursorKey] = idx + 1
+		targets = append(targets, members[idx])
+	}
+	return targets, nil
+}
@@ -0,0 +1,71 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+)
+
+func TestQueueGroup(t *testing.T) {
+	b := NewBroker()
+	ctx := context.Background()
+
+	var g1a, g1b, g2, noGroup int
+	_ = b.Subscribe(ctx, "test", "g1", func(ctx context.Context, msg []byte) error { g1a++; return nil })
+	_ = b.Subscribe(ctx, "test", "g1", func(ctx context.Context, msg []byte) error { g1b++; return nil })
+	_ = b.Subscribe(ctx, "test", "g2", func(ctx context.Context, msg []byte) error { g2++; return nil })
+	_ = b.Subscribe(ctx, "test", "", func(ctx context.Context, msg []byte) error { noGroup++; return nil })
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, b.Publish(ctx, "test", []byte("hello")))
+	}
+
+	assert.Equal(t, 2, g1a)
+	assert.Equal(t, 2, g1b)
+	assert.Equal(t, 4, g2)
+	assert.Equal(t, 4, noGroup)
+}
+
+func TestPublishInsideHandler(t *testing.T) {
+	b := NewBroker()
+	ctx := context.Background()
+
+	var got string
+	_ = b.Subscribe(ctx, "a", "g", func(ctx context.Context, msg []byte) error {
+		return b.Publish(ctx, "b", msg)
+	})
+	_ = b.Subscribe(ctx, "b", "g", func(ctx context.Context, msg []byte) error {
+		got = string(msg)
+		return errors.New("handler error is not returned to publisher")
+	})
+
+	assert.Nil(t, b.Publish(ctx, "a", []byte("hello")))
+	assert.Equal(t, "hello", got)
+}
+
+func TestClose(t *testing.T) {
+	b := NewBroker()
+	ctx := context.Background()
+
+	assert.Nil(t, b.Close())
+	assert.Equal(t, ErrClosed, b.Publish(ctx, "test", []byte("hello")))
+	assert.Equal(t, ErrClosed, b.Subscribe(ctx, "test", "g", func(ctx context.Context, msg []byte) error { return nil }))
+}
+
+func TestContextPropagation(t *testing.T) {
+	b := NewBroker()
+
+	var traceId string
+	_ = b.Subscribe(context.Background(), "test", "g", func(ctx context.Context, msg []byte) error {
+		traceId = fcontext.TraceIdFromContext(ctx)
+		return nil
+	})
+
+	ctx := fcontext.TraceIdWithContext(context.Background(), "trace-1")
+	assert.Nil(t, b.Publish(ctx, "test", []byte("hello")))
+	assert.Equal(t, "trace-1", traceId)
+}
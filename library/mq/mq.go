@@ -3,38 +3,216 @@ package fmq
 import (
 	"context"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/health"
+	"github.com/lzw5399/go-common-public/library/lifecycle"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/dedupe"
+	"github.com/lzw5399/go-common-public/library/mq/delay"
 	"github.com/lzw5399/go-common-public/library/mq/k"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
 	"github.com/lzw5399/go-common-public/library/mq/n"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
 )
 
+var ErrDelayStoreNotSet = errors.New("mq delay store not set")
+
 var (
-	nOnce sync.Once
+	defaultBroker broker.Broker
+	brokerErr     error
+	brokerOnce    sync.Once
+	brokerLock    sync.RWMutex
+
+	delayStore delay.Store
 )
 
-// ProduceMessage 生产消息
-func ProduceMessage(ctx context.Context, topic string, msg []byte) error {
-	cfg := fconfig.DefaultConfig
+// SetBroker 替换当前使用的mq实现, 例如在单元测试中注入 mem.NewBroker()
+func SetBroker(b broker.Broker) {
+	brokerOnce.Do(func() {})
+
+	brokerLock.Lock()
+	defer brokerLock.Unlock()
+	defaultBroker = b
+	brokerErr = nil
+}
+
+// GetBroker 获取根据 MQ_MODE 初始化的mq实现. 未配置或不支持的模式返回nil
+func GetBroker() (broker.Broker, error) {
+	brokerOnce.Do(func() {
+		b, err := newBroker(fconfig.DefaultConfig)
+		brokerLock.Lock()
+		defer brokerLock.Unlock()
+		defaultBroker, brokerErr = b, err
+	})
+
+	brokerLock.RLock()
+	defer brokerLock.RUnlock()
+	return defaultBroker, brokerErr
+}
+
+func newBroker(cfg fconfig.Config) (broker.Broker, error) {
 	switch cfg.MQMode {
 	case "n":
-		nOnce.Do(n.Init)
-		return n.SendNMsg(ctx, topic, msg)
+		n.Init()
+		if n.Client() == nil {
+			return nil, errors.New("MQ:n not Init")
+		}
+		return n.Client(), nil
+	case "js":
+		n.Init()
+		if n.Client() == nil {
+			return nil, errors.New("MQ:js not Init")
+		}
+		return n.NewJsClient(n.Client(), n.JsOptionsFromConfig(cfg)), nil
 	case "k":
-		return k.SendKMsg(ctx, topic, string(msg))
+		return k.NewKClient(cfg.KAddr), nil
+	case "mem":
+		return mem.NewBroker(), nil
+	}
+
+	return nil, nil
+}
+
+// ProduceMessage 生产消息. 指定 WithDelay 或 WithDeliverAt 时先保存到延迟消息存储, 到期后由 delay.Dispatcher 投递
+func ProduceMessage(ctx context.Context, topic string, msg []byte, opts ...ProduceOptionFunc) error {
+	option := MergeProduceOption(opts...)
+	if option.deliverAt.After(time.Now()) {
+		_, err := ScheduleMessage(ctx, topic, msg, option.deliverAt)
+		return err
 	}
 
-	return nil
+	b, err := GetBroker()
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return nil
+	}
+
+	if option.partitionKey != "" {
+		ctx = broker.WithPartitionKey(ctx, option.partitionKey)
+	}
+	return b.Publish(ctx, topic, msg)
+}
+
+// SetDelayStore 设置延迟消息的存储, 例如 delay.NewRedisStore("fmq:delay") 或 delay.NewGormStore(nil)
+func SetDelayStore(store delay.Store) {
+	brokerLock.Lock()
+	defer brokerLock.Unlock()
+	delayStore = store
+}
+
+func getDelayStore() (delay.Store, error) {
+	brokerLock.RLock()
+	defer brokerLock.RUnlock()
+	if delayStore == nil {
+		return nil, ErrDelayStoreNotSet
+	}
+	return delayStore, nil
+}
+
+// ScheduleMessage 在deliverAt投递消息, 返回的消息ID可用于 CancelMessage
+// 需要指定消息ID时使用 broker.WithMessageId 设置ctx
+func ScheduleMessage(ctx context.Context, topic string, msg []byte, deliverAt time.Time) (string, error) {
+	store, err := getDelayStore()
+	if err != nil {
+		return "", err
+	}
+	return delay.Schedule(ctx, store, topic, msg, deliverAt)
+}
+
+// CancelMessage 取消尚未投递的延迟消息, 消息不存在或已投递时返回false
+func CancelMessage(ctx context.Context, messageId string) (bool, error) {
+	store, err := getDelayStore()
+	if err != nil {
+		return false, err
+	}
+	return store.Cancel(ctx, messageId)
+}
+
+// NewDelayDispatcher 使用当前的延迟消息存储和mq实现创建投递者, 调用 Start 启动
+// 可以在每个实例上都启动, 同一时间只有一个实例在投递
+func NewDelayDispatcher(opts ...delay.DispatcherOptionFunc) (*delay.Dispatcher, error) {
+	store, err := getDelayStore()
+	if err != nil {
+		return nil, err
+	}
+	b, err := GetBroker()
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, errors.New("MQ_MODE not set")
+	}
+	return delay.NewDispatcher(store, b, opts...), nil
 }
 
 // RegisterConsumerCallback 注册消费者回调
-func RegisterConsumerCallback(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg []byte) error) {
-	cfg := fconfig.DefaultConfig
-	switch cfg.MQMode {
-	case "n":
-		nOnce.Do(n.Init)
-		n.QueueSub(ctx, topic, group, handler)
-	case "k":
-		go k.StartKClusterClient(cfg.KAddr, topic, group, handler)
+func RegisterConsumerCallback(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg []byte) error, opts ...SubscribeOptionFunc) {
+	b, err := GetBroker()
+	if err != nil {
+		log.Errorf("RegisterConsumerCallback topic:%s group:%s err:%s", topic, group, err)
+		return
+	}
+	if b == nil {
+		return
+	}
+
+	option := MergeSubscribeOption(opts...)
+	if option.retryPolicy != nil {
+		deadLetterTopic := option.deadLetterTopic
+		if deadLetterTopic == "" {
+			deadLetterTopic = retry.DeadLetterTopic(topic)
+		}
+		handler = retry.Wrap(handler, *option.retryPolicy, b, topic, group, deadLetterTopic)
+	}
+	if option.dedupeStore != nil {
+		handler = dedupe.Wrap(handler, option.dedupeStore, group, option.dedupeOpts...)
+	}
+
+	if err := b.Subscribe(ctx, topic, group, handler, option.brokerOpts...); err != nil {
+		log.Errorf("RegisterConsumerCallback topic:%s group:%s err:%s", topic, group, err)
+	}
+}
+
+// Close 关闭当前使用的mq实现
+func Close() error {
+	b, _ := GetBroker()
+	if b == nil {
+		return nil
+	}
+	return b.Close()
+}
+
+// HealthCheck 检查 MQ_MODE 对应的mq连接, 用于 health.Register
+func HealthCheck() health.Checker {
+	return func(ctx context.Context) error {
+		b, err := GetBroker()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return errors.New("mq not configured")
+		}
+		if pinger, ok := b.(broker.Pinger); ok {
+			return pinger.Ping(ctx)
+		}
+		return nil
+	}
+}
+
+// LifecycleHook 交给 lifecycle.App 管理mq, 在http和grpc服务停止之后停止消费并关闭连接
+// 需要在http和grpc的hook之前注册
+func LifecycleHook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "mq",
+		OnStop: func(ctx context.Context) error {
+			return Close()
+		},
 	}
 }
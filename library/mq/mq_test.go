@@ -0,0 +1,116 @@
+package fmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/dedupe"
+	"github.com/lzw5399/go-common-public/library/mq/delay"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+func TestFacadeWithMemBroker(t *testing.T) {
+	SetBroker(mem.NewBroker())
+	defer SetBroker(nil)
+
+	ctx := context.Background()
+	var got []string
+	RegisterConsumerCallback(ctx, "test", "g1", func(ctx context.Context, msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	})
+
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("hello")))
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("world")))
+	assert.Equal(t, []string{"hello", "world"}, got)
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	log.InitLogger()
+	SetBroker(mem.NewBroker())
+	defer SetBroker(nil)
+
+	ctx := context.Background()
+	var deadLetters [][]byte
+	RegisterConsumerCallback(ctx, "test.failed", "ops", func(ctx context.Context, msg []byte) error {
+		deadLetters = append(deadLetters, msg)
+		return nil
+	})
+
+	calls := 0
+	RegisterConsumerCallback(ctx, "test", "g1", func(ctx context.Context, msg []byte) error {
+		calls++
+		return errors.New("always fail")
+	}, WithRetry(retry.Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond}), WithDeadLetterTopic("test.failed"))
+
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("hello")))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, len(deadLetters))
+}
+
+func TestDedupe(t *testing.T) {
+	log.InitLogger()
+	SetBroker(mem.NewBroker())
+	defer SetBroker(nil)
+
+	ctx := context.Background()
+	calls := 0
+	RegisterConsumerCallback(ctx, "test", "g1", func(ctx context.Context, msg []byte) error {
+		calls++
+		return nil
+	}, WithDedupe(dedupe.NewMemStore()))
+
+	// 相同ID的消息只处理一次
+	dupCtx := broker.WithMessageId(ctx, "msg-1")
+	assert.Nil(t, ProduceMessage(dupCtx, "test", []byte("hello")))
+	assert.Nil(t, ProduceMessage(dupCtx, "test", []byte("hello")))
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("hello")))
+	assert.Equal(t, 2, calls)
+}
+
+func TestDelayedMessage(t *testing.T) {
+	log.InitLogger()
+	SetBroker(mem.NewBroker())
+	defer SetBroker(nil)
+	defer SetDelayStore(nil)
+
+	ctx := context.Background()
+	assert.Equal(t, ErrDelayStoreNotSet, ProduceMessage(ctx, "test", []byte("hello"), WithDelay(time.Minute)))
+
+	store := delay.NewMemStore()
+	SetDelayStore(store)
+
+	var got []string
+	RegisterConsumerCallback(ctx, "test", "g1", func(ctx context.Context, msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	})
+
+	// 到期时间已过的立即发送
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("now"), WithDeliverAt(time.Now().Add(-time.Second))))
+	assert.Nil(t, ProduceMessage(ctx, "test", []byte("later"), WithDelay(20*time.Millisecond)))
+	id, err := ScheduleMessage(ctx, "test", []byte("cancelled"), time.Now().Add(20*time.Millisecond))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"now"}, got)
+	assert.Equal(t, 2, store.Len())
+
+	ok, err := CancelMessage(ctx, id)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	d, err := NewDelayDispatcher(delay.WithInterval(10 * time.Millisecond))
+	assert.Nil(t, err)
+	d.Start()
+	defer d.Stop()
+	assert.Eventually(t, func() bool {
+		return store.Len() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"now", "later"}, got)
+}
@@ -0,0 +1,27 @@
+package n
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// headerFromContext 将上下文信息转换为n的消息头, 需要服务端版本 >= 2.2
+func headerFromContext(ctx context.Context) nats.Header {
+	header := nats.Header{}
+	for k, v := range broker.HeadersFromContext(ctx) {
+		header.Set(k, v)
+	}
+	return header
+}
+
+// contextFromMsg 根据消息头重建消息处理的上下文
+func contextFromMsg(msg *nats.Msg) context.Context {
+	headers := make(map[string]string, len(msg.Header))
+	for k := range msg.Header {
+		headers[k] = msg.Header.Get(k)
+	}
+	return broker.ContextFromHeaders(headers)
+}
@@ -0,0 +1,361 @@
+package n
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+var _ broker.Broker = (*JsClient)(nil)
+
+var invalidNameRegex = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// JsOptions JetStream 的消费和自动创建stream的参数
+type JsOptions struct {
+	AckWait    time.Duration // 消息投递后未ack的超时时间, 超时后重新投递
+	MaxDeliver int           // 单条消息最大投递次数, 超过后不再投递
+	NakDelay   time.Duration // handler失败后第一次重新投递的延迟, 之后指数增长, 上限为AckWait
+	Replicas   int           // 自动创建的stream副本数
+	MaxAge     time.Duration // 自动创建的stream消息保留时间
+	FetchBatch int           // 每次拉取的消息条数上限, 实际拉取的条数不超过空闲的worker数
+	// MaxAckPending consumer已投递未ack的消息数上限, 所有实例共享. 0使用服务端默认值
+	MaxAckPending int
+}
+
+func JsOptionsFromConfig(cfg fconfig.Config) JsOptions {
+	return JsOptions{
+		AckWait:    time.Duration(cfg.NJsAckWaitSeconds) * time.Second,
+		MaxDeliver: cfg.NJsMaxDeliver,
+		NakDelay:   time.Second,
+		Replicas:   cfg.NJsReplicas,
+		MaxAge:     time.Duration(cfg.NJsMaxAgeHours) * time.Hour,
+		FetchBatch: 10,
+
+		MaxAckPending: cfg.NJsMaxAckPending,
+	}
+}
+
+func (s *NClient) JetStream() (nats.JetStreamContext, error) {
+	return s.conn.JetStream()
+}
+
+// EnsureStream 创建stream, 已存在时按cfg更新
+func (s *NClient) EnsureStream(cfg *nats.StreamConfig) error {
+	js, err := s.JetStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.StreamInfo(cfg.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = js.UpdateStream(cfg)
+	return err
+}
+
+// EnsureConsumer 创建durable consumer, 已存在时按cfg更新
+func (s *NClient) EnsureConsumer(stream string, cfg *nats.ConsumerConfig) error {
+	js, err := s.JetStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.ConsumerInfo(stream, cfg.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(stream, cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = js.UpdateConsumer(stream, cfg)
+	return err
+}
+
+// JsPublish 发送消息并等待服务端确认. msgId 用于服务端在去重窗口内(默认2分钟)丢弃重复消息
+func (s *NClient) JsPublish(ctx context.Context, topic string, data []byte, msgId string) (*nats.PubAck, error) {
+	js, err := s.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	ack, err := js.PublishMsg(&nats.Msg{
+		Subject: topic,
+		Data:    data,
+		Header:  headerFromContext(ctx),
+	}, nats.MsgId(msgId))
+	if err != nil {
+		log.Errorf("NClient js pub msg to topic:%s error:%s\n", topic, err)
+		return nil, err
+	}
+	return ack, nil
+}
+
+// JsClient 基于 JetStream 的 broker.Broker 实现
+// 每个topic自动对应一个stream, 每个group对应一个durable pull consumer, handler成功后ack, 失败后延迟重新投递
+type JsClient struct {
+	*NClient
+	opts    JsOptions
+	streams sync.Map // topic -> stream name, 已确认存在的stream
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewJsClient(client *NClient, opts JsOptions) *JsClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JsClient{
+		NClient: client,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Publish 发送消息并等待服务端确认, 超时重试时使用同一个msgId, 由服务端去重
+func (c *JsClient) Publish(ctx context.Context, topic string, msg []byte) error {
+	if _, err := c.ensureTopicStream(topic); err != nil {
+		return err
+	}
+
+	// 消息头中的ID与服务端去重使用的ID保持一致
+	ctx, msgId := broker.EnsureMessageId(ctx)
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err = c.JsPublish(ctx, topic, msg, msgId); !errors.Is(err, nats.ErrTimeout) {
+			return err
+		}
+	}
+	return err
+}
+
+// Subscribe 使用durable pull consumer消费, group为空时使用临时consumer, 每个订阅者都会收到全部消息
+func (c *JsClient) Subscribe(ctx context.Context, topic, group string, handler broker.Handler, opts ...broker.SubscribeOptionFunc) error {
+	stream, err := c.ensureTopicStream(topic)
+	if err != nil {
+		return err
+	}
+
+	js, err := c.JetStream()
+	if err != nil {
+		return err
+	}
+
+	var sub *nats.Subscription
+	if group == "" {
+		subOpts := []nats.SubOpt{nats.BindStream(stream), nats.AckExplicit(), nats.AckWait(c.opts.AckWait), nats.MaxDeliver(c.opts.MaxDeliver)}
+		if c.opts.MaxAckPending > 0 {
+			subOpts = append(subOpts, nats.MaxAckPending(c.opts.MaxAckPending))
+		}
+		sub, err = js.PullSubscribe(topic, "", subOpts...)
+	} else {
+		durable := invalidNameRegex.ReplaceAllString(group, "_")
+		err = c.EnsureConsumer(stream, &nats.ConsumerConfig{
+			Durable:       durable,
+			FilterSubject: topic,
+			AckPolicy:     nats.AckExplicitPolicy,
+			AckWait:       c.opts.AckWait,
+			MaxDeliver:    c.opts.MaxDeliver,
+			MaxAckPending: c.opts.MaxAckPending,
+			DeliverPolicy: nats.DeliverAllPolicy,
+		})
+		if err != nil {
+			return err
+		}
+		sub, err = js.PullSubscribe(topic, durable, nats.Bind(stream, durable))
+	}
+	if err != nil {
+		return err
+	}
+
+	subCtx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-subCtx.Done():
+		}
+	}()
+
+	option := broker.MergeSubscribeOption(opts...)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		c.fetchLoop(subCtx, sub, topic, handler, option)
+	}()
+	option.Assigned()
+	return nil
+}
+
+// Close 停止拉取并等待正在处理的消息完成, 然后关闭连接. 最多等待 MQ_DRAIN_TIMEOUT_SECONDS
+func (c *JsClient) Close() error {
+	c.cancel()
+	err := broker.WaitTimeout(&c.wg, broker.DrainTimeout())
+	if closeErr := c.NClient.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+// fetchLoop 只拉取空闲worker数量的消息, 拉取到的消息立即开始处理, 不会在本地排队等待而超过AckWait
+func (c *JsClient) fetchLoop(ctx context.Context, sub *nats.Subscription, topic string, handler broker.Handler, option *broker.SubscribeOption) {
+	defer sub.Unsubscribe()
+
+	pool := broker.NewPool(option.Concurrency, option.MaxPending)
+	defer func() {
+		if err := pool.Close(broker.DrainTimeout()); err != nil {
+			log.Warnf("NClient js drain topic:%s error:%s\n", topic, err)
+		}
+	}()
+
+	// idle 空闲的worker, 处理完消息后归还
+	idle := make(chan struct{}, option.Concurrency)
+	for i := 0; i < option.Concurrency; i++ {
+		idle <- struct{}{}
+	}
+
+	nakPolicy := retry.Policy{InitialBackoff: c.opts.NakDelay, MaxBackoff: c.opts.AckWait, Multiplier: 2}
+	for {
+		batch := acquireIdle(ctx, idle, c.opts.FetchBatch)
+		if batch == 0 {
+			return
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := sub.Fetch(batch, nats.Context(fetchCtx))
+		cancel()
+		// 没有拉取到消息的worker归还
+		for i := len(msgs); i < batch; i++ {
+			idle <- struct{}{}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+				log.Errorf("NClient js fetch topic:%s error:%s\n", topic, err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			msg := msg
+			// 停止时未处理的消息不ack, 超过AckWait后重新投递
+			err := pool.Submit(ctx, func() {
+				defer func() { idle <- struct{}{} }()
+				c.handleMsg(msg, topic, handler, nakPolicy)
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// acquireIdle 等待至少一个空闲的worker, 返回获取到的数量, 不超过max. ctx被取消时返回0
+func acquireIdle(ctx context.Context, idle chan struct{}, max int) int {
+	if max < 1 {
+		max = 1
+	}
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-idle:
+	}
+
+	n := 1
+	for n < max {
+		select {
+		case <-idle:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// handleMsg 成功后ack; 失败后延迟重新投递, 达到最大投递次数后终止该消息
+func (c *JsClient) handleMsg(msg *nats.Msg, topic string, handler broker.Handler, nakPolicy retry.Policy) {
+	err := handler(contextFromMsg(msg), msg.Data)
+	if err == nil {
+		_ = msg.Ack()
+		return
+	}
+
+	delivered := uint64(1)
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		delivered = meta.NumDelivered
+	}
+	if c.opts.MaxDeliver > 0 && delivered >= uint64(c.opts.MaxDeliver) {
+		log.Errorf("NClient js handle topic:%s failed after %d deliveries, give up, err:%s\n", topic, delivered, err)
+		_ = msg.Term()
+		return
+	}
+
+	log.Warnf("NClient js handle topic:%s failed (delivered=%d), err:%s\n", topic, delivered, err)
+	_ = msg.NakWithDelay(nakPolicy.Backoff(int(delivered)))
+}
+
+// ensureTopicStream 确保topic所在的stream存在, stream名为topic中的非法字符替换为_之后的结果
+func (c *JsClient) ensureTopicStream(topic string) (string, error) {
+	if stream, ok := c.streams.Load(topic); ok {
+		return stream.(string), nil
+	}
+
+	js, err := c.JetStream()
+	if err != nil {
+		return "", err
+	}
+
+	stream := invalidNameRegex.ReplaceAllString(topic, "_")
+	info, err := js.StreamInfo(stream)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     stream,
+			Subjects: []string{topic},
+			Storage:  nats.FileStorage,
+			Replicas: c.opts.Replicas,
+			MaxAge:   c.opts.MaxAge,
+		})
+	case err == nil && !containsSubject(info.Config.Subjects, topic):
+		// 不同的topic替换后可能得到同一个stream名, 此时把topic追加到已有的stream中
+		cfg := info.Config
+		cfg.Subjects = append(cfg.Subjects, topic)
+		_, err = js.UpdateStream(&cfg)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.streams.Store(topic, stream)
+	return stream, nil
+}
+
+func containsSubject(subjects []string, topic string) bool {
+	for _, subject := range subjects {
+		if subject == topic {
+			return true
+		}
+	}
+	return false
+}
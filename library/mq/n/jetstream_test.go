@@ -0,0 +1,146 @@
+package n
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+func startEmbeddedServer(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("start embedded server err: %s", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("embedded server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+func newTestJsClient(t *testing.T) *JsClient {
+	log.InitLogger()
+	ns := startEmbeddedServer(t)
+
+	c := NewNClient(ns.ClientURL())
+	c.Start()
+	js := NewJsClient(c, JsOptions{
+		AckWait:    2 * time.Second,
+		MaxDeliver: 3,
+		NakDelay:   10 * time.Millisecond,
+		Replicas:   1,
+		MaxAge:     time.Hour,
+		FetchBatch: 10,
+	})
+	t.Cleanup(func() { _ = js.Close() })
+	return js
+}
+
+func TestJsDurableConsume(t *testing.T) {
+	c := newTestJsClient(t)
+	ctx := context.Background()
+
+	// 订阅之前发送的消息也能收到
+	assert.Nil(t, c.Publish(ctx, "app.created", []byte("hello")))
+
+	got := make(chan string, 1)
+	assert.Nil(t, c.Subscribe(ctx, "app.created", "g1", func(ctx context.Context, msg []byte) error {
+		got <- string(msg)
+		return nil
+	}))
+
+	select {
+	case msg := <-got:
+		assert.Equal(t, "hello", msg)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("TestJsDurableConsume not pass")
+	}
+}
+
+func TestJsRedeliverAndMaxDeliver(t *testing.T) {
+	c := newTestJsClient(t)
+	ctx := context.Background()
+
+	var calls int32
+	done := make(chan struct{})
+	assert.Nil(t, c.Subscribe(ctx, "app.failed", "g1", func(ctx context.Context, msg []byte) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			close(done)
+		}
+		return errors.New("always fail")
+	}))
+	assert.Nil(t, c.Publish(ctx, "app.failed", []byte("hello")))
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("TestJsRedeliverAndMaxDeliver not pass, calls=%d", atomic.LoadInt32(&calls))
+	}
+
+	// 达到最大投递次数之后不再投递
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestJsPublishDedupe(t *testing.T) {
+	c := newTestJsClient(t)
+	ctx := context.Background()
+
+	_, err := c.ensureTopicStream("app.dedupe")
+	assert.Nil(t, err)
+
+	ack, err := c.JsPublish(ctx, "app.dedupe", []byte("hello"), "msg-1")
+	assert.Nil(t, err)
+	assert.False(t, ack.Duplicate)
+
+	ack, err = c.JsPublish(ctx, "app.dedupe", []byte("hello"), "msg-1")
+	assert.Nil(t, err)
+	assert.True(t, ack.Duplicate)
+}
+
+func TestSubscribeConcurrency(t *testing.T) {
+	log.InitLogger()
+	ns := startEmbeddedServer(t)
+	c := NewNClient(ns.ClientURL())
+	c.Start()
+
+	var running, maxRunning, handled int32
+	err := c.Subscribe(context.Background(), "app.pool", "g1", func(ctx context.Context, msg []byte) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, broker.WithConcurrency(3), broker.WithMaxPending(2))
+	assert.Nil(t, err)
+	assert.Nil(t, c.conn.Flush())
+
+	for i := 0; i < 12; i++ {
+		assert.Nil(t, c.Publish(context.Background(), "app.pool", []byte("hello")))
+	}
+
+	// Close 会等待已收到的消息处理完
+	assert.Nil(t, c.Close())
+	assert.Equal(t, int32(12), atomic.LoadInt32(&handled))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&maxRunning))
+}
@@ -16,7 +16,7 @@ var (
 func Init() {
 	nOnce.Do(func() {
 		cfg := fconfig.DefaultConfig
-		if cfg.NUrl == "" || cfg.MQMode != "n" {
+		if cfg.NUrl == "" || (cfg.MQMode != "n" && cfg.MQMode != "js") {
 			return
 		}
 		nClient = NewNClient(cfg.NUrl)
@@ -24,6 +24,11 @@ func Init() {
 	})
 }
 
+// Client 返回全局的NClient, 未初始化时为nil
+func Client() *NClient {
+	return nClient
+}
+
 func QueueSub(ctx context.Context, topic, queue string, cb ConsumerCb) {
 	nClient.QueueSub(ctx, topic, queue, cb)
 }
@@ -2,17 +2,27 @@ package n
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
 	"github.com/nats-io/nats.go"
 )
 
-type ConsumerCb func(ctx context.Context, input []byte) error
+type ConsumerCb = broker.Handler
+
+var _ broker.Broker = (*NClient)(nil)
+var _ broker.Pinger = (*NClient)(nil)
 
 type NClient struct {
 	url  string
 	conn *nats.Conn
+
+	poolLock sync.Mutex
+	pools    []*broker.Pool
 }
 
 func NewNClient(url string) *NClient {
@@ -28,7 +38,7 @@ func (s *NClient) closedCb(conn *nats.Conn) {
 }
 
 func (s *NClient) disconnectErrCb(conn *nats.Conn, err error) {
-	log.Warnf("NClient disconnect triggered, err:%s\n", err.Error())
+	log.Warnf("NClient disconnect triggered, err:%v\n", err)
 }
 
 func (s *NClient) discoveredServersCb(conn *nats.Conn) {
@@ -56,7 +66,11 @@ func (s *NClient) Start() {
 }
 
 func (s *NClient) Pub(ctx context.Context, topic string, bytes []byte) error {
-	err := s.conn.Publish(topic, bytes)
+	err := s.conn.PublishMsg(&nats.Msg{
+		Subject: topic,
+		Data:    bytes,
+		Header:  headerFromContext(ctx),
+	})
 	if err != nil {
 		log.Errorf("NClient pub msg to topic:%s error:%s\n", topic, err)
 	}
@@ -65,14 +79,96 @@ func (s *NClient) Pub(ctx context.Context, topic string, bytes []byte) error {
 
 func (s *NClient) Sub(ctx context.Context, topic string, cb ConsumerCb) {
 	s.conn.Subscribe(topic, func(msg *nats.Msg) {
-		cb(ctx, msg.Data)
+		cb(contextFromMsg(msg), msg.Data)
 	})
 }
 
 func (s *NClient) QueueSub(ctx context.Context, topic, queue string, cb ConsumerCb) {
-	s.conn.QueueSubscribe(topic, queue, func(msg *nats.Msg) {
-		cb(ctx, msg.Data)
+	if err := s.Subscribe(ctx, topic, queue, cb); err != nil {
+		log.Errorf("NClient queue sub topic:%s queue:%s error:%s\n", topic, queue, err)
+	}
+}
+
+// Publish 实现 broker.Producer
+func (s *NClient) Publish(ctx context.Context, topic string, msg []byte) error {
+	return s.Pub(ctx, topic, msg)
+}
+
+// Subscribe 实现 broker.Consumer, queue为空时等同于普通订阅
+// 每条消息的handler都会拿到根据消息头重建的上下文, 而不是订阅时传入的ctx
+// 消息交给有界的worker池处理, 池满时阻塞回调, 积压的消息由n客户端缓存, 超出客户端上限时按慢消费者丢弃
+func (s *NClient) Subscribe(ctx context.Context, topic, queue string, handler broker.Handler, opts ...broker.SubscribeOptionFunc) error {
+	option := broker.MergeSubscribeOption(opts...)
+	pool := broker.NewPool(option.Concurrency, option.MaxPending)
+
+	_, err := s.conn.QueueSubscribe(topic, queue, func(msg *nats.Msg) {
+		err := pool.Submit(context.Background(), func() {
+			if err := handler(contextFromMsg(msg), msg.Data); err != nil {
+				log.Errorf("NClient handle msg of topic:%s error:%s\n", topic, err)
+			}
+		})
+		if err != nil {
+			log.Warnf("NClient drop msg of topic:%s error:%s\n", topic, err)
+		}
 	})
+	if err != nil {
+		_ = pool.Close(0)
+		return err
+	}
+
+	s.poolLock.Lock()
+	s.pools = append(s.pools, pool)
+	s.poolLock.Unlock()
+	option.Assigned()
+	return nil
+}
+
+// Ping 连接断开时返回错误, 否则与服务端做一次往返确认
+func (s *NClient) Ping(ctx context.Context) error {
+	if s.conn == nil {
+		return errors.New("NClient not started")
+	}
+	if !s.conn.IsConnected() {
+		return fmt.Errorf("NClient not connected, status: %s", s.conn.Status())
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+// Close 停止接收新消息, 等待已收到的消息处理完毕后关闭连接, 最多等待 MQ_DRAIN_TIMEOUT_SECONDS, <=0时一直等待
+func (s *NClient) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	timeout := broker.DrainTimeout()
+	deadline := time.Now().Add(timeout)
+	if err := s.conn.Drain(); err != nil {
+		return err
+	}
+	// Drain 是异步的, 连接关闭时所有已收到的消息都已进入worker池
+	for !s.conn.IsClosed() && (timeout <= 0 || time.Now().Before(deadline)) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.poolLock.Lock()
+	pools := s.pools
+	s.pools = nil
+	s.poolLock.Unlock()
+
+	var err error
+	for _, pool := range pools {
+		remaining := time.Duration(0)
+		if timeout > 0 {
+			// 已经超过deadline时给一个极小值, 避免被当作不限时
+			if remaining = time.Until(deadline); remaining <= 0 {
+				remaining = time.Nanosecond
+			}
+		}
+		if closeErr := pool.Close(remaining); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 func (s *NClient) Request(topic string, bytes []byte, timeout int) ([]byte, error) {
@@ -87,3 +183,31 @@ func (s *NClient) Request(topic string, bytes []byte, timeout int) ([]byte, erro
 func (s *NClient) Response(msg *nats.Msg, data []byte) {
 	s.conn.Publish(msg.Reply, data)
 }
+
+// RequestWithContext 发送带header的请求并等待响应, 超时由ctx控制
+func (s *NClient) RequestWithContext(ctx context.Context, topic string, data []byte) ([]byte, error) {
+	msg, err := s.conn.RequestMsgWithContext(ctx, &nats.Msg{
+		Subject: topic,
+		Data:    data,
+		Header:  headerFromContext(ctx),
+	})
+	if err != nil {
+		log.Errorf("NClient request topic:%s error:%s\n", topic, err)
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+// Reply 订阅请求, handler的返回值作为响应发回. queue为空时等同于普通订阅
+func (s *NClient) Reply(topic, queue string, handler func(ctx context.Context, data []byte) []byte) error {
+	_, err := s.conn.QueueSubscribe(topic, queue, func(msg *nats.Msg) {
+		rsp := handler(contextFromMsg(msg), msg.Data)
+		if msg.Reply == "" {
+			return
+		}
+		if err := msg.Respond(rsp); err != nil {
+			log.Errorf("NClient reply topic:%s error:%s\n", topic, err)
+		}
+	})
+	return err
+}
@@ -0,0 +1,101 @@
+package fmq
+
+import (
+	"time"
+
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/dedupe"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+type SubscribeOptionFunc func(*SubscribeOption)
+
+type SubscribeOption struct {
+	retryPolicy     *retry.Policy // 为nil时不重试, 失败仅记录日志
+	deadLetterTopic string        // 重试耗尽后投递的topic, 默认为 {topic}.dlq
+	brokerOpts      []broker.SubscribeOptionFunc
+	dedupeStore     dedupe.Store // 为nil时不去重
+	dedupeOpts      []dedupe.OptionFunc
+}
+
+func MergeSubscribeOption(opts ...SubscribeOptionFunc) *SubscribeOption {
+	option := &SubscribeOption{}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+// WithRetry 消费失败时按策略重试, 重试耗尽后投递到死信topic
+func WithRetry(policy retry.Policy) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.retryPolicy = &policy
+	}
+}
+
+// WithDeadLetterTopic 指定死信topic, 需要配合 WithRetry 使用
+func WithDeadLetterTopic(topic string) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.deadLetterTopic = topic
+	}
+}
+
+// WithConcurrency 同时处理消息的handler数, k上相同key的消息仍然按顺序处理
+func WithConcurrency(concurrency int) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.brokerOpts = append(option.brokerOpts, broker.WithConcurrency(concurrency))
+	}
+}
+
+// WithMaxPending 等待处理的消息数上限, 超过时暂停接收
+func WithMaxPending(maxPending int) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.brokerOpts = append(option.brokerOpts, broker.WithMaxPending(maxPending))
+	}
+}
+
+// WithDedupe 按消息ID去重, 同一个group内相同的消息只会成功处理一次. 与 WithRetry 同时使用时重试在去重之内进行
+func WithDedupe(store dedupe.Store, opts ...dedupe.OptionFunc) SubscribeOptionFunc {
+	return func(option *SubscribeOption) {
+		option.dedupeStore = store
+		option.dedupeOpts = opts
+	}
+}
+
+type ProduceOptionFunc func(*ProduceOption)
+
+type ProduceOption struct {
+	deliverAt    time.Time // 为零值时立即发送
+	partitionKey string    // 为空时由mq实现选择分区
+}
+
+func MergeProduceOption(opts ...ProduceOptionFunc) *ProduceOption {
+	option := &ProduceOption{}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+// WithDelay 延迟d之后投递, 需要先调用 SetDelayStore 并启动 delay.Dispatcher
+func WithDelay(d time.Duration) ProduceOptionFunc {
+	return func(option *ProduceOption) {
+		option.deliverAt = time.Now().Add(d)
+	}
+}
+
+// WithDeliverAt 在指定时间投递, 时间已过时立即发送
+func WithDeliverAt(deliverAt time.Time) ProduceOptionFunc {
+	return func(option *ProduceOption) {
+		option.deliverAt = deliverAt
+	}
+}
+
+// WithPartitionKey 指定分区key, k上相同key的消息进入同一个分区, 保证顺序. 延迟投递的消息不保留该key
+func WithPartitionKey(key string) ProduceOptionFunc {
+	return func(option *ProduceOption) {
+		option.partitionKey = key
+	}
+}
@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"time"
+)
+
+const (
+	StatusPending = 0 // 待发送
+	StatusSent    = 1 // 已发送
+	StatusDead    = 2 // 超过最大重试次数, 不再发送
+)
+
+// Message 发件箱中的一条消息, 与业务数据在同一个事务中写入
+type Message struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement;index:idx_outbox_status_id,priority:2" json:"id"`
+	Topic       string     `gorm:"type:varchar(255);not null" json:"topic"`
+	Payload     []byte     `json:"payload"`
+	Headers     string     `gorm:"type:text" json:"headers"` // 写入时ctx中的header, json格式, 发送时还原trace等信息
+	Status      int        `gorm:"not null;default:0;index:idx_outbox_status_id,priority:1" json:"status"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	LastError   string     `gorm:"type:text" json:"last_error"`
+	NextRetryAt time.Time  `json:"next_retry_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SentAt      *time.Time `gorm:"index" json:"sent_at"`
+}
+
+func (Message) TableName() string {
+	return "outbox_message"
+}
+
+// Lease relay的租约, 同一时间只有持有租约的实例发送消息
+type Lease struct {
+	Name     string    `gorm:"type:varchar(64);primaryKey" json:"name"`
+	Owner    string    `gorm:"type:varchar(128);not null;default:''" json:"owner"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+func (Lease) TableName() string {
+	return "outbox_lease"
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+type RelayOptionFunc func(*RelayOption)
+
+type RelayOption struct {
+	interval        time.Duration // 轮询间隔
+	batchSize       int           // 每次读取的消息数
+	retryPolicy     retry.Policy  // 发送失败的重试策略, 超过最大次数后标记为 StatusDead
+	retention       time.Duration // 已发送消息的保留时间
+	cleanupInterval time.Duration // 清理已发送消息的间隔
+	leaseName       string        // 租约名称, 不同的relay使用不同的名称可以并行
+	leaseTTL        time.Duration // 租约有效期, 持有者宕机后最多等待这么久由其他实例接管
+}
+
+func MergeRelayOption(opts ...RelayOptionFunc) *RelayOption {
+	option := &RelayOption{
+		interval:  time.Second,
+		batchSize: 100,
+		retryPolicy: retry.Policy{
+			MaxAttempts:    10,
+			InitialBackoff: time.Second,
+			MaxBackoff:     5 * time.Minute,
+			Multiplier:     2,
+		},
+		retention:       7 * 24 * time.Hour,
+		cleanupInterval: time.Hour,
+		leaseName:       "default",
+		leaseTTL:        30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+func WithInterval(interval time.Duration) RelayOptionFunc {
+	return func(option *RelayOption) {
+		option.interval = interval
+	}
+}
+
+func WithBatchSize(batchSize int) RelayOptionFunc {
+	return func(option *RelayOption) {
+		option.batchSize = batchSize
+	}
+}
+
+func WithRetryPolicy(policy retry.Policy) RelayOptionFunc {
+	return func(option *RelayOption) {
+		option.retryPolicy = policy
+	}
+}
+
+// WithRetention 已发送消息保留多久之后删除, 以及多久清理一次
+func WithRetention(retention, cleanupInterval time.Duration) RelayOptionFunc {
+	return func(option *RelayOption) {
+		option.retention = retention
+		option.cleanupInterval = cleanupInterval
+	}
+}
+
+func WithLease(name string, ttl time.Duration) RelayOptionFunc {
+	return func(option *RelayOption) {
+		option.leaseName = name
+		option.leaseTTL = ttl
+	}
+}
@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/lzw5399/go-common-public/library/database/repo"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// Migrate 创建发件箱相关的表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Message{}, &Lease{})
+}
+
+// Add 写入一条待发送的消息. 通过 repo.SetTx 传入事务, 与业务数据一起提交或回滚
+//
+//	tx := transaction.Begin()
+//	_ = appRepo.Update(ctx, app, repo.SetTx(tx))
+//	_ = outbox.Add(ctx, "app.updated", payload, repo.SetTx(tx))
+//	_ = tx.Commit()
+func Add(ctx context.Context, topic string, payload []byte, opts ...repo.RepoOptionFunc) error {
+	ctx, option := repo.MergeRepoOption(ctx, opts...)
+
+	headers, err := json.Marshal(broker.HeadersFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	msg := &Message{
+		Topic:       topic,
+		Payload:     payload,
+		Headers:     string(headers),
+		Status:      StatusPending,
+		NextRetryAt: now,
+		CreatedAt:   now,
+	}
+	return repo.GetGormTx(ctx, option).Create(msg).Error
+}
@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	fgorm "github.com/lzw5399/go-common-public/library/database/gorm"
+	"github.com/lzw5399/go-common-public/library/log"
+	fmq "github.com/lzw5399/go-common-public/library/mq"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// Relay 将发件箱中的消息按写入顺序通过 fmq 发送出去
+// 多个实例同时运行时通过租约保证只有一个实例在发送
+type Relay struct {
+	store  store
+	owner  string
+	option *RelayOption
+
+	lastCleanup time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRelay db为nil时使用 fgorm.DB
+func NewRelay(db *gorm.DB, opts ...RelayOptionFunc) *Relay {
+	if db == nil {
+		db = fgorm.DB
+	}
+	return newRelay(newGormStore(db), opts...)
+}
+
+func newRelay(s store, opts ...RelayOptionFunc) *Relay {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		store:  s,
+		owner:  hostname + "-" + uuid.New().String(),
+		option: MergeRelayOption(opts...),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 在后台启动relay
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run()
+	}()
+}
+
+// Stop 停止relay, 等待正在发送的批次完成并释放租约
+func (r *Relay) Stop() {
+	r.cancel()
+	r.wg.Wait()
+
+	if err := r.store.releaseLease(context.Background(), r.option.leaseName, r.owner); err != nil {
+		log.Warnf("outbox relay release lease:%s err:%s", r.option.leaseName, err)
+	}
+}
+
+func (r *Relay) run() {
+	ticker := time.NewTicker(r.option.interval)
+	defer ticker.Stop()
+
+	for {
+		r.tick(r.ctx)
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) tick(ctx context.Context) {
+	for ctx.Err() == nil {
+		held, err := r.store.acquireLease(ctx, r.option.leaseName, r.owner, r.option.leaseTTL)
+		if err != nil {
+			log.Errorf("outbox relay acquire lease:%s err:%s", r.option.leaseName, err)
+			return
+		}
+		if !held {
+			return
+		}
+
+		sent, err := r.relayOnce(ctx)
+		if err != nil {
+			log.Errorf("outbox relay err:%s", err)
+			return
+		}
+		// 一批没有发满说明已经没有积压
+		if sent < r.option.batchSize {
+			break
+		}
+	}
+
+	if time.Since(r.lastCleanup) >= r.option.cleanupInterval {
+		r.lastCleanup = time.Now()
+		deleted, err := r.store.cleanup(ctx, time.Now().Add(-r.option.retention))
+		if err != nil {
+			log.Errorf("outbox relay cleanup err:%s", err)
+		} else if deleted > 0 {
+			log.Infof("outbox relay cleanup %d sent messages", deleted)
+		}
+	}
+}
+
+// relayOnce 发送一批消息, 返回发送成功的条数
+// 某条消息发送失败时停止本批次, 保证后面的消息不会先于它发出
+func (r *Relay) relayOnce(ctx context.Context) (int, error) {
+	msgs, err := r.store.fetchPending(ctx, r.option.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	policy := r.option.retryPolicy
+	for _, msg := range msgs {
+		now := time.Now()
+		if msg.NextRetryAt.After(now) {
+			return sent, nil
+		}
+
+		err := publish(msg)
+		if err == nil {
+			if err := r.store.markSent(ctx, msg.ID, now); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		attempts := msg.Attempts + 1
+		if policy.MaxAttempts > 0 && attempts >= policy.MaxAttempts {
+			log.Errorf("outbox relay message:%d topic:%s failed after %d attempts, give up, err:%s", msg.ID, msg.Topic, attempts, err)
+			if err := r.store.markDead(ctx, msg.ID, attempts, err.Error()); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		log.Warnf("outbox relay message:%d topic:%s failed (attempts=%d), err:%s", msg.ID, msg.Topic, attempts, err)
+		if err := r.store.markRetry(ctx, msg.ID, attempts, now.Add(policy.Backoff(attempts)), err.Error()); err != nil {
+			return sent, err
+		}
+		return sent, nil
+	}
+
+	return sent, nil
+}
+
+// publish 还原写入时的header后通过 fmq 发送
+// 消息ID沿用写入时的 fc-message-id, 没有时使用行id, 重试和租约过期后重复发送时ID不变, 消费端可以据此去重
+func publish(msg *Message) error {
+	headers := make(map[string]string)
+	if msg.Headers != "" {
+		if err := json.Unmarshal([]byte(msg.Headers), &headers); err != nil {
+			log.Warnf("outbox relay message:%d decode headers err:%s", msg.ID, err)
+		}
+	}
+
+	messageId := headers[broker.HeaderMessageId]
+	if messageId == "" {
+		messageId = "outbox-" + strconv.FormatUint(msg.ID, 10)
+	}
+	return fmq.ProduceMessage(broker.WithMessageId(broker.ContextFromHeaders(headers), messageId), msg.Topic, msg.Payload)
+}
@@ -0,0 +1,250 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+	fmq "github.com/lzw5399/go-common-public/library/mq"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+// memStore 内存实现, 语义与 gormStore 一致
+type memStore struct {
+	lock   sync.Mutex
+	msgs   []*Message
+	leases map[string]*Lease
+}
+
+func newMemStore() *memStore {
+	return &memStore{leases: make(map[string]*Lease)}
+}
+
+func (s *memStore) add(topic, payload string, headers map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, _ := json.Marshal(headers)
+	s.msgs = append(s.msgs, &Message{ID: uint64(len(s.msgs) + 1), Topic: topic, Payload: []byte(payload), Headers: string(h)})
+}
+
+func (s *memStore) get(id uint64) *Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.msgs[id-1]
+}
+
+func (s *memStore) acquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	lease, ok := s.leases[name]
+	if ok && lease.Owner != owner && lease.ExpireAt.After(now) {
+		return false, nil
+	}
+	s.leases[name] = &Lease{Name: name, Owner: owner, ExpireAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memStore) releaseLease(ctx context.Context, name, owner string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if lease, ok := s.leases[name]; ok && lease.Owner == owner {
+		lease.ExpireAt = time.Now().Add(-time.Second)
+	}
+	return nil
+}
+
+func (s *memStore) fetchPending(ctx context.Context, limit int) ([]*Message, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var msgs []*Message
+	for _, msg := range s.msgs {
+		if msg.Status == StatusPending && len(msgs) < limit {
+			cp := *msg
+			msgs = append(msgs, &cp)
+		}
+	}
+	return msgs, nil
+}
+
+func (s *memStore) markSent(ctx context.Context, id uint64, sentAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.msgs[id-1].Status = StatusSent
+	s.msgs[id-1].SentAt = &sentAt
+	return nil
+}
+
+func (s *memStore) markRetry(ctx context.Context, id uint64, attempts int, nextRetryAt time.Time, lastErr string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.msgs[id-1].Attempts = attempts
+	s.msgs[id-1].NextRetryAt = nextRetryAt
+	s.msgs[id-1].LastError = lastErr
+	return nil
+}
+
+func (s *memStore) markDead(ctx context.Context, id uint64, attempts int, lastErr string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.msgs[id-1].Status = StatusDead
+	s.msgs[id-1].Attempts = attempts
+	s.msgs[id-1].LastError = lastErr
+	return nil
+}
+
+func (s *memStore) cleanup(ctx context.Context, before time.Time) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var deleted int64
+	for _, msg := range s.msgs {
+		if msg.Status == StatusSent && msg.SentAt != nil && msg.SentAt.Before(before) {
+			msg.Status = -1
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// flakyBroker 前failures次发送失败, 记录每次发送的消息ID
+type flakyBroker struct {
+	*mem.Broker
+	failures   int
+	messageIds []string
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, topic string, msg []byte) error {
+	_, messageId := broker.EnsureMessageId(ctx)
+	b.messageIds = append(b.messageIds, messageId)
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+	return b.Broker.Publish(ctx, topic, msg)
+}
+
+func subscribe(t *testing.T, topic string) *[]string {
+	var got []string
+	fmq.RegisterConsumerCallback(context.Background(), topic, "", func(ctx context.Context, msg []byte) error {
+		got = append(got, string(msg)+"@"+fcontext.TraceIdFromContext(ctx))
+		return nil
+	})
+	return &got
+}
+
+func TestRelayInOrder(t *testing.T) {
+	log.InitLogger()
+	fmq.SetBroker(mem.NewBroker())
+	defer fmq.SetBroker(nil)
+	got := subscribe(t, "app")
+
+	s := newMemStore()
+	s.add("app", "1", map[string]string{fcontext.HeaderTraceId: "t1"})
+	s.add("app", "2", map[string]string{fcontext.HeaderTraceId: "t2"})
+	s.add("app", "3", map[string]string{fcontext.HeaderTraceId: "t3"})
+
+	r := newRelay(s, WithBatchSize(2))
+	r.tick(context.Background())
+
+	assert.Equal(t, []string{"1@t1", "2@t2", "3@t3"}, *got)
+	for id := uint64(1); id <= 3; id++ {
+		assert.Equal(t, StatusSent, s.get(id).Status)
+	}
+
+	// 其他实例拿不到租约
+	other := newRelay(s)
+	s.add("app", "4", nil)
+	other.tick(context.Background())
+	assert.Equal(t, 3, len(*got))
+
+	// 释放租约之后可以接管
+	r.Stop()
+	other.tick(context.Background())
+	assert.Equal(t, 4, len(*got))
+}
+
+func TestRelayRetryKeepsOrder(t *testing.T) {
+	log.InitLogger()
+	b := &flakyBroker{Broker: mem.NewBroker(), failures: 1}
+	fmq.SetBroker(b)
+	defer fmq.SetBroker(nil)
+	got := subscribe(t, "app")
+
+	s := newMemStore()
+	s.add("app", "1", nil)
+	s.add("app", "2", nil)
+
+	r := newRelay(s, WithRetryPolicy(retry.Policy{MaxAttempts: 3, InitialBackoff: 20 * time.Millisecond}))
+	r.tick(context.Background())
+
+	// 第一条失败后, 第二条不能先发出
+	assert.Equal(t, 0, len(*got))
+	assert.Equal(t, 1, s.get(1).Attempts)
+	assert.Equal(t, "broker unavailable", s.get(1).LastError)
+
+	// 未到重试时间不发送
+	r.tick(context.Background())
+	assert.Equal(t, 0, len(*got))
+
+	time.Sleep(30 * time.Millisecond)
+	r.tick(context.Background())
+	assert.Equal(t, 2, len(*got))
+	assert.Equal(t, "1@", (*got)[0][:2])
+}
+
+func TestRelayDeadAndCleanup(t *testing.T) {
+	log.InitLogger()
+	b := &flakyBroker{Broker: mem.NewBroker(), failures: 1}
+	fmq.SetBroker(b)
+	defer fmq.SetBroker(nil)
+	got := subscribe(t, "app")
+
+	s := newMemStore()
+	s.add("app", "1", nil)
+	s.add("app", "2", nil)
+
+	r := newRelay(s, WithRetryPolicy(retry.Policy{MaxAttempts: 1}), WithRetention(0, 0))
+	r.tick(context.Background())
+
+	assert.Equal(t, StatusDead, s.get(1).Status)
+	assert.Equal(t, 1, len(*got))
+
+	// 已发送的消息被清理
+	r.tick(context.Background())
+	assert.Equal(t, -1, s.get(2).Status)
+}
+
+func TestRelayRetryKeepsMessageId(t *testing.T) {
+	log.InitLogger()
+	b := &flakyBroker{Broker: mem.NewBroker(), failures: 1}
+	fmq.SetBroker(b)
+	defer fmq.SetBroker(nil)
+
+	var consumed []string
+	fmq.RegisterConsumerCallback(context.Background(), "app", "", func(ctx context.Context, msg []byte) error {
+		consumed = append(consumed, broker.MessageIdFromContext(ctx))
+		return nil
+	})
+
+	s := newMemStore()
+	s.add("app", "1", map[string]string{broker.HeaderMessageId: "m1"})
+	s.add("app", "2", nil)
+
+	r := newRelay(s, WithRetryPolicy(retry.Policy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+	r.tick(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	r.tick(context.Background())
+
+	// 同一行重试两次, 消息ID不变; 写入时没有ID的行使用行id
+	assert.Equal(t, []string{"m1", "m1", "outbox-2"}, b.messageIds)
+	assert.Equal(t, []string{"m1", "outbox-2"}, consumed)
+}
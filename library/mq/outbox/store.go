@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// store relay对发件箱的读写, 便于替换存储
+type store interface {
+	acquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	releaseLease(ctx context.Context, name, owner string) error
+	fetchPending(ctx context.Context, limit int) ([]*Message, error)
+	markSent(ctx context.Context, id uint64, sentAt time.Time) error
+	markRetry(ctx context.Context, id uint64, attempts int, nextRetryAt time.Time, lastErr string) error
+	markDead(ctx context.Context, id uint64, attempts int, lastErr string) error
+	cleanup(ctx context.Context, before time.Time) (int64, error)
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+func newGormStore(db *gorm.DB) *gormStore {
+	return &gormStore{db: db}
+}
+
+// acquireLease 租约不存在、已过期或者本身就是持有者时获取成功, 同时续期
+func (s *gormStore) acquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	// 租约行不存在时先创建一个已过期的, 已存在时忽略
+	_ = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Lease{Name: name, ExpireAt: now.Add(-time.Second)}).Error
+
+	res := db.Model(&Lease{}).
+		Where("name = ? AND (owner = ? OR expire_at < ?)", name, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "expire_at": now.Add(ttl)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *gormStore) releaseLease(ctx context.Context, name, owner string) error {
+	return s.db.WithContext(ctx).Model(&Lease{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Update("expire_at", time.Now().Add(-time.Second)).Error
+}
+
+func (s *gormStore) fetchPending(ctx context.Context, limit int) ([]*Message, error) {
+	var msgs []*Message
+	err := s.db.WithContext(ctx).
+		Where("status = ?", StatusPending).
+		Order("id").
+		Limit(limit).
+		Find(&msgs).Error
+	return msgs, err
+}
+
+func (s *gormStore) markSent(ctx context.Context, id uint64, sentAt time.Time) error {
+	return s.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": StatusSent, "sent_at": sentAt}).Error
+}
+
+func (s *gormStore) markRetry(ctx context.Context, id uint64, attempts int, nextRetryAt time.Time, lastErr string) error {
+	return s.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"attempts": attempts, "next_retry_at": nextRetryAt, "last_error": lastErr}).Error
+}
+
+func (s *gormStore) markDead(ctx context.Context, id uint64, attempts int, lastErr string) error {
+	return s.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": StatusDead, "attempts": attempts, "last_error": lastErr}).Error
+}
+
+func (s *gormStore) cleanup(ctx context.Context, before time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).
+		Where("status = ? AND sent_at < ?", StatusSent, before).
+		Delete(&Message{})
+	return res.RowsAffected, res.Error
+}
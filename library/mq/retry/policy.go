@@ -0,0 +1,45 @@
+package retry
+
+import (
+	"time"
+)
+
+// Policy 消费失败时的重试策略, 采用指数退避
+type Policy struct {
+	MaxAttempts    int           // 最大尝试次数, 包含第一次消费. <=1 代表不重试
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff     time.Duration // 等待时间的上限, 0代表不限制
+	Multiplier     float64       // 每次重试等待时间的倍数, <1 时按2处理
+}
+
+// DefaultPolicy 默认最多尝试3次, 等待 1s, 2s
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// Backoff 第attempt次失败之后, 下一次重试前需要等待的时间. attempt从1开始
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+
+	return time.Duration(backoff)
+}
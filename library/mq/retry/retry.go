@@ -0,0 +1,116 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// DeadLetterSuffix 默认死信topic的后缀
+const DeadLetterSuffix = ".dlq"
+
+// DeadLetterTopic 默认的死信topic. 订阅多个topic(逗号分隔)时需要显式指定死信topic
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// DeadLetter 重试耗尽后投递到死信topic的消息体
+type DeadLetter struct {
+	Topic    string            `json:"topic"`             // 原始topic, 重放时投递回该topic
+	Group    string            `json:"group"`             // 消费组
+	Error    string            `json:"error"`             // 最后一次消费的错误信息
+	Attempts int               `json:"attempts"`          // 已尝试的次数
+	FailedAt time.Time         `json:"failedAt"`          // 进入死信的时间
+	Payload  []byte            `json:"payload"`           // 原始消息
+	Headers  map[string]string `json:"headers,omitempty"` // 原始消息头, 包含 fc-message-id 和traceid, 重放时还原
+}
+
+// Wrap 为handler增加重试, 重试耗尽后把消息投递到 deadLetterTopic
+// producer为nil或deadLetterTopic为空时, 重试耗尽直接返回最后一次的错误
+func Wrap(handler broker.Handler, policy Policy, producer broker.Producer, topic, group, deadLetterTopic string) broker.Handler {
+	return func(ctx context.Context, msg []byte) error {
+		var err error
+		attempt := 1
+		for ; ; attempt++ {
+			if err = handler(ctx, msg); err == nil {
+				return nil
+			}
+			if attempt >= policy.MaxAttempts {
+				break
+			}
+
+			backoff := policy.Backoff(attempt)
+			log.Warnc(ctx, "mq handle topic:%s group:%s failed (attempt=%d), retry after %s, err: %s", topic, group, attempt, backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		if producer == nil || deadLetterTopic == "" {
+			return err
+		}
+
+		deadLetter := &DeadLetter{
+			Topic:    topic,
+			Group:    group,
+			Error:    err.Error(),
+			Attempts: attempt,
+			FailedAt: time.Now(),
+			Payload:  msg,
+			Headers:  originalHeaders(ctx),
+		}
+		raw, _ := json.Marshal(deadLetter)
+		if pubErr := producer.Publish(ctx, deadLetterTopic, raw); pubErr != nil {
+			return errors.Wrapf(err, "publish to dead letter topic(%s) failed: %s", deadLetterTopic, pubErr)
+		}
+
+		log.Errorc(ctx, "mq handle topic:%s group:%s failed after %d attempts, moved to dead letter topic:%s, err: %s", topic, group, attempt, deadLetterTopic, err)
+		return nil
+	}
+}
+
+// originalHeaders 消费时ctx中的消息头, 消息ID使用收到的ID而不是新生成的
+func originalHeaders(ctx context.Context) map[string]string {
+	headers := broker.HeadersFromContext(ctx)
+	if messageId := broker.MessageIdFromContext(ctx); messageId != "" {
+		headers[broker.HeaderMessageId] = messageId
+	} else {
+		delete(headers, broker.HeaderMessageId)
+	}
+	return headers
+}
+
+// DecodeDeadLetter 解析死信topic中的消息
+func DecodeDeadLetter(raw []byte) (*DeadLetter, error) {
+	var deadLetter DeadLetter
+	if err := json.Unmarshal(raw, &deadLetter); err != nil {
+		return nil, errors.Wrap(err, "decode dead letter failed")
+	}
+	if deadLetter.Topic == "" {
+		return nil, errors.New("decode dead letter failed: topic is empty")
+	}
+	return &deadLetter, nil
+}
+
+// Replay 将死信消息重新投递回原始topic, 还原原始消息头和消息ID, 消费端可以据此去重
+// 没有保存消息头的死信(旧版本写入)使用ctx发送
+func Replay(ctx context.Context, producer broker.Producer, raw []byte) error {
+	deadLetter, err := DecodeDeadLetter(raw)
+	if err != nil {
+		return err
+	}
+	if len(deadLetter.Headers) > 0 {
+		ctx = broker.ContextFromHeaders(deadLetter.Headers)
+		if messageId := deadLetter.Headers[broker.HeaderMessageId]; messageId != "" {
+			ctx = broker.WithMessageId(ctx, messageId)
+		}
+	}
+	return producer.Publish(ctx, deadLetter.Topic, deadLetter.Payload)
+}
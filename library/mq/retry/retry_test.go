@@ -0,0 +1,95 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 300*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 900*time.Millisecond, p.Backoff(3))
+	assert.Equal(t, time.Second, p.Backoff(4))
+}
+
+func TestWrapSucceedsAfterRetry(t *testing.T) {
+	log.InitLogger()
+	b := mem.NewBroker()
+
+	calls := 0
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		calls++
+		if calls < 2 {
+			return errors.New("temporary")
+		}
+		return nil
+	}, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, b, "test", "g", DeadLetterTopic("test"))
+
+	assert.Nil(t, handler(context.Background(), []byte("hello")))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrapDeadLetterAndReplay(t *testing.T) {
+	log.InitLogger()
+	b := mem.NewBroker()
+	ctx := context.Background()
+
+	var deadLetters [][]byte
+	_ = b.Subscribe(ctx, DeadLetterTopic("test"), "g", func(ctx context.Context, msg []byte) error {
+		deadLetters = append(deadLetters, msg)
+		return nil
+	})
+
+	calls := 0
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		calls++
+		return errors.New("always fail")
+	}, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, b, "test", "g", DeadLetterTopic("test"))
+
+	// 消费时的ctx由消息头重建
+	msgCtx := broker.ContextFromHeaders(map[string]string{broker.HeaderMessageId: "m1", fcontext.HeaderTraceId: "t1"})
+	assert.Nil(t, handler(msgCtx, []byte("hello")))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, len(deadLetters))
+
+	deadLetter, err := DecodeDeadLetter(deadLetters[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "test", deadLetter.Topic)
+	assert.Equal(t, "always fail", deadLetter.Error)
+	assert.Equal(t, 3, deadLetter.Attempts)
+	assert.Equal(t, "m1", deadLetter.Headers[broker.HeaderMessageId])
+	assert.Equal(t, "t1", deadLetter.Headers[fcontext.HeaderTraceId])
+
+	// 重放时还原原始的消息ID和traceid
+	var replayed, messageId, traceId string
+	_ = b.Subscribe(ctx, "test", "replay", func(ctx context.Context, msg []byte) error {
+		replayed = string(msg)
+		messageId = broker.MessageIdFromContext(ctx)
+		traceId = fcontext.TraceIdFromContext(ctx)
+		return nil
+	})
+	assert.Nil(t, Replay(ctx, b, deadLetters[0]))
+	assert.Equal(t, "hello", replayed)
+	assert.Equal(t, "m1", messageId)
+	assert.Equal(t, "t1", traceId)
+}
+
+func TestWrapWithoutDeadLetter(t *testing.T) {
+	log.InitLogger()
+
+	handler := Wrap(func(ctx context.Context, msg []byte) error {
+		return errors.New("always fail")
+	}, Policy{MaxAttempts: 1}, nil, "test", "g", "")
+
+	assert.NotNil(t, handler(context.Background(), []byte("hello")))
+}
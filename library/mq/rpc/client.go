@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// Client 通过mq调用其他服务注册的handler
+type Client struct {
+	option *Option
+}
+
+func NewClient(opts ...OptionFunc) (*Client, error) {
+	option, err := newOption(true, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{option: option}, nil
+}
+
+// Invoke 调用subject上的handler, 结果解码到rsp
+// 超时取ctx的deadline, 没有时使用 WithTimeout 的配置. 服务端返回的错误为 *ferrors.SvrRspInfo
+func (c *Client) Invoke(ctx context.Context, subject string, req, rsp interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.option.timeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	data, err := c.option.codec.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "mq rpc encode request")
+	}
+
+	out, err := c.option.transport.Request(ctx, subject, &Request{
+		ID:       uuid.New().String(),
+		Codec:    c.option.codec.Name(),
+		Deadline: deadline.UnixMilli(),
+		Headers:  broker.HeadersFromContext(ctx),
+		Data:     data,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "mq rpc request subject:%s", subject)
+	}
+	if !out.Error.Valid() {
+		return out.Error
+	}
+
+	if err := c.option.codec.Unmarshal(out.Data, rsp); err != nil {
+		return errors.Wrap(err, "mq rpc decode response")
+	}
+	return nil
+}
+
+// Call 泛型版本的 Invoke
+func Call[Req any, Rsp any](ctx context.Context, c *Client, subject string, req *Req) (*Rsp, error) {
+	rsp := new(Rsp)
+	if err := c.Invoke(ctx, subject, req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
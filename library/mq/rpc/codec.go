@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	CodecJSON  = "json"
+	CodecProto = "proto"
+)
+
+// Codec 请求和响应消息体的编解码
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = map[string]Codec{
+	CodecJSON:  JSONCodec{},
+	CodecProto: ProtoCodec{},
+}
+
+// getCodec 按名称查找codec, 找不到时使用fallback
+func getCodec(name string, fallback Codec) Codec {
+	if codec, ok := codecs[name]; ok {
+		return codec
+	}
+	return fallback
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ProtoCodec 请求和响应必须是 proto.Message
+type ProtoCodec struct{}
+
+func (ProtoCodec) Name() string {
+	return CodecProto
+}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("mq rpc proto codec: %T is not proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("mq rpc proto codec: %T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	ferrors "github.com/lzw5399/go-common-public/library/errors"
+)
+
+// Request 在mq上传输的请求
+type Request struct {
+	ID       string            `json:"id"`                // 关联请求和响应
+	ReplyTo  string            `json:"replyTo,omitempty"` // 响应发往的topic, 原生支持请求响应的n不需要
+	Codec    string            `json:"codec"`
+	Deadline int64             `json:"deadline"` // 调用方的超时时间, unix毫秒
+	Headers  map[string]string `json:"headers"`  // 调用方ctx中的trace等信息
+	Data     []byte            `json:"data"`
+}
+
+// Response 在mq上传输的响应, Error不为空时代表调用失败
+type Response struct {
+	ID    string              `json:"id"`
+	Error *ferrors.SvrRspInfo `json:"error,omitempty"`
+	Data  []byte              `json:"data"`
+}
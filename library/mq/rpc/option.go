@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"time"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+type OptionFunc func(*Option)
+
+type Option struct {
+	transport  Transport
+	codec      Codec
+	timeout    time.Duration // ctx没有deadline时使用的超时时间
+	group      string        // 服务端的消费组, 同组只有一个实例处理请求
+	replyTopic string        // 不支持原生请求响应的mq上使用的响应topic
+	replyGroup string        // 响应topic的消费组, 默认见 ReplyGroup
+}
+
+func MergeOption(opts ...OptionFunc) *Option {
+	option := &Option{
+		codec:      JSONCodec{},
+		timeout:    5 * time.Second,
+		group:      fconfig.DefaultConfig.ServerName,
+		replyTopic: fconfig.DefaultConfig.ServerName + ".rpc.reply",
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	return option
+}
+
+// WithTransport 指定transport, 不指定时根据 fmq 当前的broker选择
+func WithTransport(transport Transport) OptionFunc {
+	return func(option *Option) {
+		option.transport = transport
+	}
+}
+
+func WithCodec(codec Codec) OptionFunc {
+	return func(option *Option) {
+		option.codec = codec
+	}
+}
+
+func WithTimeout(timeout time.Duration) OptionFunc {
+	return func(option *Option) {
+		option.timeout = timeout
+	}
+}
+
+func WithGroup(group string) OptionFunc {
+	return func(option *Option) {
+		option.group = group
+	}
+}
+
+func WithReplyTopic(replyTopic string) OptionFunc {
+	return func(option *Option) {
+		option.replyTopic = replyTopic
+	}
+}
+
+// WithReplyGroup 同一主机上运行同一服务的多个实例时, 每个实例需要指定不同的响应消费组
+func WithReplyGroup(replyGroup string) OptionFunc {
+	return func(option *Option) {
+		option.replyGroup = replyGroup
+	}
+}
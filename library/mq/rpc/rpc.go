@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	fmq "github.com/lzw5399/go-common-public/library/mq"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/n"
+)
+
+type replyKey struct {
+	broker     broker.Broker
+	replyTopic string
+}
+
+var (
+	replyLock       sync.Mutex
+	replyTransports = make(map[replyKey]Transport) // 同一个响应topic在进程内只订阅一次, 所有Client共用
+)
+
+// defaultTransport 根据 fmq 当前的broker选择transport. n使用原生请求响应, 其他使用响应topic
+// 服务端只需要订阅请求, 不订阅响应topic
+func defaultTransport(option *Option, client bool) (Transport, error) {
+	b, err := fmq.GetBroker()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := b.(type) {
+	case nil:
+		return nil, errors.New("mq rpc: MQ not Init")
+	case *n.NClient:
+		return NewNatsTransport(v), nil
+	case *n.JsClient:
+		return NewNatsTransport(v.NClient), nil
+	default:
+		if !client {
+			return &brokerTransport{broker: b}, nil
+		}
+		return replyTransport(b, option)
+	}
+}
+
+func replyTransport(b broker.Broker, option *Option) (Transport, error) {
+	replyLock.Lock()
+	defer replyLock.Unlock()
+
+	key := replyKey{broker: b, replyTopic: option.replyTopic}
+	if t, ok := replyTransports[key]; ok {
+		return t, nil
+	}
+
+	replyGroup := option.replyGroup
+	if replyGroup == "" {
+		replyGroup = ReplyGroup(option.replyTopic)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replyAssignTimeout)
+	defer cancel()
+	t, err := NewBrokerTransport(ctx, b, option.replyTopic, replyGroup)
+	if err != nil {
+		return nil, err
+	}
+	replyTransports[key] = t
+	return t, nil
+}
+
+func newOption(client bool, opts ...OptionFunc) (*Option, error) {
+	option := MergeOption(opts...)
+	if option.transport != nil {
+		return option, nil
+	}
+
+	transport, err := defaultTransport(option, client)
+	if err != nil {
+		return nil, err
+	}
+	option.transport = transport
+	return option, nil
+}
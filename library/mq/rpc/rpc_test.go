@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	fcontext "github.com/lzw5399/go-common-public/library/context"
+	ferrors "github.com/lzw5399/go-common-public/library/errors"
+	"github.com/lzw5399/go-common-public/library/log"
+	fmq "github.com/lzw5399/go-common-public/library/mq"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/mem"
+	"github.com/lzw5399/go-common-public/library/mq/n"
+)
+
+type echoReq struct {
+	Name string `json:"name"`
+}
+
+type echoRsp struct {
+	Greeting string `json:"greeting"`
+	TraceId  string `json:"traceId"`
+}
+
+func echo(ctx context.Context, req *echoReq) (*echoRsp, error) {
+	if req.Name == "" {
+		return nil, ferrors.New(http.StatusBadRequest, ferrors.ECODE_PARAM_STRING_EMPTY_ERR, "name")
+	}
+	if req.Name == "slow" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &echoRsp{Greeting: "hello " + req.Name, TraceId: fcontext.TraceIdFromContext(ctx)}, nil
+}
+
+func testEcho(t *testing.T, opts ...OptionFunc) {
+	ctx := context.Background()
+	s, err := NewServer(opts...)
+	assert.Nil(t, err)
+	assert.Nil(t, Register(ctx, s, "test.echo", echo))
+
+	c, err := NewClient(opts...)
+	assert.Nil(t, err)
+
+	// 正常调用, trace透传
+	rsp, err := Call[echoReq, echoRsp](fcontext.TraceIdWithContext(ctx, "trace-1"), c, "test.echo", &echoReq{Name: "app"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello app", rsp.Greeting)
+	assert.Equal(t, "trace-1", rsp.TraceId)
+
+	// 服务端错误以 SvrRspInfo 返回
+	_, err = Call[echoReq, echoRsp](ctx, c, "test.echo", &echoReq{})
+	rspInfo, ok := err.(*ferrors.SvrRspInfo)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, rspInfo.HttpStatus)
+	assert.Equal(t, ferrors.ECODE_PARAM_STRING_EMPTY_ERR, rspInfo.ErrCode)
+	assert.Equal(t, []interface{}{"name"}, rspInfo.Args)
+}
+
+func TestRpcOverBroker(t *testing.T) {
+	log.InitLogger()
+	fmq.SetBroker(mem.NewBroker())
+	defer fmq.SetBroker(nil)
+
+	testEcho(t, WithGroup("g1"), WithReplyTopic("test.reply"))
+}
+
+func TestRpcProtoCodec(t *testing.T) {
+	log.InitLogger()
+	fmq.SetBroker(mem.NewBroker())
+	defer fmq.SetBroker(nil)
+
+	ctx := context.Background()
+	s, err := NewServer(WithCodec(ProtoCodec{}))
+	assert.Nil(t, err)
+	assert.Nil(t, Register(ctx, s, "test.upper", func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(req.GetValue() + "!"), nil
+	}))
+
+	c, err := NewClient(WithCodec(ProtoCodec{}))
+	assert.Nil(t, err)
+	rsp, err := Call[wrapperspb.StringValue, wrapperspb.StringValue](ctx, c, "test.upper", wrapperspb.String("hi"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hi!", rsp.GetValue())
+}
+
+func startNats(t *testing.T) *n.NClient {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1})
+	if err != nil {
+		t.Fatalf("start embedded server err: %s", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("embedded server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	c := n.NewNClient(ns.ClientURL())
+	c.Start()
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRpcOverNats(t *testing.T) {
+	log.InitLogger()
+	c := startNats(t)
+	testEcho(t, WithTransport(NewNatsTransport(c)), WithGroup("g1"))
+}
+
+func TestRpcTimeout(t *testing.T) {
+	log.InitLogger()
+	c := startNats(t)
+	opts := []OptionFunc{WithTransport(NewNatsTransport(c)), WithGroup("g1")}
+
+	ctx := context.Background()
+	s, err := NewServer(opts...)
+	assert.Nil(t, err)
+	assert.Nil(t, Register(ctx, s, "test.echo", echo))
+
+	client, err := NewClient(opts...)
+	assert.Nil(t, err)
+
+	// 超时取ctx的deadline, 服务端handler的ctx同样会超时
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = Call[echoReq, echoRsp](timeoutCtx, client, "test.echo", &echoReq{Name: "slow"})
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// lateBroker 模拟k, Subscribe返回之后才分配分区
+type lateBroker struct {
+	*mem.Broker
+	delay time.Duration
+}
+
+func (b *lateBroker) Subscribe(ctx context.Context, topic, group string, handler broker.Handler, opts ...broker.SubscribeOptionFunc) error {
+	option := broker.MergeSubscribeOption(opts...)
+	if err := b.Broker.Subscribe(ctx, topic, group, handler); err != nil {
+		return err
+	}
+	if b.delay > 0 {
+		time.AfterFunc(b.delay, option.Assigned)
+	}
+	return nil
+}
+
+func TestBrokerTransportWaitAssigned(t *testing.T) {
+	start := time.Now()
+	_, err := NewBrokerTransport(context.Background(), &lateBroker{Broker: mem.NewBroker(), delay: 50 * time.Millisecond}, "test.reply", "g")
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// 一直没有分配时返回错误
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = NewBrokerTransport(ctx, &lateBroker{Broker: mem.NewBroker()}, "test.reply", "g")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReplyTransportShared(t *testing.T) {
+	log.InitLogger()
+	fmq.SetBroker(mem.NewBroker())
+	defer fmq.SetBroker(nil)
+
+	c1, err := NewClient(WithReplyTopic("test.shared.reply"))
+	assert.Nil(t, err)
+	c2, err := NewClient(WithReplyTopic("test.shared.reply"))
+	assert.Nil(t, err)
+	assert.Same(t, c1.option.transport, c2.option.transport)
+	assert.Equal(t, "test.shared.reply."+hostname(t), ReplyGroup("test.shared.reply"))
+}
+
+func hostname(t *testing.T) string {
+	h, err := os.Hostname()
+	assert.Nil(t, err)
+	return h
+}
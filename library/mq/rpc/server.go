@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	ferrors "github.com/lzw5399/go-common-public/library/errors"
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+)
+
+// Server 在mq上注册handler, 供其他服务通过 Client 调用
+type Server struct {
+	option *Option
+}
+
+func NewServer(opts ...OptionFunc) (*Server, error) {
+	option, err := newOption(false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{option: option}, nil
+}
+
+// Register 注册handler, 写法与grpc的handler一致
+//
+//	rpc.Register(ctx, s, "app.get", func(ctx context.Context, req *pb.GetAppReq) (*pb.GetAppRsp, error) {...})
+//
+// handler返回的error会转换为 *ferrors.SvrRspInfo 返回给调用方
+func Register[Req any, Rsp any](ctx context.Context, s *Server, subject string, handler func(ctx context.Context, req *Req) (*Rsp, error)) error {
+	return s.option.transport.Serve(ctx, subject, s.option.group, func(_ context.Context, r *Request) *Response {
+		rsp := &Response{ID: r.ID}
+
+		// 调用方已经超时, 不再处理
+		if r.Deadline > 0 && remaining(r.Deadline) <= 0 {
+			log.Warnf("mq rpc subject:%s request:%s expired, skip", subject, r.ID)
+			rsp.Error = ferrors.New(http.StatusGatewayTimeout, ferrors.ECODE_SERVER_ERR)
+			return rsp
+		}
+
+		ctx := broker.ContextFromHeaders(r.Headers)
+		if r.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(r.Deadline))
+			defer cancel()
+		}
+
+		codec := getCodec(r.Codec, s.option.codec)
+		req := new(Req)
+		if err := codec.Unmarshal(r.Data, req); err != nil {
+			log.Warnf("mq rpc subject:%s decode request err:%s", subject, err)
+			rsp.Error = ferrors.New(http.StatusBadRequest, ferrors.ECODE_PARAM_ERR)
+			return rsp
+		}
+
+		out, err := handler(ctx, req)
+		if err != nil {
+			log.Errorf("mq rpc subject:%s handle request:%s err:%s", subject, r.ID, err)
+			rsp.Error = ferrors.ExtractSvrRspInfo(err)
+			return rsp
+		}
+
+		data, err := codec.Marshal(out)
+		if err != nil {
+			log.Errorf("mq rpc subject:%s encode response err:%s", subject, err)
+			rsp.Error = ferrors.InternalServerError()
+			return rsp
+		}
+		rsp.Data = data
+		return rsp
+	})
+}
+
+// remaining 请求中的deadline距离现在的时间
+func remaining(deadline int64) time.Duration {
+	return time.Until(time.UnixMilli(deadline))
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lzw5399/go-common-public/library/log"
+	"github.com/lzw5399/go-common-public/library/mq/broker"
+	"github.com/lzw5399/go-common-public/library/mq/n"
+)
+
+// ServeFunc 服务端处理一个请求并返回响应
+type ServeFunc func(ctx context.Context, req *Request) *Response
+
+// Transport 负责在mq上收发请求和响应
+type Transport interface {
+	// Request 发送请求并等待响应, 超时由ctx控制
+	Request(ctx context.Context, subject string, req *Request) (*Response, error)
+	// Serve 订阅subject上的请求, 同一个group内只有一个实例处理
+	Serve(ctx context.Context, subject, group string, handler ServeFunc) error
+}
+
+var (
+	_ Transport = (*natsTransport)(nil)
+	_ Transport = (*brokerTransport)(nil)
+)
+
+// natsTransport 使用n原生的请求响应
+type natsTransport struct {
+	client *n.NClient
+}
+
+func NewNatsTransport(client *n.NClient) Transport {
+	return &natsTransport{client: client}
+}
+
+func (t *natsTransport) Request(ctx context.Context, subject string, req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := t.client.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rsp Response
+	if err := json.Unmarshal(out, &rsp); err != nil {
+		return nil, errors.Wrap(err, "mq rpc decode response")
+	}
+	return &rsp, nil
+}
+
+func (t *natsTransport) Serve(ctx context.Context, subject, group string, handler ServeFunc) error {
+	return t.client.Reply(subject, group, func(ctx context.Context, data []byte) []byte {
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			log.Warnf("mq rpc decode request from subject:%s err:%s", subject, err)
+			return nil
+		}
+
+		out, _ := json.Marshal(handler(ctx, &req))
+		return out
+	})
+}
+
+// brokerTransport 在只支持发布订阅的mq(比如k)上通过响应topic和请求ID实现请求响应
+// 同一个服务的所有实例共用一个响应topic, 每个实例使用独立的消费组, 只处理自己发出的请求的响应
+type brokerTransport struct {
+	broker     broker.Broker
+	replyTopic string
+
+	pending sync.Map           // 请求ID -> chan *Response
+	stop    context.CancelFunc // 取消响应topic的订阅
+}
+
+// replyAssignTimeout 创建transport时等待响应topic开始接收消息的最长时间, k加入消费组通常需要几秒
+const replyAssignTimeout = 30 * time.Second
+
+// ReplyGroup 响应topic的默认消费组, 每个主机固定一个, 重启后复用, 不会遗留无用的消费组
+// 同一主机上运行多个实例时需要通过 WithReplyGroup 区分, 否则响应会被其他实例消费
+func ReplyGroup(replyTopic string) string {
+	hostname, _ := os.Hostname()
+	return replyTopic + "." + hostname
+}
+
+// NewBrokerTransport 订阅响应topic并等待开始接收消息(k上等待分区分配完成), 超过ctx的deadline时返回错误
+// 之后发出的请求的响应不会因为还没有分配分区而丢失. 一个进程内同一个响应topic只应该创建一个
+func NewBrokerTransport(ctx context.Context, b broker.Broker, replyTopic, replyGroup string) (Transport, error) {
+	subCtx, cancel := context.WithCancel(context.Background())
+	t := &brokerTransport{broker: b, replyTopic: replyTopic, stop: cancel}
+
+	assigned := make(chan struct{})
+	var assignOnce sync.Once
+	err := b.Subscribe(subCtx, replyTopic, replyGroup, t.onReply, broker.WithOnAssigned(func() {
+		assignOnce.Do(func() { close(assigned) })
+	}))
+	if err != nil {
+		t.stop()
+		return nil, errors.Wrap(err, "mq rpc subscribe reply topic")
+	}
+
+	select {
+	case <-assigned:
+		return t, nil
+	case <-ctx.Done():
+		t.stop()
+		return nil, errors.Wrapf(ctx.Err(), "mq rpc wait reply topic %s assigned", replyTopic)
+	}
+}
+
+func (t *brokerTransport) Request(ctx context.Context, subject string, req *Request) (*Response, error) {
+	req.ReplyTo = t.replyTopic
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先登记再发送, 同步投递的broker可能在Publish返回之前就收到了响应
+	ch := make(chan *Response, 1)
+	t.pending.Store(req.ID, ch)
+	defer t.pending.Delete(req.ID)
+
+	if err := t.broker.Publish(ctx, subject, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case rsp := <-ch:
+		return rsp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *brokerTransport) onReply(ctx context.Context, data []byte) error {
+	var rsp Response
+	if err := json.Unmarshal(data, &rsp); err != nil {
+		log.Warnf("mq rpc decode response from topic:%s err:%s", t.replyTopic, err)
+		return nil
+	}
+
+	// 不是本实例发出的请求, 或者调用方已经超时
+	ch, ok := t.pending.Load(rsp.ID)
+	if !ok {
+		return nil
+	}
+	select {
+	case ch.(chan *Response) <- &rsp:
+	default:
+	}
+	return nil
+}
+
+func (t *brokerTransport) Serve(ctx context.Context, subject, group string, handler ServeFunc) error {
+	return t.broker.Subscribe(ctx, subject, group, func(ctx context.Context, data []byte) error {
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			log.Warnf("mq rpc decode request from subject:%s err:%s", subject, err)
+			return nil
+		}
+
+		rsp := handler(ctx, &req)
+		if req.ReplyTo == "" {
+			return nil
+		}
+		out, err := json.Marshal(rsp)
+		if err != nil {
+			return err
+		}
+		return t.broker.Publish(ctx, req.ReplyTo, out)
+	})
+}
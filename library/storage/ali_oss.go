@@ -12,6 +12,7 @@ import (
 )
 
 var _ IStorage = new(aliOssStorage)
+var _ Pinger = new(aliOssStorage)
 
 type aliOssStorage struct {
 	bucket *oss.Bucket
@@ -95,3 +96,14 @@ func (o *aliOssStorage) DeleteMulti(ctx context.Context, objectNames []string) e
 	}
 	return nil
 }
+
+func (o *aliOssStorage) Ping(ctx context.Context) error {
+	exist, err := o.bucket.Client.IsBucketExist(o.bucket.BucketName)
+	if err != nil {
+		return errors.Wrap(err, "aliOssStorage Ping failed")
+	}
+	if !exist {
+		return errors.Errorf("aliOssStorage bucket %s not exist", o.bucket.BucketName)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 )
 
 var _ IStorage = new(awsS3Storage)
+var _ Pinger = new(awsS3Storage)
 
 type awsS3Storage struct {
 	cli *s3.S3
@@ -157,3 +158,13 @@ func (a *awsS3Storage) DeleteMulti(ctx context.Context, objectNames []string) er
 
 	return nil
 }
+
+func (a *awsS3Storage) Ping(ctx context.Context) error {
+	_, err := a.cli.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(fconfig.DefaultConfig.StorageBucketName),
+	})
+	if err != nil {
+		return errors.Wrap(err, "awsS3Storage Ping failed")
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 )
 
 var _ IStorage = new(diskStorage)
+var _ Pinger = new(diskStorage)
 
 type diskStorage struct {
 	cli *cos.Client
@@ -103,3 +104,12 @@ func exists(name string) bool {
 	}
 	return true
 }
+
+// Ping 目录不存在时在 Put 中创建, 只有无法访问时返回错误, 例如nas挂载异常
+func (s *diskStorage) Ping(ctx context.Context) error {
+	basePath := filepath.Dir(fconfig.DefaultConfig.StorageNasDiskBasePath)
+	if _, err := os.Stat(basePath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "diskStorage Ping failed")
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 )
 
 var _ IStorage = new(minioStorage)
+var _ Pinger = new(minioStorage)
 
 type minioStorage struct {
 	cli *minio.Client
@@ -133,3 +134,15 @@ func (m *minioStorage) DeleteMulti(ctx context.Context, objectNames []string) er
 
 	return nil
 }
+
+func (m *minioStorage) Ping(ctx context.Context) error {
+	bucket := fconfig.DefaultConfig.StorageBucketName
+	exists, err := m.cli.BucketExists(ctx, bucket)
+	if err != nil {
+		return errors.Wrap(err, "minioStorage Ping failed")
+	}
+	if !exists {
+		return errors.Errorf("minioStorage bucket %s not exist", bucket)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/health"
 	"github.com/pkg/errors"
 )
 
@@ -65,6 +66,19 @@ func DeleteMulti(ctx context.Context, objectNames []string) error {
 	return defaultStorage.DeleteMulti(ctx, objectNames)
 }
 
+// HealthCheck 检查 STORAGE_MODE 对应的存储是否可以访问, 用于 health.Register. 没有实现 Pinger 的存储只检查是否已初始化
+func HealthCheck() health.Checker {
+	return func(ctx context.Context) error {
+		if defaultStorage == nil {
+			return errors.New("storage not initialized")
+		}
+		if pinger, ok := defaultStorage.(Pinger); ok {
+			return pinger.Ping(ctx)
+		}
+		return nil
+	}
+}
+
 type IStorage interface {
 	Put(ctx context.Context, objectName string, reader io.Reader, objectSize int64, contentType string) (rsp *PutResult, err error)
 	FPut(ctx context.Context, objectName string, filePath string, reader io.Reader, objectSize int64, contentType string) (rsp *PutResult, err error)
@@ -73,6 +87,11 @@ type IStorage interface {
 	DeleteMulti(ctx context.Context, objectNames []string) error
 }
 
+// Pinger 可以检查是否可以访问的存储实现, 用于健康检查
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 type PutResult struct {
 	Size     int64
 	Location string
@@ -13,6 +13,7 @@ import (
 )
 
 var _ IStorage = new(tencentCosStorage)
+var _ Pinger = new(tencentCosStorage)
 
 type tencentCosStorage struct {
 	cli *cos.Client
@@ -116,3 +117,10 @@ func (s *tencentCosStorage) DeleteMulti(ctx context.Context, objectNames []strin
 
 	return nil
 }
+
+func (s *tencentCosStorage) Ping(ctx context.Context) error {
+	if _, err := s.cli.Bucket.Head(ctx); err != nil {
+		return errors.Wrap(err, "tencentCosStorage Ping failed")
+	}
+	return nil
+}
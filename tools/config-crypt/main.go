@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+)
+
+var usage = `%[1]s encrypts or decrypts config values in the ENC(sm4:...) format.
+
+The master key is read from -key, then $CONFIG_MASTER_KEY, then the file in $CONFIG_MASTER_KEY_FILE.
+When no value is given it is read from stdin, so secrets do not end up in shell history.
+
+Usage:
+  %[1]s -genkey
+  %[1]s -encrypt [value]
+  %[1]s -decrypt [ENC(sm4:...)]
+
+Options:
+
+`
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	var genKey, encrypt, decrypt bool
+	var keyFile string
+	flag.BoolVar(&genKey, "genkey", false, "generate a random master key in hex")
+	flag.BoolVar(&encrypt, "encrypt", false, "encrypt the value")
+	flag.BoolVar(&decrypt, "decrypt", false, "decrypt the value")
+	flag.StringVar(&keyFile, "key", "", "the file containing the master key")
+	flag.Parse()
+
+	if genKey {
+		key, err := fconfig.GenerateMasterKey()
+		if err != nil {
+			fatalf("generate master key err: %s", err)
+		}
+		fmt.Println(key)
+		return
+	}
+	if encrypt == decrypt {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	key, err := loadKey(keyFile)
+	if err != nil {
+		fatalf("load master key err: %s", err)
+	}
+	value, err := readValue(flag.Arg(0))
+	if err != nil {
+		fatalf("read value err: %s", err)
+	}
+
+	var result string
+	if encrypt {
+		result, err = fconfig.EncryptValue(value, key)
+	} else {
+		if !fconfig.IsEncrypted(value) {
+			fatalf("value is not in the ENC(...) format")
+		}
+		result, err = fconfig.DecryptValue(value, key)
+	}
+	if err != nil {
+		fatalf("%s", err)
+	}
+	fmt.Println(result)
+}
+
+func loadKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return fconfig.LoadMasterKey()
+	}
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return fconfig.ParseMasterKey(string(raw))
+}
+
+func readValue(arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var usage = `%[1]s generates the config reference from the struct tags and comments of fconfig.Config.
+
+Every field with an env tag is documented with its default, validate rule and comment.
+Embedded structs become sections, and comment lines inside a struct become sub groups.
+Duplicate env keys and env fields without a json tag are reported on stderr.
+
+Usage:
+  %[1]s -md docs/config.md -conf config.conf.sample
+  %[1]s -custom ./config:Config -md docs/config.md
+  %[1]s -check
+
+Options:
+
+`
+
+type multiFlag []string
+
+func (f *multiFlag) String() string     { return strings.Join(*f, ",") }
+func (f *multiFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	var baseDir, mdFile, confFile string
+	var customs multiFlag
+	var check bool
+	flag.StringVar(&baseDir, "base", "library/config", "the directory of the fconfig package")
+	flag.Var(&customs, "custom", "custom config type as dir:Type, can be repeated")
+	flag.StringVar(&mdFile, "md", "", "write the Markdown reference to this file, - for stdout")
+	flag.StringVar(&confFile, "conf", "", "write the sample config.conf to this file, - for stdout")
+	flag.BoolVar(&check, "check", false, "only check the tags, exit 1 when there are problems")
+	flag.Parse()
+
+	g := newGenerator()
+	if err := g.parseDir(baseDir, true); err != nil {
+		fatalf("parse %s err: %s", baseDir, err)
+	}
+	if err := g.collect(g.base, "Config", ""); err != nil {
+		fatalf("%s", err)
+	}
+	for _, custom := range customs {
+		dir, typeName, ok := strings.Cut(custom, ":")
+		if !ok || typeName == "" {
+			fatalf("invalid -custom %q, expect dir:Type", custom)
+		}
+		if err := g.parseDir(dir, false); err != nil {
+			fatalf("parse %s err: %s", dir, err)
+		}
+		if err := g.collect(g.pkgs[dir], typeName, "("+dir+")"); err != nil {
+			fatalf("%s", err)
+		}
+	}
+
+	problems := g.problems()
+	for _, p := range problems {
+		_, _ = fmt.Fprintln(os.Stderr, "warning:", p)
+	}
+	if check {
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if mdFile == "" && confFile == "" {
+		mdFile = "-"
+	}
+	if err := output(mdFile, g.markdown()); err != nil {
+		fatalf("write markdown err: %s", err)
+	}
+	if err := output(confFile, g.conf()); err != nil {
+		fatalf("write conf err: %s", err)
+	}
+}
+
+// field 一个env配置项
+type field struct {
+	Owner    string // 所在的结构体
+	Name     string
+	Type     string
+	Env      string
+	Json     string
+	Default  string
+	Validate string
+	Comment  string
+}
+
+// group 一个结构体内连续的配置项, Title为配置项上方单独一行的注释
+type group struct {
+	Title  string
+	Fields []*field
+}
+
+// section 一个结构体, Title为嵌入时的注释
+type section struct {
+	Name   string
+	Title  string
+	Groups []*group
+}
+
+type generator struct {
+	pkgs     map[string]map[string]*ast.StructType // dir -> 类型名 -> 结构体
+	base     map[string]*ast.StructType
+	sections []*section
+	visited  map[*ast.StructType]bool
+}
+
+func newGenerator() *generator {
+	return &generator{
+		pkgs:    make(map[string]map[string]*ast.StructType),
+		visited: make(map[*ast.StructType]bool),
+	}
+}
+
+func (g *generator) parseDir(dir string, base bool) error {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	structs := make(map[string]*ast.StructType)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if st, ok := typeSpec.Type.(*ast.StructType); ok {
+						structs[typeSpec.Name.Name] = st
+					}
+				}
+			}
+		}
+	}
+	g.pkgs[dir] = structs
+	if base {
+		g.base = structs
+	}
+	return nil
+}
+
+// collect 收集类型的配置项, 嵌入的结构体作为单独的section, 已经收集过的结构体(例如custom中嵌入的fconfig.Config)跳过
+func (g *generator) collect(structs map[string]*ast.StructType, typeName, title string) error {
+	st, ok := structs[typeName]
+	if !ok {
+		return fmt.Errorf("struct type %s not found", typeName)
+	}
+	g.walk(structs, typeName, title, st)
+	return nil
+}
+
+func (g *generator) walk(structs map[string]*ast.StructType, name, title string, st *ast.StructType) {
+	if g.visited[st] {
+		return
+	}
+	g.visited[st] = true
+
+	sec := &section{Name: name, Title: title}
+	g.sections = append(g.sections, sec)
+	var cur *group
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			if embedded, typeName := g.resolve(structs, f.Type); embedded != nil {
+				g.walk(structs, typeName, commentText(f.Comment), embedded)
+			}
+			continue
+		}
+
+		if cur == nil || f.Doc != nil {
+			cur = &group{Title: commentText(f.Doc)}
+			sec.Groups = append(sec.Groups, cur)
+		}
+		if f.Tag == nil {
+			continue
+		}
+		tag, _ := strconv.Unquote(f.Tag.Value)
+		tags := reflect.StructTag(tag)
+		env := strings.Split(tags.Get("env"), ",")[0]
+		if env == "" {
+			continue
+		}
+		for _, ident := range f.Names {
+			cur.Fields = append(cur.Fields, &field{
+				Owner:    name,
+				Name:     ident.Name,
+				Type:     types.ExprString(f.Type),
+				Env:      env,
+				Json:     strings.Split(tags.Get("json"), ",")[0],
+				Default:  tags.Get("envDefault"),
+				Validate: tags.Get("validate"),
+				Comment:  commentText(f.Comment),
+			})
+		}
+	}
+}
+
+// resolve 嵌入的类型, 本包的类型在当前包中查找, 其他包的类型(例如 *fconfig.Config)在fconfig包中查找
+func (g *generator) resolve(structs map[string]*ast.StructType, expr ast.Expr) (*ast.StructType, string) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return structs[t.Name], t.Name
+	case *ast.SelectorExpr:
+		return g.base[t.Sel.Name], t.Sel.Name
+	}
+	return nil, ""
+}
+
+func (g *generator) fields() []*field {
+	var fields []*field
+	for _, sec := range g.sections {
+		for _, grp := range sec.Groups {
+			fields = append(fields, grp.Fields...)
+		}
+	}
+	return fields
+}
+
+// problems 重复的env key, 以及缺少json tag的配置项(远程配置按json tag更新, 缺少时无法通过registry修改)
+func (g *generator) problems() []string {
+	var problems []string
+	seen := make(map[string]*field)
+	for _, f := range g.fields() {
+		if first, ok := seen[f.Env]; ok {
+			problems = append(problems, fmt.Sprintf("duplicate env key %s: %s.%s and %s.%s", f.Env, first.Owner, first.Name, f.Owner, f.Name))
+		} else {
+			seen[f.Env] = f
+		}
+		if f.Json == "" {
+			problems = append(problems, fmt.Sprintf("missing json tag: %s.%s (env %s)", f.Owner, f.Name, f.Env))
+		}
+	}
+	return problems
+}
+
+func (g *generator) markdown() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# 配置项说明\n\n")
+	buf.WriteString("由 tools/config-doc 根据配置结构体的tag和注释生成, 请勿手动修改.\n\n")
+	buf.WriteString("配置优先级: envDefault < config.conf < 环境变量 < config.{ENV}.conf < registry远程配置\n\n")
+	for _, sec := range g.sections {
+		if sec.empty() {
+			continue
+		}
+		fmt.Fprintf(&buf, "## %s\n\n", strings.TrimSpace(sec.Name+" "+sec.Title))
+		for _, grp := range sec.Groups {
+			if len(grp.Fields) == 0 {
+				continue
+			}
+			if grp.Title != "" {
+				fmt.Fprintf(&buf, "### %s\n\n", grp.Title)
+			}
+			buf.WriteString("| 环境变量 | 类型 | 默认值 | 校验 | 说明 |\n")
+			buf.WriteString("| --- | --- | --- | --- | --- |\n")
+			for _, f := range grp.Fields {
+				fmt.Fprintf(&buf, "| `%s` | %s | %s | %s | %s |\n",
+					f.Env, mdCell(f.Type), mdCode(f.Default), mdCode(f.Validate), mdCell(f.Comment))
+			}
+			buf.WriteString("\n")
+		}
+	}
+	return append(bytes.TrimRight(buf.Bytes(), "\n"), '\n')
+}
+
+func (g *generator) conf() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# 由 tools/config-doc 生成的示例配置, 值为代码中的默认值\n")
+	for _, sec := range g.sections {
+		if sec.empty() {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n# ==================== %s ====================\n", strings.TrimSpace(sec.Name+" "+sec.Title))
+		for _, grp := range sec.Groups {
+			if len(grp.Fields) == 0 {
+				continue
+			}
+			if grp.Title != "" {
+				fmt.Fprintf(&buf, "\n# ---- %s ----\n", grp.Title)
+			}
+			for _, f := range grp.Fields {
+				comment := f.Comment
+				if f.Validate != "" {
+					comment = strings.TrimSpace(comment + " [" + f.Validate + "]")
+				}
+				if comment != "" {
+					fmt.Fprintf(&buf, "# %s\n", comment)
+				}
+				fmt.Fprintf(&buf, "%s=%s\n", f.Env, confValue(f.Default))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func (s *section) empty() bool {
+	for _, grp := range s.Groups {
+		if len(grp.Fields) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func commentText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+func mdCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + mdCell(s) + "`"
+}
+
+// confValue dotenv格式, 包含空格、#或引号的值需要加双引号
+func confValue(s string) string {
+	if strings.ContainsAny(s, " \t#\"'") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func output(file string, data []byte) error {
+	switch file {
+	case "":
+		return nil
+	case "-":
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func fatalf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	fconfig "github.com/lzw5399/go-common-public/library/config"
+	"github.com/lzw5399/go-common-public/library/log"
+	fmq "github.com/lzw5399/go-common-public/library/mq"
+	"github.com/lzw5399/go-common-public/library/mq/retry"
+)
+
+var usage = `%[1]s inspects or replays messages in a dead letter topic.
+
+Usage: %[1]s -topic {topic}.dlq [options]
+
+Options:
+
+`
+
+type cliConfig struct {
+	*fconfig.Config
+}
+
+func (c *cliConfig) SetBaseConfig(config *fconfig.Config) {
+	c.Config = config
+}
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	var confDir, topic, group string
+	var replay bool
+	flag.StringVar(&confDir, "conf", ".", "the directory containing config.conf")
+	flag.StringVar(&topic, "topic", "", "the dead letter topic to consume")
+	flag.StringVar(&group, "group", "", "the consumer group, defaults to "+replayGroup+" for replay and a new throwaway group for inspect")
+	flag.BoolVar(&replay, "replay", false, "publish each dead letter back to its original topic")
+	flag.Parse()
+
+	if topic == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	fconfig.Init(&cliConfig{}, confDir)
+	log.InitLogger()
+
+	// inspect使用一次性的消费组并从头读取, 不会提交replay消费组的offset
+	if group == "" {
+		group = replayGroup
+		if !replay {
+			group = inspectGroup()
+			fconfig.DefaultConfig.KOffsetInitial = "oldest"
+		}
+	}
+
+	b, err := fmq.GetBroker()
+	if err != nil || b == nil {
+		fatalf("mq is not available, MQ_MODE=%s err: %v", fconfig.DefaultConfig.MQMode, err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	fmq.RegisterConsumerCallback(context.Background(), topic, group, func(ctx context.Context, msg []byte) error {
+		deadLetter, err := retry.DecodeDeadLetter(msg)
+		if err != nil {
+			infof("skip invalid dead letter: %s", err)
+			return nil
+		}
+		_ = encoder.Encode(deadLetter)
+
+		if !replay {
+			return nil
+		}
+		if err := retry.Replay(ctx, b, msg); err != nil {
+			infof("replay to %s failed: %s", deadLetter.Topic, err)
+			return err
+		}
+		infof("replayed to %s", deadLetter.Topic)
+		return nil
+	})
+	infof("consuming %s with group %s (replay=%t), press Ctrl+C to exit", topic, group, replay)
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigchan
+	_ = fmq.Close()
+}
+
+// replayGroup replay的消费组, 已重放的消息不会再次重放
+const replayGroup = "mq-dlq-replay"
+
+// inspectGroup 每次inspect使用新的消费组, 不影响之后的replay
+func inspectGroup() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("mq-dlq-inspect-%s-%d", hostname, time.Now().UnixNano())
+}
+
+func infof(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func fatalf(format string, args ...interface{}) {
+	infof(format, args...)
+	os.Exit(1)
+}